@@ -0,0 +1,118 @@
+package main
+
+// analyze.go — /analyze: what the text pipeline sees in an input
+//
+// For debugging reactions: the n-grams dissonance is measured on, the
+// pulse, which arousal words fired and which reaction templates the input
+// matches. Everything is model A's view, read without feeding its memory,
+// cloud or rng, so analyzing an input doesn't change the next reaction to it.
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"yentyo/textpulse"
+)
+
+// AnalyzeRequest is the JSON body of /analyze
+type AnalyzeRequest struct {
+	Input string `json:"input"`
+}
+
+// AnalyzeResponse is the JSON response from /analyze
+type AnalyzeResponse struct {
+	Trigrams         []string        `json:"trigrams"`    // word trigrams, sorted
+	NGramCount       int             `json:"ngram_count"` // distinct trigrams, bigrams and unigrams
+	Entropy          float32         `json:"entropy"`
+	Pulse            PulseSnapshot   `json:"pulse"`
+	Dissonance       float32         `json:"dissonance"`
+	Language         string          `json:"language"`
+	ArousalWordsHit  []string        `json:"arousal_words_hit"` // sorted, each once
+	MatchedTemplates []TemplateMatch `json:"matched_templates"`
+}
+
+// TemplateMatch is one reaction template the input matches
+type TemplateMatch struct {
+	Template int      `json:"template"` // index into reactionTemplates
+	Keywords []string `json:"keywords"` // the template's keywords the input hit
+	Starter  string   `json:"starter"`  // the template's first starter, to recognise it by
+}
+
+// analyzeInput is AnalyzeResponse for input under pg's settings
+func (pg *PromptGenerator) analyzeInput(input string) AnalyzeResponse {
+	resp := AnalyzeResponse{
+		Trigrams:         []string{},
+		ArousalWordsHit:  []string{},
+		MatchedTemplates: []TemplateMatch{},
+		Language:         detectLanguage(input),
+	}
+
+	tf := pg.trigramCounts(input)
+	resp.NGramCount = len(tf)
+	for g := range tf {
+		if strings.Count(g, " ") == 2 {
+			resp.Trigrams = append(resp.Trigrams, g)
+		}
+	}
+	sort.Strings(resp.Trigrams)
+
+	lower := strings.ToLower(input)
+	seen := map[string]bool{}
+	for _, w := range arousalHits(lower, textpulse.SplitWords(lower)) {
+		if !seen[w] {
+			seen[w] = true
+			resp.ArousalWordsHit = append(resp.ArousalWordsHit, w)
+		}
+	}
+	sort.Strings(resp.ArousalWordsHit)
+
+	words := inputWords(input)
+	for i, rt := range reactionTemplates {
+		var hit []string
+		for _, kw := range rt.keywords {
+			for _, w := range words {
+				if keywordMatches(w, kw) {
+					hit = append(hit, kw)
+					break
+				}
+			}
+		}
+		if len(hit) > 0 {
+			resp.MatchedTemplates = append(resp.MatchedTemplates, TemplateMatch{Template: i, Keywords: hit, Starter: rt.starters[0]})
+		}
+	}
+
+	resp.Dissonance, resp.Pulse, _ = pg.peekDissonance(input)
+	resp.Entropy = resp.Pulse.Entropy
+	return resp
+}
+
+// handleAnalyze answers an AnalyzeRequest. It only takes the yents' lock,
+// like /roast, and changes nothing.
+func (s *Server) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "POST only")
+		return
+	}
+	var req AnalyzeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeBadJSON, "bad json: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Input) == "" {
+		writeError(w, http.StatusBadRequest, errCodeInputRequired, errInputRequired.Error())
+		return
+	}
+	if s.rejectLongInput(w, req.Input) || !s.requireModels(w) {
+		return
+	}
+
+	s.yentMu.Lock()
+	resp := s.dy.A.analyzeInput(req.Input)
+	s.yentMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleAnalyze(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	before := srv.dy.A.rng.Int63()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+
+	w := httptest.NewRecorder()
+	srv.handleAnalyze(w, httptest.NewRequest("POST", "/analyze", strings.NewReader(`{"input":"I hate my cat I HATE it"}`)))
+	var resp AnalyzeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+
+	wantTri := []string{"cat i hate", "hate my cat", "i hate it", "i hate my", "my cat i"}
+	if !reflect.DeepEqual(resp.Trigrams, wantTri) {
+		t.Errorf("trigrams = %q, want %q", resp.Trigrams, wantTri)
+	}
+	// 5 trigrams, bigrams "i hate" "hate my" "my cat" "cat i" "hate it", 5 words
+	if resp.NGramCount != 15 {
+		t.Errorf("ngram_count = %d, want 15", resp.NGramCount)
+	}
+	if !reflect.DeepEqual(resp.ArousalWordsHit, []string{"hate"}) {
+		t.Errorf("arousal_words_hit = %q, want [hate]", resp.ArousalWordsHit)
+	}
+	var matched []int
+	for _, m := range resp.MatchedTemplates {
+		matched = append(matched, m.Template)
+	}
+	if !reflect.DeepEqual(matched, []int{1, 6}) {
+		t.Errorf("matched templates %v (%+v), want the angry one and the cat one", matched, resp.MatchedTemplates)
+	}
+	if resp.Language != langEnglish || resp.Pulse.Arousal == 0 || resp.Entropy != resp.Pulse.Entropy {
+		t.Errorf("language %q pulse %+v entropy %v", resp.Language, resp.Pulse, resp.Entropy)
+	}
+
+	// Nothing was fed into model A
+	if len(srv.dy.A.recent) != 0 || len(srv.dy.A.CloudSnapshot()) != 0 || srv.dy.A.rng.Int63() != before {
+		t.Error("/analyze changed model A's memory, cloud or rng")
+	}
+
+	for body, code := range map[string]string{`{"input":"  "}`: errCodeInputRequired, `{`: errCodeBadJSON} {
+		w := httptest.NewRecorder()
+		srv.handleAnalyze(w, httptest.NewRequest("POST", "/analyze", strings.NewReader(body)))
+		var e struct{ Error APIError }
+		json.Unmarshal(w.Body.Bytes(), &e)
+		if w.Code != 400 || e.Error.Code != code {
+			t.Errorf("%s: %d %+v, want 400 %s", body, w.Code, e.Error, code)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+// backend.go — what draws the pictures
+//
+// The server doesn't care how an image is made, only that one comes back
+// for a prompt and a seed. DiffusionBackend is that contract. "sd" runs the
+// Stable Diffusion pipeline compiled into this binary (pure Go, or ONNX
+// Runtime with -tags ort); "stub" draws a seeded gradient without any model,
+// for working on the UI or the API on a machine without the weights. A new
+// backend is one more diffusionBackends entry.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GenOpts are the sampling settings for one image
+type GenOpts struct {
+	Seed       int64
+	Steps      int
+	LatentSize int     // latent side; images are 8x that
+	Guidance   float32 // classifier-free guidance scale
+	Progress   func(step, total int)
+}
+
+// DiffusionBackend turns a prompt into an image. Generate honours ctx
+// between steps and calls opts.Progress (if set) after each one.
+type DiffusionBackend interface {
+	Name() string
+	// Ready reports whether Generate can be expected to work (/health)
+	Ready() bool
+	Generate(ctx context.Context, prompt, negative string, opts GenOpts) (*image.RGBA, error)
+}
+
+// Img2ImgBackend is a DiffusionBackend that can also start from an image:
+// strength 0 keeps init, 1 ignores it. /react/img2img and /react/reroll
+// need one.
+type Img2ImgBackend interface {
+	DiffusionBackend
+	Img2Img(ctx context.Context, prompt string, init *image.RGBA, strength float32, opts GenOpts) (*image.RGBA, error)
+}
+
+// defaultBackend is used unless --backend names another
+const defaultBackend = "sd"
+
+// diffusionBackends builds each backend by its --backend name, given the
+// SD model directory
+var diffusionBackends = map[string]func(modelDir string) DiffusionBackend{
+	"sd":   func(dir string) DiffusionBackend { return pipelineBackend{modelDir: dir} },
+	"stub": func(string) DiffusionBackend { return stubBackend{} },
+}
+
+// pipelineName names the compiled-in SD pipeline behind runDiffusion;
+// ort_pipeline.go sets it to "ort"
+var pipelineName = "purego"
+
+// errSDModelMissing is pipelineBackend's answer when sdModelReady fails,
+// so it never gets as far as loading weights
+var errSDModelMissing = errors.New("SD model not available")
+
+// errNegativeUnsupported: the SD pipelines always condition the
+// unconditional pass on the empty prompt
+var errNegativeUnsupported = errors.New("negative prompts are not supported by this backend")
+
+// parseBackend validates a --backend value
+func parseBackend(v string) string {
+	if _, ok := diffusionBackends[v]; !ok {
+		names := make([]string, 0, len(diffusionBackends))
+		for name := range diffusionBackends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fatal("unknown --backend %q (want %s)", v, strings.Join(names, " or "))
+	}
+	return v
+}
+
+// pipelineBackend runs runDiffusion on the model in modelDir
+type pipelineBackend struct {
+	modelDir string
+}
+
+func (b pipelineBackend) Name() string { return pipelineName }
+
+func (b pipelineBackend) Ready() bool { return sdModelReady(b.modelDir) }
+
+// Generate goes through a temporary PNG, which is what runDiffusion writes
+func (b pipelineBackend) Generate(ctx context.Context, prompt, negative string, opts GenOpts) (*image.RGBA, error) {
+	if negative != "" {
+		return nil, errNegativeUnsupported
+	}
+	// The pipelines fatal() on a missing model, so check before they start
+	if !b.Ready() {
+		return nil, errSDModelMissing
+	}
+
+	tmpPath := fmt.Sprintf("/tmp/yentyo_%d_%d.png", time.Now().UnixNano(), opts.Seed)
+	defer os.Remove(tmpPath)
+	if err := runDiffusion(ctx, b.modelDir, prompt, tmpPath, opts.Seed, opts.Steps, opts.LatentSize, opts.Guidance, opts.Progress); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("no image generated: %w", err)
+	}
+	defer f.Close()
+	src, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decode generated image: %w", err)
+	}
+	if rgba, ok := src.(*image.RGBA); ok {
+		return rgba, nil
+	}
+	rgba := image.NewRGBA(src.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+	return rgba, nil
+}
+
+// Img2Img runs runImg2Img, which sizes the image itself (opts.LatentSize
+// and opts.Guidance are the pipeline's own)
+func (b pipelineBackend) Img2Img(ctx context.Context, prompt string, init *image.RGBA, strength float32, opts GenOpts) (*image.RGBA, error) {
+	if !b.Ready() {
+		return nil, errSDModelMissing
+	}
+	return runImg2Img(ctx, b.modelDir, prompt, init, strength, opts.Seed, opts.Steps)
+}
+
+// stubBackend needs no model: it walks the steps and paints a diagonal
+// gradient between two colors picked by the seed. Same seed, same image.
+type stubBackend struct{}
+
+func (stubBackend) Name() string { return "stub" }
+
+func (stubBackend) Ready() bool { return true }
+
+func (stubBackend) Generate(ctx context.Context, prompt, negative string, opts GenOpts) (*image.RGBA, error) {
+	for i := 1; i <= opts.Steps; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if opts.Progress != nil {
+			opts.Progress(i, opts.Steps)
+		}
+	}
+
+	side := max(1, opts.LatentSize*8)
+	u := uint64(opts.Seed)
+	from := color.RGBA{uint8(u), uint8(u >> 8), uint8(u >> 16), 255}
+	to := color.RGBA{uint8(u >> 24), uint8(u >> 32), uint8(u >> 40), 255}
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			t := float32(x+y) / float32(2*side)
+			img.SetRGBA(x, y, color.RGBA{
+				lerp8(from.R, to.R, t), lerp8(from.G, to.G, t), lerp8(from.B, to.B, t), 255,
+			})
+		}
+	}
+	return img, nil
+}
+
+// lerp8 blends a toward b by t ∈ [0, 1]
+func lerp8(a, b uint8, t float32) uint8 {
+	return clamp8(float32(a) + (float32(b)-float32(a))*t)
+}
+
+// Img2Img cross-fades init toward the gradient Generate draws for the
+// seed, by strength
+func (b stubBackend) Img2Img(ctx context.Context, prompt string, init *image.RGBA, strength float32, opts GenOpts) (*image.RGBA, error) {
+	opts.LatentSize = max(1, init.Bounds().Dx()/8)
+	fresh, err := b.Generate(ctx, prompt, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	strength = max(0, min(1, strength))
+	out := image.NewRGBA(init.Bounds())
+	draw.Draw(out, out.Bounds(), init, init.Bounds().Min, draw.Src)
+	for y := 0; y < min(out.Bounds().Dy(), fresh.Bounds().Dy()); y++ {
+		for x := 0; x < min(out.Bounds().Dx(), fresh.Bounds().Dx()); x++ {
+			o := out.PixOffset(out.Bounds().Min.X+x, out.Bounds().Min.Y+y)
+			f := fresh.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				out.Pix[o+c] = lerp8(out.Pix[o+c], fresh.Pix[f+c], strength)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"math/rand"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStubBackend(t *testing.T) {
+	var steps []int
+	opts := GenOpts{Seed: 42, Steps: 4, LatentSize: 8, Progress: func(step, total int) { steps = append(steps, step) }}
+	img, err := stubBackend{}.Generate(context.Background(), "a duck", "", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 64 {
+		t.Errorf("image is %v, want 64x64 for an 8x8 latent", img.Bounds())
+	}
+	if len(steps) != 4 || steps[3] != 4 {
+		t.Errorf("progress steps = %v, want 1..4", steps)
+	}
+
+	again, _ := stubBackend{}.Generate(context.Background(), "a duck", "", GenOpts{Seed: 42, LatentSize: 8})
+	other, _ := stubBackend{}.Generate(context.Background(), "a duck", "", GenOpts{Seed: 43, LatentSize: 8})
+	if meanPixelDiff(img, again) != 0 {
+		t.Error("same seed drew a different image")
+	}
+	if meanPixelDiff(img, other) == 0 {
+		t.Error("different seeds drew the same image")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (stubBackend{}).Generate(ctx, "a duck", "", opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled generate: err = %v, want context.Canceled", err)
+	}
+}
+
+func TestPipelineBackendRefusals(t *testing.T) {
+	b := pipelineBackend{modelDir: t.TempDir()}
+	if b.Name() != pipelineName || b.Ready() {
+		t.Errorf("empty model dir: name %q ready %v, want %q, false", b.Name(), b.Ready(), pipelineName)
+	}
+	if _, err := b.Generate(context.Background(), "a duck", "", GenOpts{Steps: 1}); !errors.Is(err, errSDModelMissing) {
+		t.Errorf("err = %v, want errSDModelMissing", err)
+	}
+	if _, err := b.Img2Img(context.Background(), "a duck", image.NewRGBA(image.Rect(0, 0, 8, 8)), 0.5, GenOpts{Steps: 1}); !errors.Is(err, errSDModelMissing) {
+		t.Errorf("img2img: err = %v, want errSDModelMissing", err)
+	}
+	if _, err := b.Generate(context.Background(), "a duck", "blurry", GenOpts{Steps: 1}); !errors.Is(err, errNegativeUnsupported) {
+		t.Errorf("negative prompt: err = %v, want errNegativeUnsupported", err)
+	}
+}
+
+func TestReactWithStubBackend(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = "/nonexistent/path"
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.backend = stubBackend{}
+
+	w := httptest.NewRecorder()
+	srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"paint me a duck"}`)))
+	var resp ReactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+	if !resp.ImageGenerated || len(resp.Images) != 1 {
+		t.Fatalf("response = %+v, want one image from the stub backend", resp)
+	}
+	data, _ := srv.images.Get(resp.Images[0].ID)
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("stored image is not a PNG: %v", err)
+	}
+	meta, err := parsePNGText(data)
+	if want := strconv.FormatInt(resp.Images[0].Seed, 10); err != nil || meta["seed"] != want {
+		t.Errorf("image metadata = %v (%v), want seed %s", meta, err, want)
+	}
+	if meta["backend"] != "stub" {
+		t.Errorf("image metadata = %v, want backend stub", meta)
+	}
+	for _, key := range []string{"model", "steps", "guidance"} {
+		if _, ok := meta[key]; ok {
+			t.Errorf("stub image records %s=%q, which it never used", key, meta[key])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	var h HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Backend != "stub" || !h.ImageGeneration || !h.Ready || h.SDReady {
+		t.Errorf("health = %+v, want the stub backend generating images without an SD model", h)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+// batch.go — /react/batch: many inputs, one call
+//
+// For offline gallery builds: a poem line by line in, every reaction and
+// image out. Inputs run one after another under the model lock, exactly as
+// if each had been its own /react, and a bad input only fails its own
+// entry (ReactResponse.Error) instead of the whole batch.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxBatch caps ReactBatchRequest.Inputs unless --max-batch says otherwise
+const defaultMaxBatch = 16
+
+// ReactBatchRequest is the JSON body for /react/batch. The embedded options
+// apply to every input; its Input field is ignored.
+type ReactBatchRequest struct {
+	Inputs []string `json:"inputs"`
+	ReactRequest
+}
+
+// handleReactBatch answers with one ReactResponse per input, in order
+func (s *Server) handleReactBatch(w http.ResponseWriter, r *http.Request) {
+	s.metrics.incRequests()
+	ctx := withRequestID(w, r)
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "POST only")
+		return
+	}
+	var batch ReactBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeBadJSON, "bad json: "+err.Error())
+		return
+	}
+	maxBatch := s.maxBatch
+	if maxBatch <= 0 {
+		maxBatch = defaultMaxBatch
+	}
+	if len(batch.Inputs) == 0 || len(batch.Inputs) > maxBatch {
+		writeError(w, http.StatusBadRequest, errCodeBatchSize, fmt.Sprintf("inputs must hold 1..%d entries", maxBatch))
+		return
+	}
+	if s.rejectWhileWarming(w) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireModels(w) {
+		return
+	}
+
+	results := make([]ReactResponse, len(batch.Inputs))
+	for i, input := range batch.Inputs {
+		if r.Context().Err() != nil {
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
+		req := batch.ReactRequest
+		req.Input = input
+		if err := normalizeReactRequest(&req); err != nil {
+			results[i] = ReactResponse{Error: err.Error()}
+			continue
+		}
+		if s.inputTooLong(input) {
+			results[i] = ReactResponse{Error: errInputTooLong}
+			continue
+		}
+		// <batch id>.<index>, so each entry's log lines can be told apart
+		itemCtx := context.WithValue(ctx, requestIDKey{}, fmt.Sprintf("%s.%d", requestID(ctx), i))
+		results[i] = s.react(itemCtx, req, nil, nil)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
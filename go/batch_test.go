@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleReactBatch(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = t.TempDir()
+
+	body := `{"inputs":["paint me a duck","","a cathedral of rust"],"max_tokens":8}`
+	req := httptest.NewRequest("POST", "/react/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	srv.handleReactBatch(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp []ReactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if len(resp) != 3 {
+		t.Fatalf("got %d entries, want 3", len(resp))
+	}
+	for _, i := range []int{0, 2} {
+		if resp[i].Error != "" || resp[i].Prompt == "" || resp[i].Roast == "" {
+			t.Errorf("entry %d = %+v, want a successful reaction", i, resp[i])
+		}
+	}
+	if resp[1].Error != "input required" || resp[1].Prompt != "" {
+		t.Errorf("entry 1 = %+v, want only error \"input required\"", resp[1])
+	}
+}
+
+func TestHandleReactBatchSize(t *testing.T) {
+	srv := newTestServer()
+	srv.maxBatch = 2
+
+	for _, inputs := range []string{`[]`, `["a","b","c"]`} {
+		req := httptest.NewRequest("POST", "/react/batch", strings.NewReader(fmt.Sprintf(`{"inputs":%s}`, inputs)))
+		w := httptest.NewRecorder()
+		srv.handleReactBatch(w, req)
+		if w.Code != 400 || apiErrorCode(w) != errCodeBatchSize {
+			t.Errorf("inputs %s: status = %d %s, want 400 with code %s", inputs, w.Code, w.Body, errCodeBatchSize)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipJSONResponse(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = t.TempDir()
+	h := withGzip(srv.routes())
+
+	req := httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"paint me a duck"}`))
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	body := w.Body.Bytes()
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		t.Fatalf("body doesn't start with the gzip magic: % x", body[:min(len(body), 4)])
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp ReactResponse
+	if err := json.Unmarshal(plain, &resp); err != nil {
+		t.Fatalf("decompressed body %q is not JSON: %v", plain, err)
+	}
+	if resp.Prompt == "" || resp.Roast == "" {
+		t.Errorf("decompressed response = %+v, want a prompt and a roast", resp)
+	}
+}
+
+func TestGzipSkipsImagesAndPlainClients(t *testing.T) {
+	srv := newTestServer()
+	id, _ := srv.storeImage([]byte("\x89PNG fake"))
+	h := withGzip(srv.routes())
+
+	req := httptest.NewRequest("GET", "/image/"+id, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "\x89PNG fake" {
+		t.Errorf("image was re-encoded: Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+
+	req = httptest.NewRequest("GET", "/cloud", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("client without Accept-Encoding got Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"br, gzip":            true,
+		"GZIP;q=0.5":          true,
+		"*":                   true,
+		"gzip;q=0":            false,
+		"deflate, br":         false,
+		"identity, gzip; q=0": false,
+	} {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
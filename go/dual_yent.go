@@ -18,15 +18,31 @@ import (
 )
 
 // DualYent orchestrates two prompt generators
+//
+// A and B never share mutable state: each is loaded from its own GGUF read
+// with its own weights, KV cache and scratch buffers (LlamaState), sampling
+// buffers, RNG and cloud. That is what lets React run the artist and the
+// commentator in parallel. A single PromptGenerator is not safe for
+// concurrent use, so React itself must not be called concurrently (the
+// server serializes it behind Server.yentMu).
 type DualYent struct {
-	A    *PromptGenerator // first model
-	B    *PromptGenerator // second model
-	rng  *rand.Rand
-	turn int // for alternating roles
+	A   *PromptGenerator // first model
+	B   *PromptGenerator // second model
+	rng *rand.Rand
+
+	turnMu sync.Mutex // guards turn and rng, so roles stay consistent even if React calls overlap
+	turn   int        // for alternating roles
 }
 
 // NewDualYent loads two models
 func NewDualYent(pathA, pathB string) (*DualYent, error) {
+	return NewDualYentSeeded(pathA, pathB, time.Now().UnixNano())
+}
+
+// NewDualYentSeeded loads two models with every random choice — who opens as
+// artist, reaction templates, styles, token sampling — drawn from seed, so
+// the same inputs replay the same reactions.
+func NewDualYentSeeded(pathA, pathB string, seed int64) (*DualYent, error) {
 	fmt.Fprintf(os.Stderr, "[dual] loading model A: %s\n", pathA)
 	a, err := NewPromptGenerator(pathA)
 	if err != nil {
@@ -39,13 +55,24 @@ func NewDualYent(pathA, pathB string) (*DualYent, error) {
 		return nil, fmt.Errorf("model B: %w", err)
 	}
 
-	fmt.Fprintf(os.Stderr, "[dual] both models loaded\n")
+	fmt.Fprintf(os.Stderr, "[dual] both models loaded (seed %d)\n", seed)
 
-	return &DualYent{
-		A:   a,
-		B:   b,
-		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
-	}, nil
+	return seedDualYent(a, b, seed), nil
+}
+
+// seedDualYent pairs a and b under one seed: the ensemble RNG comes from
+// seed and each generator's RNG from the ensemble's
+func seedDualYent(a, b *PromptGenerator, seed int64) *DualYent {
+	rng := rand.New(rand.NewSource(seed))
+	a.rng = rand.New(rand.NewSource(rng.Int63()))
+	b.rng = rand.New(rand.NewSource(rng.Int63()))
+	return &DualYent{A: a, B: b, rng: rng}
+}
+
+// SetWeights gives both models the same dissonance temperament
+func (dy *DualYent) SetWeights(w DissonanceWeights) {
+	dy.A.Weights = &w
+	dy.B.Weights = &w
 }
 
 // DualResult holds outputs from both yents
@@ -56,21 +83,144 @@ type DualResult struct {
 	ArtistID  string // which model was artist ("A" or "B")
 }
 
+// roastHistory is how many earlier session lines the commentator sees
+const roastHistory = 3
+
+// Roast defaults: a sentence or two, sampled a little hotter than the art
+const (
+	defaultRoastMaxTokens  = 50
+	defaultRoastTempOffset = 0.2
+)
+
+// minRoastTemperature keeps a negative RoastTempOffset from zeroing the
+// commentator's temperature
+const minRoastTemperature = 0.05
+
 // React runs both yents in parallel on user input
 func (dy *DualYent) React(userInput string, maxTokens int, temperature float32) DualResult {
-	// Alternate roles each turn
-	dy.turn++
-	var artist, commentator *PromptGenerator
-	var artistID string
-	if dy.turn%2 == 0 {
-		artist, commentator = dy.A, dy.B
-		artistID = "A"
-	} else {
-		artist, commentator = dy.B, dy.A
-		artistID = "B"
+	return dy.ReactSession(userInput, nil, maxTokens, temperature)
+}
+
+// ReactSession is React within a conversation: the artist judges dissonance
+// against the session's history and the commentator sees its last few lines.
+// sess may be nil.
+func (dy *DualYent) ReactSession(userInput string, sess *Session, maxTokens int, temperature float32) DualResult {
+	return dy.ReactWith(userInput, sess, maxTokens, temperature, ReactOptions{})
+}
+
+// ReactOptions are the optional extras of ReactWith and ReactAware
+type ReactOptions struct {
+	// Candidates is how many artist prompts to sample; the most dissonant
+	// one wins (see PromptGenerator.ReactBestOf). 0 or 1 → a single prompt.
+	Candidates int
+
+	// OnPrompt receives the artist's finished prompt: before the roast in
+	// ReactAware, after both are done in ReactWith
+	OnPrompt func(prompt string)
+
+	// OnRoast receives the roast piece by piece as it is generated. In
+	// ReactWith it runs on the commentator's goroutine.
+	OnRoast func(piece string)
+
+	// RequestID tags the [dual] log line (the server's X-Request-ID)
+	RequestID string
+
+	// Artist forces which model draws: ArtistA, ArtistB, or ArtistAuto
+	// ("" too) to keep alternating. A forced turn does not advance the
+	// alternation.
+	Artist string
+
+	// RoastMaxTokens caps the roast; 0 → defaultRoastMaxTokens
+	RoastMaxTokens int
+
+	// RoastTempOffset is added to the temperature for the roast; nil →
+	// defaultRoastTempOffset
+	RoastTempOffset *float32
+
+	// Sampling's non-zero fields override both models' own
+	// PromptGenerator.Sampling for this turn; the rest stay theirs
+	Sampling *Sampling
+
+	// Seed, when not 0, seeds both models' draws for this turn and picks
+	// the artist by its parity (unless Artist does) without moving the
+	// alternation on, so the same input and seed give the same text
+	// (see PromptGenerator.ReactSeeded); 0 keeps their own streams
+	Seed int64
+}
+
+// artist is the Artist to force for the turn: o.Artist, or for a seeded
+// turn the one the seed's parity picks
+func (o ReactOptions) artist() string {
+	if (o.Artist != "" && o.Artist != ArtistAuto) || o.Seed == 0 {
+		return o.Artist
+	}
+	if o.Seed%2 == 0 {
+		return ArtistA
 	}
+	return ArtistB
+}
 
-	fmt.Fprintf(os.Stderr, "[dual] turn=%d artist=%s\n", dy.turn, artistID)
+// useSeed seeds gens with o.Seed for the turn and returns what puts their
+// own rngs back
+func (o ReactOptions) useSeed(gens ...*PromptGenerator) (restore func()) {
+	restores := make([]func(), len(gens))
+	for i, pg := range gens {
+		restores[i] = pg.seeded(o.Seed)
+	}
+	return func() {
+		for _, r := range restores {
+			r()
+		}
+	}
+}
+
+// useSampling puts o.Sampling over gens' own for the turn and returns
+// what puts theirs back. The models are the turn's alone, so nothing else sees
+// the swap.
+func (o ReactOptions) useSampling(gens ...*PromptGenerator) (restore func()) {
+	if o.Sampling == nil {
+		return func() {}
+	}
+	saved := make([]Sampling, len(gens))
+	for i, pg := range gens {
+		saved[i], pg.Sampling = pg.Sampling, o.Sampling.over(pg.Sampling)
+	}
+	return func() {
+		for i, pg := range gens {
+			pg.Sampling = saved[i]
+		}
+	}
+}
+
+// roastSampling is the roast's token budget and temperature for a turn
+// sampled at temperature
+func (o ReactOptions) roastSampling(temperature float32) (int, float32) {
+	maxTokens := o.RoastMaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultRoastMaxTokens
+	}
+	offset := float32(defaultRoastTempOffset)
+	if o.RoastTempOffset != nil {
+		offset = *o.RoastTempOffset
+	}
+	return maxTokens, max(temperature+offset, minRoastTemperature)
+}
+
+// ReactOptions.Artist values
+const (
+	ArtistAuto = "auto"
+	ArtistA    = "A"
+	ArtistB    = "B"
+)
+
+// ReactWith is ReactSession with ReactOptions: best-of-N artist prompts and
+// live roast pieces. OnRoast is done before ReactWith returns.
+func (dy *DualYent) ReactWith(userInput string, sess *Session, maxTokens int, temperature float32, opts ReactOptions) DualResult {
+	artist, commentator, artistID := dy.nextTurn(opts.RequestID, opts.artist())
+	defer opts.useSampling(artist, commentator)()
+	defer opts.useSeed(artist, commentator)()
+	history := roastHistoryOf(sess)
+	roastTokens, roastTemp := opts.roastSampling(temperature)
 
 	var prompt, roast string
 	var wg sync.WaitGroup
@@ -79,18 +229,145 @@ func (dy *DualYent) React(userInput string, maxTokens int, temperature float32)
 	// Artist: generate visual prompt
 	go func() {
 		defer wg.Done()
-		prompt = artist.React(userInput, maxTokens, temperature)
+		prompt = artist.ReactBestOf(userInput, sess, maxTokens, temperature, opts.Candidates)
 	}()
 
-	// Commentator: roast the user (stream to stderr for now)
+	// Commentator: roast the user, live if someone is listening
 	go func() {
 		defer wg.Done()
-		roast = commentator.Roast(userInput, 50, temperature+0.2)
+		if opts.OnRoast == nil {
+			roast = commentator.RoastSession(userInput, history, roastTokens, roastTemp)
+			return
+		}
+		roast = collectRoast(streamRoast(commentator, userInput, history, roastTokens, roastTemp), opts.OnRoast)
 	}()
 
 	wg.Wait()
+	if opts.OnPrompt != nil {
+		opts.OnPrompt(prompt)
+	}
 
-	// Extract yent words (before style suffix) for ASCII overlay
+	return DualResult{
+		Prompt:    prompt,
+		YentWords: extractYentWords(prompt),
+		Roast:     roast,
+		ArtistID:  artistID,
+	}
+}
+
+// ReactAware runs the artist first and then lets the commentator see the
+// finished prompt, so the roast can mock the art instead of only the user.
+// Slower than ReactWith (no parallelism).
+func (dy *DualYent) ReactAware(userInput string, sess *Session, maxTokens int, temperature float32, opts ReactOptions) DualResult {
+	artist, commentator, artistID := dy.nextTurn(opts.RequestID, opts.artist())
+	defer opts.useSampling(artist, commentator)()
+	defer opts.useSeed(artist, commentator)()
+	history := roastHistoryOf(sess)
+
+	prompt := artist.ReactBestOf(userInput, sess, maxTokens, temperature, opts.Candidates)
+	if opts.OnPrompt != nil {
+		opts.OnPrompt(prompt)
+	}
+
+	var roast string
+	roastTokens, roastTemp := opts.roastSampling(temperature)
+	if opts.OnRoast == nil {
+		roast = commentator.RoastArt(userInput, history, prompt, roastTokens, roastTemp)
+	} else {
+		roast = collectRoast(commentator.RoastArtStream(userInput, history, prompt, roastTokens, roastTemp), opts.OnRoast)
+	}
+
+	return DualResult{
+		Prompt:    prompt,
+		YentWords: extractYentWords(prompt),
+		Roast:     roast,
+		ArtistID:  artistID,
+	}
+}
+
+// Roast runs only the commentator's side of a turn: no visual prompt, the
+// artist stays idle. The turn still counts toward the alternation (unless
+// seeded, see ReactOptions.Seed), and opts.Artist picks the roles as in
+// ReactWith (the commentator is the other model). Only the commentator is
+// touched.
+func (dy *DualYent) Roast(userInput string, temperature float32, opts ReactOptions) DualResult {
+	_, commentator, artistID := dy.nextTurn(opts.RequestID, opts.artist())
+	defer opts.useSampling(commentator)()
+	defer opts.useSeed(commentator)()
+	roastTokens, roastTemp := opts.roastSampling(temperature)
+
+	var roast string
+	if opts.OnRoast == nil {
+		roast = commentator.RoastSession(userInput, nil, roastTokens, roastTemp)
+	} else {
+		roast = collectRoast(streamRoast(commentator, userInput, nil, roastTokens, roastTemp), opts.OnRoast)
+	}
+	return DualResult{Roast: roast, ArtistID: artistID}
+}
+
+// nextTurn alternates the roles: returns artist, commentator and the
+// artist's id. Which model opens is drawn from dy.rng on the first turn.
+// force (ArtistA or ArtistB) overrides the alternation for this turn only.
+// reqID (may be empty) goes into the log line.
+func (dy *DualYent) nextTurn(reqID, force string) (*PromptGenerator, *PromptGenerator, string) {
+	dy.turnMu.Lock()
+	defer dy.turnMu.Unlock()
+
+	artist, commentator, artistID := dy.B, dy.A, ArtistB
+	switch force {
+	case ArtistA:
+		artist, commentator, artistID = dy.A, dy.B, ArtistA
+	case ArtistB:
+	default:
+		if dy.turn == 0 && dy.rng != nil {
+			dy.turn = dy.rng.Intn(2)
+		}
+		dy.turn++
+		if dy.turn%2 == 0 {
+			artist, commentator, artistID = dy.A, dy.B, ArtistA
+		}
+	}
+	if reqID == "" {
+		reqID = "-"
+	}
+	fmt.Fprintf(os.Stderr, "[dual] req=%s turn=%d artist=%s\n", reqID, dy.turn, artistID)
+	return artist, commentator, artistID
+}
+
+// resetTurn restarts the alternation: the next automatic turn draws the
+// opening artist again
+func (dy *DualYent) resetTurn() {
+	dy.turnMu.Lock()
+	defer dy.turnMu.Unlock()
+	dy.turn = 0
+}
+
+// roastHistoryOf is the commentator's view of the session: its last
+// roastHistory inputs. Taken before the artist appends this input.
+func roastHistoryOf(sess *Session) []string {
+	if sess == nil {
+		return nil
+	}
+	history := sess.History()
+	if len(history) > roastHistory {
+		history = history[len(history)-roastHistory:]
+	}
+	return history
+}
+
+// collectRoast forwards each piece to onRoast and returns the joined roast
+func collectRoast(pieces <-chan string, onRoast func(piece string)) string {
+	var b strings.Builder
+	for piece := range pieces {
+		b.WriteString(piece)
+		onRoast(piece)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// extractYentWords strips the style suffix, leaving yent's words for the
+// ASCII overlay
+func extractYentWords(prompt string) string {
 	yentWords := prompt
 	for _, sep := range []string{", oil painting", ", abstract ", ", dark symbolic",
 		", street art", ", surreal", ", Soviet poster", ", Picasso",
@@ -99,13 +376,37 @@ func (dy *DualYent) React(userInput string, maxTokens int, temperature float32)
 			yentWords = yentWords[:idx]
 		}
 	}
+	return yentWords
+}
 
-	return DualResult{
-		Prompt:    prompt,
-		YentWords: yentWords,
-		Roast:     roast,
-		ArtistID:  artistID,
+// roaster is a commentator that can only hand back a finished roast
+type roaster interface {
+	RoastSession(userInput string, history []string, maxTokens int, temperature float32) string
+}
+
+// roastStreamer is a commentator that yields the roast as it is generated
+type roastStreamer interface {
+	RoastSessionStream(userInput string, history []string, maxTokens int, temperature float32) <-chan string
+}
+
+// streamRoast yields r's roast piece by piece: live when r can stream,
+// otherwise the finished roast split into words. The channel closes after
+// the last piece.
+func streamRoast(r roaster, userInput string, history []string, maxTokens int, temperature float32) <-chan string {
+	if rs, ok := r.(roastStreamer); ok {
+		return rs.RoastSessionStream(userInput, history, maxTokens, temperature)
 	}
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for i, w := range strings.Fields(r.RoastSession(userInput, history, maxTokens, temperature)) {
+			if i > 0 {
+				w = " " + w
+			}
+			ch <- w
+		}
+	}()
+	return ch
 }
 
 // StreamCommentary prints the commentator's roast with typing effect
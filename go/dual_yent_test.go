@@ -0,0 +1,513 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"yentyo/yent"
+)
+
+// newParrotPG builds a one-layer F32 model that only ever says word: all
+// transformer weights are zero, so the LM head row for word dominates the
+// logits whatever the context. Small enough to hammer under -race.
+func newParrotPG(word string, seed int64) *PromptGenerator {
+	return newBabblePG(seed, word)
+}
+
+// newBabblePG is newParrotPG over several words, each as likely as the
+// next, so every draw picks one at random
+func newBabblePG(seed int64, words ...string) *PromptGenerator {
+	const dim, interm, seqLen = 8, 16, 512
+
+	vocab := []string{"<s>", "</s>"}
+	for _, w := range words {
+		vocab = append(vocab, "▁"+w)
+	}
+	for b := 0; b < 256; b++ {
+		vocab = append(vocab, fmt.Sprintf("<0x%02X>", b))
+	}
+	tok := yent.NewTokenizer(&yent.GGUFMetadata{
+		TokenList: vocab,
+		VocabSize: len(vocab),
+		BosID:     0,
+		EosID:     1,
+	})
+
+	f32 := func(vals []float32) []byte {
+		b := make([]byte, 4*len(vals))
+		for i, v := range vals {
+			binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+		}
+		return b
+	}
+	ones := func(n int) []float32 {
+		v := make([]float32, n)
+		for i := range v {
+			v[i] = 1
+		}
+		return v
+	}
+	zeros := func(rows, cols int) []byte { return make([]byte, 4*rows*cols) }
+
+	head := make([]float32, len(vocab)*dim) // only the word tokens get signal
+	for i := 2 * dim; i < (2+len(words))*dim; i++ {
+		head[i] = 10
+	}
+
+	cfg := yent.LlamaConfig{
+		NumLayers: 1, EmbedDim: dim, NumHeads: 2, NumKVHeads: 2, HeadDim: dim / 2,
+		VocabSize: len(vocab), SeqLen: seqLen, IntermSize: interm,
+		RMSNormEps: 1e-5, RopeTheta: 10000,
+	}
+	kvDim := cfg.NumKVHeads * cfg.HeadDim
+	model := &yent.LlamaModel{
+		Config: cfg,
+		Weights: yent.LlamaWeights{
+			TokenEmbed: f32(ones(len(vocab) * dim)),
+			OutputNorm: ones(dim),
+			Output:     f32(head),
+			Layers: []yent.LlamaLayerWeights{{
+				AttnNorm: ones(dim), FFNNorm: ones(dim),
+				WQ: zeros(dim, dim), WK: zeros(kvDim, dim), WV: zeros(kvDim, dim), WO: zeros(dim, dim),
+				WGate: zeros(interm, dim), WUp: zeros(interm, dim), WDown: zeros(dim, interm),
+			}},
+		},
+		State: yent.LlamaState{
+			X: make([]float32, dim), XB: make([]float32, dim), XB2: make([]float32, dim),
+			HB: make([]float32, interm), HB2: make([]float32, interm),
+			Q: make([]float32, dim), K: make([]float32, kvDim), V: make([]float32, kvDim),
+			Att:      make([]float32, cfg.NumHeads*seqLen),
+			Logits:   make([]float32, len(vocab)),
+			KeyCache: make([]float32, seqLen*kvDim), ValueCache: make([]float32, seqLen*kvDim),
+			CosCache: ones(seqLen * cfg.HeadDim / 2), SinCache: make([]float32, seqLen*cfg.HeadDim/2),
+			EmbBuf: make([]float32, dim),
+		},
+	}
+
+	return &PromptGenerator{
+		model:     model,
+		tokenizer: tok,
+		rng:       rand.New(rand.NewSource(seed)),
+		cloud:     make(map[string]float32),
+	}
+}
+
+// TestDualReactIndependent runs React over and over (artist and commentator
+// in parallel each time) while /cloud-style readers poll both clouds. Run
+// with -race: any state shared between A and B shows up as a data race.
+// Each model only knows its own word, so a swapped or mixed-up output is
+// visible in the text.
+func TestDualReactIndependent(t *testing.T) {
+	dy := &DualYent{
+		A:   newParrotPG("zyx", 1),
+		B:   newParrotPG("qwv", 2),
+		rng: rand.New(rand.NewSource(3)),
+	}
+	word := map[string]string{"A": "zyx", "B": "qwv"}
+	other := map[string]string{"A": "B", "B": "A"}
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					topCloudTerms([]*PromptGenerator{dy.A, dy.B}, 10)
+				}
+			}
+		}()
+	}
+
+	sess := &Session{}
+	for i := 0; i < 20; i++ {
+		var r DualResult
+		switch i % 3 {
+		case 0:
+			r = dy.React(fmt.Sprintf("input number %d", i), 8, 0.8)
+		case 1:
+			r = dy.ReactSession(fmt.Sprintf("session input %d", i), sess, 8, 0.8)
+		case 2:
+			var streamed strings.Builder
+			r = dy.ReactWith(fmt.Sprintf("streamed input %d", i), sess, 8, 0.8, ReactOptions{
+				Candidates: 2,
+				OnRoast:    func(p string) { streamed.WriteString(p) },
+			})
+			if strings.TrimSpace(streamed.String()) != r.Roast {
+				t.Fatalf("turn %d: streamed %q, roast %q", i, streamed.String(), r.Roast)
+			}
+		}
+		artist, commentator := word[r.ArtistID], word[other[r.ArtistID]]
+
+		if !strings.Contains(r.Prompt, artist) || strings.Contains(r.Prompt, commentator) {
+			t.Fatalf("turn %d: artist %s prompt %q should only carry %q", i, r.ArtistID, r.Prompt, artist)
+		}
+		if r.Roast == "" || strings.Trim(strings.ReplaceAll(r.Roast, commentator, ""), " ") != "" {
+			t.Fatalf("turn %d: roast %q should be all %q", i, r.Roast, commentator)
+		}
+	}
+	close(done)
+	readers.Wait()
+}
+
+func TestDualReactAwareOrder(t *testing.T) {
+	dy := &DualYent{
+		A:   newParrotPG("zyx", 1),
+		B:   newParrotPG("qwv", 2),
+		rng: rand.New(rand.NewSource(3)),
+	}
+
+	var events []string
+	r := dy.ReactAware("paint me a duck", nil, 8, 0.8, ReactOptions{
+		OnPrompt: func(prompt string) { events = append(events, "prompt:"+prompt) },
+		OnRoast:  func(piece string) { events = append(events, "roast") },
+	})
+
+	if len(events) < 2 {
+		t.Fatalf("events = %v, want a prompt then roast pieces", events)
+	}
+	if events[0] != "prompt:"+r.Prompt {
+		t.Errorf("first event = %q, want the finished prompt %q", events[0], r.Prompt)
+	}
+	for i, e := range events[1:] {
+		if e != "roast" {
+			t.Errorf("event %d = %q after the prompt, want only roast pieces", i+1, e)
+		}
+	}
+	artistWord := map[string]string{"A": "zyx", "B": "qwv"}[r.ArtistID]
+	if r.Roast == "" || !strings.Contains(r.Prompt, artistWord) {
+		t.Errorf("result = %+v, want artist %s's prompt and a roast", r, r.ArtistID)
+	}
+}
+
+func TestDualForcedArtist(t *testing.T) {
+	dy := seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 5)
+
+	for turn := 0; turn < 4; turn++ {
+		dy.turn = turn
+		r := dy.ReactWith("paint me a duck", nil, 8, 0.8, ReactOptions{Artist: ArtistA})
+		if r.ArtistID != ArtistA || !strings.Contains(r.Prompt, "zyx") {
+			t.Errorf("turn %d: artist %s prompt %q, want model A drawing", turn, r.ArtistID, r.Prompt)
+		}
+		if dy.turn != turn {
+			t.Errorf("forced turn advanced the alternation: %d → %d", turn, dy.turn)
+		}
+	}
+
+	dy.turn = 1
+	first := dy.React("paint me a duck", 8, 0.8).ArtistID
+	second := dy.ReactWith("paint me a duck", nil, 8, 0.8, ReactOptions{Artist: ArtistAuto}).ArtistID
+	if first == second {
+		t.Errorf("auto turns both drew with %s, want alternation", first)
+	}
+}
+
+func TestRoastContextAware(t *testing.T) {
+	ctx := roastContext("a duck", nil, "a duck in flames, oil painting")
+	drew := strings.Index(ctx, `Yent drew: "a duck in flames, oil painting"`)
+	said := strings.Index(ctx, `User said: "a duck"`)
+	if drew < 0 || said < 0 || drew < said {
+		t.Errorf("context %q should quote the user, then the artist's prompt", ctx)
+	}
+	if !strings.HasSuffix(ctx, "Yent (cynical, mocking): ") {
+		t.Errorf("context %q should end with the commentator cue", ctx)
+	}
+	if strings.Contains(roastContext("a duck", nil, ""), "drew") {
+		t.Error("non-aware context should not mention a drawing")
+	}
+}
+
+func TestReactBestOfNeverWorse(t *testing.T) {
+	inputs := []string{"paint me a duck", "i hate mondays", "the sea is calm tonight", "why"}
+	for seed := int64(1); seed <= 5; seed++ {
+		for _, in := range inputs {
+			single := newBabblePG(seed, "zyx", "duck", "sea", "calm")
+			best := newBabblePG(seed, "zyx", "duck", "sea", "calm")
+			single.ReactBestOf(in, nil, 6, 0.8, 1)
+			best.ReactBestOf(in, nil, 6, 0.8, 3)
+
+			// Scoring candidates must not feed boredom or the cloud
+			if single.boredomCount != best.boredomCount || len(single.cloud) != len(best.cloud) {
+				t.Errorf("seed %d %q: best-of-3 changed state: boredom %d vs %d, cloud %d vs %d",
+					seed, in, best.boredomCount, single.boredomCount, len(best.cloud), len(single.cloud))
+			}
+		}
+	}
+}
+
+func TestBestOfPicksTheMostDissonant(t *testing.T) {
+	// Scripted candidates: the echo comes first, the stranger last
+	pg := newTestPG()
+	script := []string{"paint me a duck", "paint me a duck in the sea", "a screaming lighthouse made of teeth"}
+	i := 0
+	got := pg.bestOf("paint me a duck", len(script), func() string { i++; return script[i-1] })
+	if got != script[2] {
+		t.Errorf("bestOf = %q, want %q", got, script[2])
+	}
+
+	// Real candidates from a model that babbles a different line each draw
+	in := "the sea is calm tonight"
+	for seed := int64(1); seed <= 5; seed++ {
+		pg := newBabblePG(seed, "zyx", "sea", "calm", "tonight", "duck")
+		var cands []string
+		got := pg.bestOf(in, 4, func() string {
+			c := pg.generatePrompt(in, 6, 1.2, 0.5, PulseSnapshot{})
+			cands = append(cands, c)
+			return c
+		})
+		distinct := map[string]bool{}
+		want, wantScore := "", float32(-1)
+		for _, c := range cands {
+			distinct[c] = true
+			if score := pg.scoreDissonance(c, in); score > wantScore {
+				want, wantScore = c, score
+			}
+		}
+		if len(distinct) < 2 {
+			t.Fatalf("seed %d: all %d candidates are %q; the test can't tell them apart", seed, len(cands), cands[0])
+		}
+		if got != want {
+			t.Errorf("seed %d: bestOf = %q (d=%.3f), want the top candidate %q (d=%.3f)",
+				seed, got, pg.scoreDissonance(got, in), want, wantScore)
+		}
+	}
+}
+
+func TestSeededDualYentReplays(t *testing.T) {
+	inputs := []string{"hello", "i hate mondays", "paint me a duck", "hello", "the sea", "why"}
+	run := func(modelSeed int64) []DualResult {
+		// Generators start from different RNGs; the ensemble seed overrides them
+		dy := seedDualYent(newParrotPG("zyx", modelSeed), newParrotPG("qwv", modelSeed+1), 42)
+		var out []DualResult
+		for _, in := range inputs {
+			out = append(out, dy.React(in, 6, 1.2))
+		}
+		return out
+	}
+
+	first, second := run(1), run(99)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("turn %d differs:\n  %+v\n  %+v", i, first[i], second[i])
+		}
+	}
+
+	other := seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 7)
+	diverged := false
+	for i, in := range inputs {
+		if other.React(in, 6, 1.2) != first[i] {
+			diverged = true
+		}
+	}
+	if !diverged {
+		t.Error("a different seed replayed the exact same reactions")
+	}
+}
+
+func TestReactSeededReplays(t *testing.T) {
+	inputs := []string{"hello", "i hate my cat", "paint me a duck", "the sea"}
+	for _, in := range inputs {
+		// Fresh generators with different RNGs; the call's seed overrides them
+		a, b := newParrotPG("zyx", 1), newParrotPG("zyx", 2)
+		if pa, pb := a.ReactSeeded(in, 6, 1.2, 42), b.ReactSeeded(in, 6, 1.2, 42); pa != pb {
+			t.Errorf("%q with seed 42:\n  %q\n  %q", in, pa, pb)
+		}
+	}
+
+	// The seeded call leaves the generator's own stream untouched
+	a, b := newParrotPG("zyx", 5), newParrotPG("zyx", 5)
+	a.ReactSeeded("hello", 6, 1.2, 42)
+	if a.rng.Int63() != b.rng.Int63() {
+		t.Error("ReactSeeded advanced the generator's own rng")
+	}
+
+	// Seed a whole turn through /react
+	react := func() ReactResponse {
+		srv := newTestServer()
+		srv.textOnly = true
+		srv.dy = seedDualYent(newParrotPG("zyx", time.Now().UnixNano()), newParrotPG("qwv", time.Now().UnixNano()+1), time.Now().UnixNano())
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"i hate my cat","artist":"A","text_seed":7}`)))
+		var resp ReactResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("status %d: %v", w.Code, err)
+		}
+		return resp
+	}
+	if r1, r2 := react(), react(); r1.Prompt != r2.Prompt || r1.Roast != r2.Roast {
+		t.Errorf("text_seed 7 twice:\n  %q / %q\n  %q / %q", r1.Prompt, r1.Roast, r2.Prompt, r2.Roast)
+	}
+}
+
+func TestReactSeededReplaysOnOneServer(t *testing.T) {
+	// The same generator twice: the first call must not change what the
+	// second one sees
+	pg := newParrotPG("zyx", 1)
+	first := pg.ReactSeeded("i hate my cat", 6, 1.2, 42)
+	if again := pg.ReactSeeded("i hate my cat", 6, 1.2, 42); again != first {
+		t.Errorf("seed 42 twice on one generator:\n  %q\n  %q", first, again)
+	}
+	if len(pg.recent) != 0 || pg.boredomCount != 0 || len(pg.cloud) != 0 {
+		t.Error("ReactSeeded fed the generator's memory")
+	}
+
+	// And through /react, letting the seed pick the artist
+	srv := newTestServer()
+	srv.textOnly = true
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	var responses []ReactResponse
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"i hate my cat","text_seed":7}`)))
+		var resp ReactResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("status %d: %v", w.Code, err)
+		}
+		responses = append(responses, resp)
+	}
+	for _, r := range responses[1:] {
+		r0 := responses[0]
+		if r.Prompt != r0.Prompt || r.Roast != r0.Roast || r.ArtistID != r0.ArtistID || r.Dissonance != r0.Dissonance {
+			t.Errorf("text_seed 7 again on one server:\n  %s %q / %q d=%.2f\n  %s %q / %q d=%.2f",
+				r0.ArtistID, r0.Prompt, r0.Roast, r0.Dissonance, r.ArtistID, r.Prompt, r.Roast, r.Dissonance)
+		}
+	}
+}
+
+func TestDualReactBlankInput(t *testing.T) {
+	dy := seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	for _, in := range []string{"   ", "\t\n"} {
+		r := dy.React(in, 8, 0.8)
+		if r.Prompt == "" || r.Roast == "" {
+			t.Errorf("React(%q) = prompt %q, roast %q, want both", in, r.Prompt, r.Roast)
+		}
+		PostProcessSeeded(makeTestImage(32, 32), r.YentWords, 1)
+	}
+}
+
+func TestRoastLengthPerRequest(t *testing.T) {
+	srv := newTestServer()
+	srv.textOnly = true
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+
+	roastWords := func(body string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+		var resp ReactResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: status %d: %v", body, w.Code, err)
+		}
+		return len(strings.Fields(resp.Roast))
+	}
+	// Forcing the artist keeps the same commentator for both calls
+	long := roastWords(`{"input":"paint me a duck","artist":"A"}`)
+	short := roastWords(`{"input":"paint me a duck","artist":"A","roast_max_tokens":3,"roast_temp_offset":0}`)
+	if short == 0 || short > 3 || short >= long {
+		t.Errorf("roast_max_tokens 3 gave %d words, the default %d; want 1..3 and fewer", short, long)
+	}
+
+	for _, body := range []string{
+		`{"input":"x","roast_max_tokens":-1}`,
+		`{"input":"x","roast_max_tokens":100000}`,
+		`{"input":"x","roast_temp_offset":5}`,
+	} {
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+		if w.Code != 400 {
+			t.Errorf("%s: status %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestRoastSampling(t *testing.T) {
+	if n, temp := (ReactOptions{}).roastSampling(0.8); n != defaultRoastMaxTokens || math.Abs(float64(temp)-1.0) > 1e-6 {
+		t.Errorf("defaults = %d tokens at %.2f, want %d at 1.0", n, temp, defaultRoastMaxTokens)
+	}
+	cold := float32(-1)
+	if _, temp := (ReactOptions{RoastTempOffset: &cold}).roastSampling(0.5); temp != minRoastTemperature {
+		t.Errorf("offset -1 from 0.5 gave temperature %.2f, want the %.2f floor", temp, float32(minRoastTemperature))
+	}
+}
+
+func TestUseSampling(t *testing.T) {
+	a, b := newParrotPG("zyx", 1), newParrotPG("qwv", 2)
+	a.Sampling = Sampling{TopK: 5, RepeatPenalty: 1.3}
+	restore := ReactOptions{Sampling: &Sampling{TopP: 0.5}}.useSampling(a, b)
+	if a.Sampling != (Sampling{TopK: 5, TopP: 0.5, RepeatPenalty: 1.3}) || b.Sampling != (Sampling{TopP: 0.5}) {
+		t.Errorf("during the turn: %+v, %+v, want top_p on top of the models' own", a.Sampling, b.Sampling)
+	}
+	restore()
+	if a.Sampling != (Sampling{TopK: 5, RepeatPenalty: 1.3}) || b.Sampling != (Sampling{}) {
+		t.Errorf("after the turn: %+v, %+v, want the models' own back", a.Sampling, b.Sampling)
+	}
+
+	var req ReactRequest
+	if req.sampling() != nil {
+		t.Error("a request without top_k/top_p overrides the models' sampling")
+	}
+	srv := newTestServer()
+	srv.textOnly = true
+	srv.dy = seedDualYent(a, b, 1)
+	for body, want := range map[string]int{
+		`{"input":"x","top_k":1,"top_p":0.9}`: 200,
+		`{"input":"x","top_k":-1}`:            400,
+		`{"input":"x","top_k":100000}`:        400,
+		`{"input":"x","top_p":1.5}`:           400,
+		`{"input":"x","repeat_penalty":1.2}`:  200,
+		`{"input":"x","repeat_penalty":0.5}`:  400,
+		`{"input":"x","repeat_penalty":10}`:   400,
+	} {
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", body, w.Code, want)
+		}
+	}
+	if a.Sampling != (Sampling{TopK: 5, RepeatPenalty: 1.3}) {
+		t.Errorf("a request left its sampling behind: %+v", a.Sampling)
+	}
+}
+
+func TestNextTurnConcurrent(t *testing.T) {
+	dy := seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 9)
+
+	const callers, turns = 8, 50
+	var mu sync.Mutex
+	artists := map[string]int{}
+	var wg sync.WaitGroup
+	for c := 0; c < callers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < turns; i++ {
+				_, _, id := dy.nextTurn("", ArtistAuto)
+				mu.Lock()
+				artists[id]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every turn advances the alternation exactly once, so the split is even
+	if artists[ArtistA] != callers*turns/2 || artists[ArtistB] != callers*turns/2 {
+		t.Errorf("artists over %d concurrent turns = %v, want an even split", callers*turns, artists)
+	}
+	dy.resetTurn()
+	if dy.turn != 0 {
+		t.Errorf("turn = %d after resetTurn", dy.turn)
+	}
+}
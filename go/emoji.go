@@ -0,0 +1,44 @@
+package main
+
+// emoji.go — emoji as words
+//
+// textpulse.SplitWords makes every emoji a word of its own, so the
+// arousal lexicon and the cloud see them; emojiAffect gives the common
+// ones an arousal and a valence.
+
+// emojiTone is the affect of one emoji: arousal ∈ [0, 1], valence ∈ [-1, 1]
+type emojiTone struct {
+	arousal float32
+	valence float32
+}
+
+// emojiAffect covers the emoji people actually send; any other emoji still
+// counts as a word for novelty, boredom and the cloud
+var emojiAffect = map[rune]emojiTone{
+	'😭': {1.0, -0.8}, '😡': {1.0, -0.9}, '🤬': {1.0, -1.0}, '😱': {1.0, -0.6},
+	'💀': {0.8, -0.3}, '😤': {0.8, -0.6}, '😢': {0.6, -0.7}, '💔': {0.7, -0.9},
+	'😍': {0.8, 0.9}, '🥰': {0.6, 0.9}, '❤': {0.6, 0.8}, '😂': {0.8, 0.6},
+	'🤣': {0.9, 0.6}, '🔥': {0.9, 0.4}, '💥': {0.9, 0.0}, '⚡': {0.8, 0.1},
+	'😐': {0.1, -0.1}, '😴': {0.0, 0.0}, '🙂': {0.2, 0.4}, '🫠': {0.4, -0.3},
+}
+
+// emojiPulse sums the arousal of the known emoji among words and averages
+// their valence (0 when there are none)
+func emojiPulse(words []string) (arousal, valence float32) {
+	n := 0
+	for _, w := range words {
+		r := []rune(w)
+		if len(r) != 1 {
+			continue
+		}
+		if tone, ok := emojiAffect[r[0]]; ok {
+			arousal += tone.arousal
+			valence += tone.valence
+			n++
+		}
+	}
+	if n > 0 {
+		valence /= float32(n)
+	}
+	return arousal, valence
+}
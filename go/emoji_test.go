@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestEmojiArousal(t *testing.T) {
+	_, pulse := newTestPG().computeDissonance("😭😭😭")
+	if pulse.Arousal <= 0 {
+		t.Errorf("arousal for 😭😭😭 = %.3f, want > 0", pulse.Arousal)
+	}
+	if pulse.Valence >= 0 {
+		t.Errorf("valence for 😭😭😭 = %.3f, want negative", pulse.Valence)
+	}
+	if _, happy := newTestPG().computeDissonance("😍"); happy.Valence <= 0 {
+		t.Errorf("valence for 😍 = %.3f, want positive", happy.Valence)
+	}
+}
+
+func TestEmojiBoredomAndCloud(t *testing.T) {
+	pg := newTestPG()
+	for i := 0; i < 4; i++ {
+		pg.computeDissonance("🔥")
+	}
+	if pg.boredomCount < 2 {
+		t.Errorf("boredom after repeating 🔥 = %d, want >= 2", pg.boredomCount)
+	}
+	if pg.CloudSnapshot()["🔥"] == 0 {
+		t.Error("🔥 never made it into the cloud")
+	}
+
+	// An emoji the cloud has seen is no longer novel
+	fresh := newTestPG()
+	_, first := fresh.computeDissonance("duck 💀")
+	fresh.computeDissonance("💀 💀 💀")
+	_, again := fresh.computeDissonance("goose 💀")
+	if again.Novelty >= first.Novelty {
+		t.Errorf("novelty of a seen emoji: %.2f then %.2f, want it to drop", first.Novelty, again.Novelty)
+	}
+}
@@ -2,7 +2,6 @@ module yentyo
 
 go 1.24.0
 
-require (
-	github.com/yalue/onnxruntime_go v1.26.0 // indirect
-	golang.org/x/image v0.36.0 // indirect
-)
+require golang.org/x/image v0.36.0
+
+require github.com/yalue/onnxruntime_go v1.26.0 // indirect
@@ -0,0 +1,35 @@
+package main
+
+// guidance.go — classifier-free guidance
+//
+// CFG extrapolates from the unconditional noise prediction toward the
+// conditional one. Past a guidance scale of ~7 the extrapolation inflates
+// the prediction's std and the decoded image blows out; the CFG-rescale of
+// Lin et al. ("Common Diffusion Noise Schedules and Sample Steps are
+// Flawed") pulls it back toward the conditional prediction's std.
+
+// guidanceRescale is the CFG-rescale factor φ (--guidance-rescale): 0 is
+// plain CFG, 1 fully matches the guided prediction's std to the cond one's
+var guidanceRescale float32
+
+// combineGuidance returns uncond + scale·(cond − uncond), rescaled by
+// rescale ∈ [0, 1] of the way from its own std to cond's. Both prediction
+// backends (pure Go and ORT) guide through here.
+func combineGuidance(uncond, cond []float32, scale, rescale float32) []float32 {
+	out := make([]float32, len(uncond))
+	for i := range out {
+		out[i] = uncond[i] + scale*(cond[i]-uncond[i])
+	}
+	if rescale <= 0 {
+		return out
+	}
+	stdOut, stdCond := stdDev(out), stdDev(cond)
+	if stdOut == 0 {
+		return out
+	}
+	f := rescale*stdCond/stdOut + (1 - rescale)
+	for i := range out {
+		out[i] *= f
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCombineGuidance(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	uncond, cond := make([]float32, 512), make([]float32, 512)
+	for i := range uncond {
+		uncond[i] = float32(rng.NormFloat64())
+		cond[i] = uncond[i] + 0.3*float32(rng.NormFloat64())
+	}
+	const scale = 12
+
+	plain := combineGuidance(uncond, cond, scale, 0)
+	for i, v := range plain {
+		if want := uncond[i] + scale*(cond[i]-uncond[i]); v != want {
+			t.Fatalf("rescale 0: [%d] = %v, want plain CFG %v", i, v, want)
+		}
+	}
+
+	prev := stdDev(plain)
+	for _, r := range []float32{0.3, 0.7, 1} {
+		got := stdDev(combineGuidance(uncond, cond, scale, r))
+		if got >= prev {
+			t.Errorf("rescale %.1f: std %.3f, want below %.3f", r, got, prev)
+		}
+		prev = got
+	}
+	if got, want := stdDev(combineGuidance(uncond, cond, scale, 1)), stdDev(cond); got-want > 1e-4 || want-got > 1e-4 {
+		t.Errorf("rescale 1: std %.4f, want cond's %.4f", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+// imagestore.go — where generated images live between /react and /image/
+//
+// MemoryImageStore (the default) forgets everything on restart.
+// DiskImageStore (--image-dir) writes each image to <dir>/<id>.png (or
+// .jpg) and reads it back on request, so a gallery survives restarts and
+// can be pointed at by a fresh server.
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ImageStore keeps encoded images by id. Ids are validImageID tokens.
+// Implementations must be safe for concurrent use.
+type ImageStore interface {
+	Put(id string, data []byte) error
+	Get(id string) ([]byte, bool)
+	Len() int // images held (the cached_images gauge)
+	Clear()   // drop what is held in memory (Server.Close)
+}
+
+// MemoryImageStore holds images in a map
+type MemoryImageStore struct {
+	mu     sync.RWMutex
+	images map[string][]byte
+}
+
+func NewMemoryImageStore() *MemoryImageStore {
+	return &MemoryImageStore{images: make(map[string][]byte)}
+}
+
+func (m *MemoryImageStore) Put(id string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.images[id] = data
+	return nil
+}
+
+func (m *MemoryImageStore) Get(id string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.images[id]
+	return data, ok
+}
+
+func (m *MemoryImageStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.images)
+}
+
+func (m *MemoryImageStore) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.images = make(map[string][]byte)
+}
+
+// DiskImageStore keeps one file per image under dir. Nothing is loaded at
+// startup; Get reads the file when it is asked for.
+type DiskImageStore struct {
+	dir string
+
+	// compression, when set and not pngCompression, is the zlib level PNGs
+	// are re-encoded at before they are written (--image-dir-compression),
+	// so the archive can be small while /react encodes fast
+	compression *png.CompressionLevel
+}
+
+// NewDiskImageStore uses dir, creating it if needed
+func NewDiskImageStore(dir string) (*DiskImageStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("image dir: %w", err)
+	}
+	return &DiskImageStore{dir: dir}, nil
+}
+
+// diskImageExts are the extensions Put writes, by content type
+var diskImageExts = map[string]string{"image/png": ".png", "image/jpeg": ".jpg"}
+
+// Put writes data to <dir>/<id>.<ext> with writeFileAtomic, so a crash
+// never leaves a half-written image behind
+func (d *DiskImageStore) Put(id string, data []byte) error {
+	if !validImageID(id) {
+		return fmt.Errorf("bad image id %q", id)
+	}
+	ext, ok := diskImageExts[imageContentType(data)]
+	if !ok {
+		ext = ".png"
+	}
+	return writeFileAtomic(filepath.Join(d.dir, id+ext), func(w io.Writer) error {
+		if ext == ".png" && d.compression != nil && *d.compression != pngCompression {
+			return recompressPNG(w, data, *d.compression)
+		}
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// recompressPNG writes data, a PNG, re-encoded at level with its text
+// chunks kept. Data that doesn't decode is written as it is.
+func recompressPNG(w io.Writer, data []byte, level png.CompressionLevel) error {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		_, err := w.Write(data)
+		return err
+	}
+	meta, _ := parsePNGText(data)
+	return encodePNGLevel(w, img, meta, level)
+}
+
+// writeFileAtomic has write fill a temp file next to path, syncs it and
+// renames it over path. A failed write, a full disk or a kill part way
+// through leaves whatever was at path before (or nothing), never half a
+// file; the temp file is removed on error. The file ends up 0644 like
+// one from os.Create under the usual umask, not CreateTemp's 0600.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (d *DiskImageStore) Get(id string) ([]byte, bool) {
+	if !validImageID(id) {
+		return nil, false
+	}
+	for _, ext := range []string{".png", ".jpg"} {
+		if data, err := os.ReadFile(filepath.Join(d.dir, id+ext)); err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// Len counts the image files in dir
+func (d *DiskImageStore) Len() int {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && !strings.HasPrefix(name, ".") &&
+			(strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".jpg")) {
+			n++
+		}
+	}
+	return n
+}
+
+// Clear is a no-op: the files are the point, and nothing is held in memory
+func (d *DiskImageStore) Clear() {}
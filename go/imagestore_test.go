@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiskImageStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskImageStore(filepath.Join(dir, "gallery"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	png := []byte("\x89PNG fake")
+	jpg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	if err := store.Put("1700000000-1", png); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("1700000000-2", jpg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := store.Get("1700000000-1"); !ok || !bytes.Equal(got, png) {
+		t.Errorf("Get png = %q, %v", got, ok)
+	}
+	if got, ok := store.Get("1700000000-2"); !ok || !bytes.Equal(got, jpg) {
+		t.Errorf("Get jpeg = % x, %v", got, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gallery", "1700000000-2.jpg")); err != nil {
+		t.Errorf("jpeg not written with .jpg: %v", err)
+	}
+	if _, ok := store.Get("missing"); ok {
+		t.Error("Get of a missing id succeeded")
+	}
+	if n := store.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+	store.Clear()
+	if _, ok := store.Get("1700000000-1"); !ok {
+		t.Error("Clear deleted an image from disk")
+	}
+}
+
+func TestDiskImageStoreRecompresses(t *testing.T) {
+	defer func(level png.CompressionLevel) { pngCompression = level }(pngCompression)
+	pngCompression = png.NoCompression
+
+	// A smooth gradient, so the levels differ in size
+	gradient, _ := stubBackend{}.Generate(context.Background(), "", "", GenOpts{Seed: 7, LatentSize: 8})
+	var served bytes.Buffer
+	encodePNG(&served, gradient, map[string]string{"prompt": "утка", "seed": "7"})
+
+	store, err := NewDiskImageStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := png.BestCompression
+	store.compression = &best
+	if err := store.Put("1700000000-1", served.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	archived, _ := store.Get("1700000000-1")
+	if len(archived) >= served.Len() {
+		t.Errorf("archived %d bytes, served %d; want the archive smaller", len(archived), served.Len())
+	}
+	if meta, err := parsePNGText(archived); err != nil || meta["prompt"] != "утка" || meta["seed"] != "7" {
+		t.Errorf("archived metadata = %v (%v)", meta, err)
+	}
+	want, _ := png.Decode(bytes.NewReader(served.Bytes()))
+	if got, err := png.Decode(bytes.NewReader(archived)); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("re-encoding changed the pixels (%v)", err)
+	}
+
+	// Served at the archive level already: stored byte for byte
+	pngCompression = png.BestCompression
+	store.Put("1700000000-2", served.Bytes())
+	if same, _ := store.Get("1700000000-2"); !bytes.Equal(same, served.Bytes()) {
+		t.Error("a PNG served at the archive level was re-encoded")
+	}
+}
+
+func TestDiskImageStoreRejectsBadIDs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskImageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"", "../escape", "a/b", "x.png"} {
+		if err := store.Put(id, []byte{0x89}); err == nil {
+			t.Errorf("Put(%q) succeeded", id)
+		}
+		if _, ok := store.Get(id); ok {
+			t.Errorf("Get(%q) succeeded", id)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("bad ids left %d files behind", len(entries))
+	}
+}
+
+func TestDiskImageStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestServer()
+	store, err := NewDiskImageStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.images = store
+	data := []byte("\x89PNG persisted")
+	id, err := first.storeImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh server with nothing in memory, pointed at the same dir
+	second := newTestServer()
+	if second.images, err = NewDiskImageStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	second.handleImage(w, httptest.NewRequest("GET", "/image/"+id, nil))
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("body = %q, want %q", w.Body.Bytes(), data)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("content-type = %q, want image/png", ct)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.png")
+	if err := os.WriteFile(path, []byte("old image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that dies half way: the old file stays, no temp file remains
+	boom := errors.New("disk full")
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		w.Write([]byte("half a n"))
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want the write's error", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old image" {
+		t.Errorf("after a failed write the file holds %q, want the old image", data)
+	}
+
+	// The PNG encoder failing (a 0x0 image) leaves no file at all
+	fresh := filepath.Join(dir, "fresh.png")
+	if err := saveProcessedPNG(image.NewRGBA(image.Rect(0, 0, 0, 0)), fresh, nil); err == nil {
+		t.Error("saving a 0x0 image succeeded")
+	}
+	if _, err := os.Stat(fresh); !os.IsNotExist(err) {
+		t.Errorf("a failed save left %s behind (%v)", fresh, err)
+	}
+
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("new image"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new image" {
+		t.Errorf("file holds %q, want the new image", data)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %v, want 0644 so the image server can read it", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("dir holds %v, want only out.png", names)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+// img2img.go — denoise from an uploaded image instead of pure noise
+//
+// The init image is encoded into latent space by the VAE encoder, pushed
+// forward to an intermediate timestep with scheduler noise, then denoised
+// over the remaining steps. strength=1 discards the image (plain text2img),
+// strength=0 runs no steps and hands back the VAE round-trip of the input.
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"runtime"
+	"time"
+)
+
+// vaeCodec is the encode/decode pair img2img needs. Satisfied by vaePair;
+// tests substitute a stub.
+type vaeCodec interface {
+	Encode(img *Tensor) *Tensor
+	Decode(latent *Tensor) *Tensor
+}
+
+// vaePair joins the separately loaded encoder and decoder halves
+type vaePair struct {
+	*VAEEncoder
+	*VAEDecoder
+}
+
+// img2img runs the img2img schedule on already-loaded models.
+// initImg is [1,3,H,W] in [-1,1]; returns the decoded image in the same range.
+func img2img(ctx context.Context, vae vaeCodec, predict noisePredictor, initImg *Tensor, strength float32, seed int64, numSteps int, progress func(step, total int)) (*Tensor, error) {
+	if strength < 0 {
+		strength = 0
+	}
+	if strength > 1 {
+		strength = 1
+	}
+
+	initLatent := Scale(vae.Encode(initImg), 0.18215)
+
+	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+	timesteps := sched.SetTimesteps(numSteps)
+
+	shape := initLatent.Shape
+	noise := randomLatent(shape[0], shape[1], shape[2], shape[3], seed)
+
+	var latent *Tensor
+	if strength >= 1 {
+		// Full strength: start from the same pure noise text2img uses
+		latent = noise
+	} else {
+		initSteps := int(float32(numSteps) * strength)
+		timesteps = timesteps[numSteps-initSteps:]
+		if len(timesteps) == 0 {
+			latent = initLatent
+		} else {
+			latent = sched.AddNoise(initLatent, noise, timesteps[0])
+		}
+	}
+
+	latent, err := denoise(ctx, sched, latent, timesteps, predict, progress)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLatent(vae, Scale(latent, float32(1.0/0.18215))), nil
+}
+
+// runImg2Img generates an image from prompt, starting from init (a
+// variable so server tests can skip loading the models).
+var runImg2Img = runImg2ImgPureGo
+
+// runImg2ImgPureGo is runImg2Img on the pure Go pipeline.
+// init is resized to 512×512 (latent 64×64) before encoding.
+func runImg2ImgPureGo(ctx context.Context, modelDir, prompt string, init *image.RGBA, strength float32, seed int64, steps int) (*image.RGBA, error) {
+	plog := pipelineOut(ctx)
+	const latentSize = 64
+	const guidanceScale = float32(7.5)
+
+	fmt.Fprintf(plog, "Img2img: prompt=%q strength=%.2f seed=%d steps=%d\n", prompt, strength, seed, steps)
+	start := time.Now()
+
+	tokenizer, err := LoadTokenizer(modelDir + "/tokenizer")
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: %w", err)
+	}
+	clipST, err := OpenSafeTensors(modelDir + "/text_encoder/model.fp16.safetensors")
+	if err != nil {
+		return nil, fmt.Errorf("clip load: %w", err)
+	}
+	clipModel, err := LoadCLIP(clipST)
+	if err != nil {
+		return nil, fmt.Errorf("clip parse: %w", err)
+	}
+	condEmb := clipModel.Encode(tokenizer.Encode(prompt))
+	uncondEmb := clipModel.Encode(tokenizer.Encode(""))
+	clipModel = nil
+	clipST = nil
+	runtime.GC()
+
+	unetST, err := OpenSafeTensors(modelDir + "/unet/diffusion_pytorch_model.fp16.safetensors")
+	if err != nil {
+		return nil, fmt.Errorf("unet load: %w", err)
+	}
+	unet, err := LoadUNet(unetST)
+	if err != nil {
+		return nil, fmt.Errorf("unet parse: %w", err)
+	}
+	unetST = nil
+
+	vaeST, err := OpenSafeTensors(modelDir + "/vae/diffusion_pytorch_model.fp16.safetensors")
+	if err != nil {
+		return nil, fmt.Errorf("vae load: %w", err)
+	}
+	enc, err := LoadVAEEncoder(vaeST)
+	if err != nil {
+		return nil, fmt.Errorf("vae encoder: %w", err)
+	}
+	dec, err := LoadVAEDecoder(vaeST)
+	if err != nil {
+		return nil, fmt.Errorf("vae decoder: %w", err)
+	}
+	vaeST = nil
+	runtime.GC()
+	fmt.Fprintf(plog, "Models loaded (%v)\n", time.Since(start))
+
+	size := latentSize * 8
+	initImg := rgbaToTensor(resizeRGBA(init, size, size))
+
+	out, err := img2img(ctx, vaePair{enc, dec}, guidedPredictor(unet, condEmb, uncondEmb, guidanceScale),
+		initImg, strength, seed, steps, nil)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(plog, "Img2img: %.1fs total\n", time.Since(start).Seconds())
+
+	return tensorToRGBA(out), nil
+}
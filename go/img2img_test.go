@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// stubVAE maps RGB straight into the first three latent channels (no
+// downsampling), so a round trip is the identity.
+type stubVAE struct{}
+
+func (stubVAE) Encode(img *Tensor) *Tensor {
+	H, W := img.Shape[2], img.Shape[3]
+	out := NewTensor(1, 4, H, W)
+	copy(out.Data, img.Data[:3*H*W])
+	return out
+}
+
+func (stubVAE) Decode(latent *Tensor) *Tensor {
+	H, W := latent.Shape[2], latent.Shape[3]
+	out := NewTensor(1, 3, H, W)
+	copy(out.Data, latent.Data[:3*H*W])
+	return out
+}
+
+func stubPredictor(calls *int) noisePredictor {
+	return func(latent *Tensor, t int) *Tensor {
+		*calls++
+		return Scale(latent, 0.1)
+	}
+}
+
+func testInitImage() *Tensor {
+	img := NewTensor(1, 3, 4, 4)
+	for i := range img.Data {
+		img.Data[i] = float32(i%7)/3 - 1
+	}
+	return img
+}
+
+func maxAbsDiff(a, b *Tensor) float64 {
+	d := 0.0
+	for i := range a.Data {
+		d = math.Max(d, math.Abs(float64(a.Data[i]-b.Data[i])))
+	}
+	return d
+}
+
+func TestImg2ImgStrengthZeroReturnsInput(t *testing.T) {
+	init := testInitImage()
+	calls := 0
+	out, _ := img2img(context.Background(), stubVAE{}, stubPredictor(&calls), init, 0, 42, 10, nil)
+
+	if calls != 0 {
+		t.Errorf("strength 0 ran %d denoise steps, want 0", calls)
+	}
+	if d := maxAbsDiff(out, init); d > 1e-5 {
+		t.Errorf("strength 0 output differs from input by %g", d)
+	}
+}
+
+func TestImg2ImgStrengthOneIsText2Img(t *testing.T) {
+	init := testInitImage()
+	calls := 0
+	out, _ := img2img(context.Background(), stubVAE{}, stubPredictor(&calls), init, 1, 42, 10, nil)
+
+	// Reference: the text2img path — pure noise, all timesteps
+	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+	timesteps := sched.SetTimesteps(10)
+	refCalls := 0
+	latent, _ := denoise(context.Background(), sched, randomLatent(1, 4, 4, 4, 42), timesteps, stubPredictor(&refCalls), nil)
+	want := stubVAE{}.Decode(Scale(latent, float32(1.0/0.18215)))
+
+	if calls != 10 {
+		t.Errorf("strength 1 ran %d steps, want 10", calls)
+	}
+	if d := maxAbsDiff(out, want); d > 1e-5 {
+		t.Errorf("strength 1 differs from text2img by %g", d)
+	}
+}
+
+func TestImg2ImgPartialStrength(t *testing.T) {
+	calls := 0
+	img2img(context.Background(), stubVAE{}, stubPredictor(&calls), testInitImage(), 0.5, 42, 10, nil)
+	if calls != 5 {
+		t.Errorf("strength 0.5 of 10 steps ran %d steps, want 5", calls)
+	}
+}
+
+func TestDenoiseProgress(t *testing.T) {
+	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+	timesteps := sched.SetTimesteps(10)
+
+	var steps []int
+	calls := 0
+	denoise(context.Background(), sched, randomLatent(1, 4, 2, 2, 1), timesteps, stubPredictor(&calls), func(step, total int) {
+		if total != 10 {
+			t.Errorf("total = %d, want 10", total)
+		}
+		steps = append(steps, step)
+	})
+
+	if len(steps) != 10 {
+		t.Fatalf("progress called %d times, want 10", len(steps))
+	}
+	for i, s := range steps {
+		if s != i+1 {
+			t.Errorf("progress call %d reported step %d, want %d", i, s, i+1)
+		}
+	}
+}
+
+func TestDenoiseCancel(t *testing.T) {
+	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+	timesteps := sched.SetTimesteps(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	_, err := denoise(ctx, sched, randomLatent(1, 4, 2, 2, 1), timesteps, stubPredictor(&calls), func(step, total int) {
+		if step == 1 {
+			cancel()
+		}
+	})
+
+	if err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Errorf("ran %d steps after cancel at step 1, want 1", calls)
+	}
+}
+
+func TestAddNoiseEndpoints(t *testing.T) {
+	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+	x := testInitImage()
+	noise := randomLatent(1, 3, 4, 4, 1)
+
+	// Near t=0 almost nothing changes; near t=T the noise dominates
+	early := sched.AddNoise(x, noise, 0)
+	if d := maxAbsDiff(early, x); d > 0.1 {
+		t.Errorf("AddNoise at t=0 moved sample by %g", d)
+	}
+	late := sched.AddNoise(x, noise, 999)
+	if maxAbsDiff(late, noise) > maxAbsDiff(late, x) {
+		t.Error("AddNoise at t=999 should be closer to noise than to the sample")
+	}
+}
+
+func TestPadBottomRight(t *testing.T) {
+	x := TensorFrom([]float32{1, 2, 3, 4}, []int{1, 1, 2, 2})
+	out := padBottomRight(x)
+	want := []float32{1, 2, 0, 3, 4, 0, 0, 0, 0}
+	if out.Shape[2] != 3 || out.Shape[3] != 3 {
+		t.Fatalf("shape = %v, want [1 1 3 3]", out.Shape)
+	}
+	for i, v := range want {
+		if out.Data[i] != v {
+			t.Errorf("data[%d] = %v, want %v", i, out.Data[i], v)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+// lang.go — which language the input is in, as far as the starters care
+//
+// No dictionary, no n-gram model: the script of the letters is enough to
+// tell Russian from English, the only two the reaction templates speak.
+// Emoji, digits and punctuation don't vote; other scripts count against
+// both, so CJK or Greek input lands on the English default.
+
+import "unicode"
+
+// Languages detectLanguage can tell apart
+const (
+	langEnglish = "en"
+	langRussian = "ru"
+)
+
+// detectLanguage returns langRussian when at least two thirds of s's
+// letters are Cyrillic, and langEnglish otherwise (including no letters)
+func detectLanguage(s string) string {
+	var letters, cyrillic int
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Cyrillic, r) {
+			cyrillic++
+		}
+	}
+	if letters > 0 && 3*cyrillic >= 2*letters {
+		return langRussian
+	}
+	return langEnglish
+}
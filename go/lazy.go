@@ -0,0 +1,60 @@
+package main
+
+// lazy.go — --lazy: load the yents on first use
+//
+// Both models cost ~160MB and a few seconds at boot, which a text-only
+// deployment or a health probe never needs. With --lazy, startServer hands
+// the Server a loader instead of a DualYent; the first request that needs
+// the models runs it (once, under s.mu) and /health reports models_loaded.
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// models returns the dual yent, loading it first in lazy mode. A failed
+// load is not retried. Safe without s.mu: the load runs once, and every
+// caller waits for it.
+func (s *Server) models() (*DualYent, error) {
+	if s.loadModels == nil {
+		return s.dy, nil
+	}
+	s.modelsOnce.Do(func() {
+		fmt.Fprintf(os.Stderr, "[server] loading dual yent on first use...\n")
+		dy, err := s.loadModels()
+		if err != nil {
+			s.modelsErr = err
+			s.modelsFailed.Store(true)
+			fmt.Fprintf(os.Stderr, "[server] dual yent: %v\n", err)
+			return
+		}
+		s.dy = dy
+		s.modelsLoaded.Store(true)
+	})
+	return s.dy, s.modelsErr
+}
+
+// loadedModels returns the dual yent if it is in memory, without loading
+// it. Safe without s.mu.
+func (s *Server) loadedModels() *DualYent {
+	if s.loadModels != nil && !s.modelsLoaded.Load() {
+		return nil
+	}
+	return s.dy
+}
+
+// requireModels loads the models if needed, answering 503 when they can't
+// be. Reports whether they are there.
+func (s *Server) requireModels(w http.ResponseWriter) bool {
+	dy, err := s.models()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeModelsUnavailable, "models unavailable: "+err.Error())
+		return false
+	}
+	if dy == nil {
+		writeError(w, http.StatusServiceUnavailable, errCodeModelsUnavailable, "models not loaded")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func lazyHealth(t *testing.T, srv *Server) HealthResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	var h HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestLazyModelsLoadOnce(t *testing.T) {
+	var loads atomic.Int32
+	srv := newTestServer()
+	srv.sdModelDir = t.TempDir()
+	srv.loadModels = func() (*DualYent, error) {
+		loads.Add(1)
+		time.Sleep(20 * time.Millisecond) // let the other requests pile up
+		return seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1), nil
+	}
+
+	if h := lazyHealth(t, srv); h.ModelsLoaded || !h.YentsReady {
+		t.Errorf("before any reaction: models_loaded %v, yents_ready %v, want false, true", h.ModelsLoaded, h.YentsReady)
+	}
+	if loads.Load() != 0 {
+		t.Fatalf("models loaded %d times before the first reaction", loads.Load())
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"paint me a duck","max_tokens":8}`)))
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("models loaded %d times under 10 concurrent requests, want 1", n)
+	}
+	for i, code := range codes {
+		if code != 200 {
+			t.Errorf("request %d: status %d, want 200", i, code)
+		}
+	}
+	if h := lazyHealth(t, srv); !h.ModelsLoaded {
+		t.Error("models_loaded still false after reacting")
+	}
+}
+
+func TestLazyModelsLoadFailure(t *testing.T) {
+	srv := newTestServer()
+	srv.loadModels = func() (*DualYent, error) { return nil, errors.New("no such file") }
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"duck"}`)))
+		if w.Code != 503 || !strings.Contains(w.Body.String(), "no such file") {
+			t.Errorf("attempt %d: status %d %q, want 503 with the load error", i, w.Code, w.Body.String())
+		}
+	}
+	if h := lazyHealth(t, srv); h.ModelsLoaded || h.YentsReady {
+		t.Errorf("after a failed load: models_loaded %v, yents_ready %v, want both false", h.ModelsLoaded, h.YentsReady)
+	}
+}
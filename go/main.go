@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"image/png"
 	"math"
 	"math/rand"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,16 +16,24 @@ import (
 // Version info
 const yentYoVersion = "2.0"
 
+// Build info, injected at link time:
+//
+//	go build -ldflags "-X main.gitCommit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var (
+	gitCommit string // empty → VCS stamp from the Go toolchain, if any
+	buildTime string
+)
+
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("yent.yo v" + yentYoVersion + " — Text-to-Image with Dual Yent")
 		fmt.Println()
 		fmt.Println("Usage:")
-		fmt.Println("  yentyo <sd_model_dir> [prompt] [output.png] [seed] [steps] [latent_size]")
+		fmt.Println("  yentyo <sd_model_dir> [prompt] [output.png] [seed] [steps] [latent_size] [guidance] [guidance_rescale]")
 		fmt.Println("  yentyo <sd_model_dir> --yent <micro_yent.gguf> [seed_phrase] [output.png] [seed]")
 		fmt.Println("  yentyo <sd_model_dir> --dual <micro.gguf> <nano.gguf> [user_input] [output.png]")
 		fmt.Println("  yentyo --prompt-only <micro_yent.gguf> [seed_phrase] [max_tokens] [temperature]")
-		fmt.Println("  yentyo --serve <sd_model_dir> <micro.gguf> <nano.gguf> [port]")
+		fmt.Println("  yentyo --serve <sd_model_dir> <micro.gguf> <nano.gguf> [port] [--allowed-origins a,b] [--temperament name] [--admin-token t] [--seed n] [--gen-timeout 30s] [--debug-postprocess dir] [--image-dir dir] [--max-batch n] [--max-input chars] [--lazy] [--text-only] [--vae-tile n] [--guidance-rescale f] [--sigma-schedule linear|karras] [--threads n] [--backend sd|stub] [--png-compression default|speed|best|none] [--image-dir-compression default|speed|best|none]")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  yentyo bk-sdm-tiny \"a cat on a roof\" cat.png 42 25 64")
@@ -91,8 +102,13 @@ func main() {
 		fmt.Sscanf(os.Args[7], "%f", &g)
 		guidanceScale = float32(g)
 	}
+	if len(os.Args) > 8 {
+		guidanceRescale = parseUnit("guidance_rescale", os.Args[8])
+	}
 
-	runDiffusion(modelDir, prompt, outPath, seed, numSteps, latentSize, guidanceScale)
+	if err := runDiffusion(context.Background(), modelDir, prompt, outPath, seed, numSteps, latentSize, guidanceScale, nil); err != nil {
+		fatal("diffusion: %v", err)
+	}
 }
 
 // runWithYent uses micro-Yent to generate prompt, then runs diffusion
@@ -157,7 +173,9 @@ func runWithYent(sdModelDir string) {
 	fmt.Printf("Yent's words: %q\n", yentWords)
 
 	// Run diffusion with generated prompt (post-processing applied automatically)
-	runDiffusion(sdModelDir, prompt, outPath, seed, 10, 64, 7.5)
+	if err := runDiffusion(context.Background(), sdModelDir, prompt, outPath, seed, 10, 64, 7.5, nil); err != nil {
+		fatal("diffusion: %v", err)
+	}
 }
 
 // runPromptOnly generates a prompt using micro-Yent and prints it to stdout
@@ -230,33 +248,36 @@ func runComplete() {
 	fmt.Println(result)
 }
 
-// runDiffusion dispatches to pure Go or ORT pipeline (overridden by init() in ort_pipeline.go)
+// runDiffusion dispatches to pure Go or ORT pipeline (overridden by init() in ort_pipeline.go).
+// progress, if non-nil, is called after each scheduler step with step in 1..total.
+// Cancelling ctx aborts between steps with ctx.Err() and writes no image.
 var runDiffusion = runDiffusionPureGo
 
 // Package-level state for post-processing (set before runDiffusion)
 var postProcessWords string // Yent's words for ASCII overlay
 
-func runDiffusionPureGo(modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32) {
-	fmt.Printf("Model: %s\n", modelDir)
-	fmt.Printf("Prompt: %q\n", prompt)
-	fmt.Printf("Seed: %d, Steps: %d, Guidance: %.1f, Latent: %dx%d\n", seed, numSteps, guidanceScale, latentSize, latentSize)
+func runDiffusionPureGo(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+	plog := pipelineOut(ctx)
+	fmt.Fprintf(plog, "Model: %s\n", modelDir)
+	fmt.Fprintf(plog, "Prompt: %q\n", prompt)
+	fmt.Fprintf(plog, "Seed: %d, Steps: %d, Guidance: %.1f, Latent: %dx%d\n", seed, numSteps, guidanceScale, latentSize, latentSize)
 
 	// ===== PHASE 1: Text Encoding =====
-	fmt.Print("\n--- Phase 1: Text Encoding ---\n")
+	fmt.Fprint(plog, "\n--- Phase 1: Text Encoding ---\n")
 
-	fmt.Print("Loading tokenizer... ")
+	fmt.Fprint(plog, "Loading tokenizer... ")
 	start := time.Now()
 	tokenizer, err := LoadTokenizer(modelDir + "/tokenizer")
 	if err != nil {
 		fatal("tokenizer: %v", err)
 	}
-	fmt.Printf("done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
 
 	condTokens := tokenizer.Encode(prompt)
 	uncondTokens := tokenizer.Encode("")
-	fmt.Printf("Cond tokens: %v... (len=%d)\n", condTokens[:min(8, len(condTokens))], len(condTokens))
+	fmt.Fprintf(plog, "Cond tokens: %v... (len=%d)\n", condTokens[:min(8, len(condTokens))], len(condTokens))
 
-	fmt.Print("Loading CLIP... ")
+	fmt.Fprint(plog, "Loading CLIP... ")
 	start = time.Now()
 	clipST, err := OpenSafeTensors(modelDir + "/text_encoder/model.fp16.safetensors")
 	if err != nil {
@@ -266,26 +287,26 @@ func runDiffusionPureGo(modelDir, prompt, outPath string, seed int64, numSteps,
 	if err != nil {
 		fatal("clip parse: %v", err)
 	}
-	fmt.Printf("done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
 
-	fmt.Print("Encoding text... ")
+	fmt.Fprint(plog, "Encoding text... ")
 	start = time.Now()
 	condEmb := clipModel.Encode(condTokens)
 	uncondEmb := clipModel.Encode(uncondTokens)
-	fmt.Printf("done (%v)\n", time.Since(start))
-	fmt.Printf("  cond_emb[0][:3] = [%.4f, %.4f, %.4f]\n",
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "  cond_emb[0][:3] = [%.4f, %.4f, %.4f]\n",
 		condEmb.Data[0], condEmb.Data[1], condEmb.Data[2])
 
 	// Free CLIP
 	clipModel = nil
 	clipST = nil
 	runtime.GC()
-	fmt.Println("CLIP freed")
+	fmt.Fprintln(plog, "CLIP freed")
 
 	// ===== PHASE 2: Diffusion =====
-	fmt.Print("\n--- Phase 2: Diffusion ---\n")
+	fmt.Fprint(plog, "\n--- Phase 2: Diffusion ---\n")
 
-	fmt.Print("Loading UNet... ")
+	fmt.Fprint(plog, "Loading UNet... ")
 	start = time.Now()
 	unetST, err := OpenSafeTensors(modelDir + "/unet/diffusion_pytorch_model.fp16.safetensors")
 	if err != nil {
@@ -297,50 +318,40 @@ func runDiffusionPureGo(modelDir, prompt, outPath string, seed int64, numSteps,
 	}
 	unetST = nil
 	runtime.GC()
-	fmt.Printf("done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
 
 	// Scheduler
 	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
 	timesteps := sched.SetTimesteps(numSteps)
-	fmt.Printf("Timesteps (%d): [%d ... %d]\n", len(timesteps), timesteps[0], timesteps[len(timesteps)-1])
+	fmt.Fprintf(plog, "Timesteps (%d): [%d ... %d]\n", len(timesteps), timesteps[0], timesteps[len(timesteps)-1])
 
 	// Initial noise
 	latent := randomLatent(1, 4, latentSize, latentSize, seed)
-	fmt.Printf("Latent: [%d,%d,%d,%d], range=[%.3f, %.3f]\n",
+	fmt.Fprintf(plog, "Latent: [%d,%d,%d,%d], range=[%.3f, %.3f], mean=%.3f, std=%.3f\n",
 		latent.Shape[0], latent.Shape[1], latent.Shape[2], latent.Shape[3],
-		tensorMin(latent), tensorMax(latent))
+		tensorMin(latent), tensorMax(latent), tensorMean(latent), tensorStd(latent))
 
 	// Diffusion loop
-	fmt.Println()
+	fmt.Fprintln(plog)
 	totalStart := time.Now()
-	for step, t := range timesteps {
-		stepStart := time.Now()
-
-		noiseUncond := unet.Forward(latent, t, uncondEmb)
-		noiseCond := unet.Forward(latent, t, condEmb)
-
-		noisePred := NewTensor(noiseUncond.Shape...)
-		for i := range noisePred.Data {
-			noisePred.Data[i] = noiseUncond.Data[i] + guidanceScale*(noiseCond.Data[i]-noiseUncond.Data[i])
-		}
-
-		latent = sched.Step(noisePred, t, latent)
-
-		fmt.Printf("  Step %d/%d (t=%d): %.1fs\n",
-			step+1, numSteps, t, time.Since(stepStart).Seconds())
+	latent, err = denoise(ctx, sched, latent, timesteps, guidedPredictor(unet, condEmb, uncondEmb, guidanceScale), progress)
+	if err != nil {
+		fmt.Fprintf(plog, "\nDiffusion aborted: %v\n", err)
+		return err
 	}
-	fmt.Printf("\nDiffusion: %.1fs total\n", time.Since(totalStart).Seconds())
+	fmt.Fprintf(plog, "\nDiffusion: %.1fs total\n", time.Since(totalStart).Seconds())
 
 	unet = nil
 	runtime.GC()
-	fmt.Println("UNet freed")
+	fmt.Fprintln(plog, "UNet freed")
 
 	// ===== PHASE 3: VAE Decoding =====
-	fmt.Print("\n--- Phase 3: VAE Decoding ---\n")
+	fmt.Fprint(plog, "\n--- Phase 3: VAE Decoding ---\n")
 
 	latent = Scale(latent, float32(1.0/0.18215))
+	fmt.Fprintf(plog, "VAE input: mean=%.3f, std=%.3f\n", tensorMean(latent), tensorStd(latent))
 
-	fmt.Print("Loading VAE decoder... ")
+	fmt.Fprint(plog, "Loading VAE decoder... ")
 	start = time.Now()
 	vaeST, err := OpenSafeTensors(modelDir + "/vae/diffusion_pytorch_model.fp16.safetensors")
 	if err != nil {
@@ -352,22 +363,57 @@ func runDiffusionPureGo(modelDir, prompt, outPath string, seed int64, numSteps,
 	}
 	vaeST = nil
 	runtime.GC()
-	fmt.Printf("done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
 
-	fmt.Print("Decoding... ")
+	fmt.Fprint(plog, "Decoding... ")
 	start = time.Now()
-	img := vae.Decode(latent)
-	fmt.Printf("done (%v)\n", time.Since(start))
-	fmt.Printf("  Output: [%d,%d,%d,%d], range=[%.3f, %.3f]\n",
+	img := decodeLatent(vae, latent)
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "  Output: [%d,%d,%d,%d], range=[%.3f, %.3f]\n",
 		img.Shape[0], img.Shape[1], img.Shape[2], img.Shape[3],
 		tensorMin(img), tensorMax(img))
 
 	// Save PNG
-	fmt.Printf("Saving %s... ", outPath)
-	if err := savePNG(img, outPath); err != nil {
+	fmt.Fprintf(plog, "Saving %s... ", outPath)
+	if err := savePNG(img, outPath, seed, diffusionMeta(modelDir, prompt, seed, numSteps, guidanceScale)); err != nil {
 		fatal("save: %v", err)
 	}
-	fmt.Println("done!")
+	fmt.Fprintln(plog, "done!")
+	return nil
+}
+
+// noisePredictor returns the noise estimate for latent at timestep t
+type noisePredictor func(latent *Tensor, t int) *Tensor
+
+// guidedPredictor wraps the UNet with classifier-free guidance
+func guidedPredictor(unet *UNet2D, condEmb, uncondEmb *Tensor, guidanceScale float32) noisePredictor {
+	return func(latent *Tensor, t int) *Tensor {
+		noiseUncond := unet.Forward(latent, t, uncondEmb)
+		noiseCond := unet.Forward(latent, t, condEmb)
+
+		noisePred := NewTensor(noiseUncond.Shape...)
+		noisePred.Data = combineGuidance(noiseUncond.Data, noiseCond.Data, guidanceScale, guidanceRescale)
+		return noisePred
+	}
+}
+
+// denoise runs the DDIM loop over timesteps starting from latent.
+// progress (optional) is called after every step; ctx is checked before each one.
+func denoise(ctx context.Context, sched *DDIMScheduler, latent *Tensor, timesteps []int, predict noisePredictor, progress func(step, total int)) (*Tensor, error) {
+	plog := pipelineOut(ctx)
+	for step, t := range timesteps {
+		if err := ctx.Err(); err != nil {
+			return latent, err
+		}
+		stepStart := time.Now()
+		latent = sched.Step(predict(latent, t), t, latent)
+		fmt.Fprintf(plog, "  Step %d/%d (t=%d): %.1fs\n",
+			step+1, len(timesteps), t, time.Since(stepStart).Seconds())
+		if progress != nil {
+			progress(step+1, len(timesteps))
+		}
+	}
+	return latent, nil
 }
 
 func randomLatent(n, c, h, w int, seed int64) *Tensor {
@@ -395,15 +441,22 @@ func randomLatent(n, c, h, w int, seed int64) *Tensor {
 	return t
 }
 
-func savePNG(tensor *Tensor, path string) error {
+func savePNG(tensor *Tensor, path string, seed int64, meta map[string]string) error {
+	return savePNGLevel(tensor, path, seed, meta, pngCompression)
+}
+
+// savePNGLevel is savePNG at compression level
+func savePNGLevel(tensor *Tensor, path string, seed int64, meta map[string]string, level png.CompressionLevel) error {
 	rgba := tensorToRGBA(tensor)
 
-	// Apply post-processing if yentWords available
+	// Apply post-processing if yentWords available (grain follows the
+	// diffusion seed, so a replayed seed replays the whole image)
 	if postProcessWords != "" {
-		rgba = PostProcess(rgba, postProcessWords)
+		rgba = PostProcessSeeded(rgba, postProcessWords, seed)
+		meta = postProcessedMeta(meta, postProcessWords)
 	}
 
-	return saveProcessedPNG(rgba, path)
+	return saveProcessedPNGLevel(rgba, path, meta, level)
 }
 
 func clampByte(v float32) uint8 {
@@ -416,26 +469,61 @@ func clampByte(v float32) uint8 {
 	return uint8(v * 255)
 }
 
+// tensorMin is the smallest of t's elements, 0 for an empty tensor. NaNs
+// are skipped so the answer doesn't depend on where they sit; a tensor
+// of nothing but NaNs gives NaN.
 func tensorMin(t *Tensor) float32 {
-	m := t.Data[0]
-	for _, v := range t.Data[1:] {
-		if v < m {
-			m = v
-		}
-	}
-	return m
+	return extremum(t.Data, func(a, b float32) bool { return a < b })
 }
 
+// tensorMax is the largest of t's elements, with tensorMin's rules for
+// empty tensors and NaNs
 func tensorMax(t *Tensor) float32 {
-	m := t.Data[0]
-	for _, v := range t.Data[1:] {
-		if v > m {
+	return extremum(t.Data, func(a, b float32) bool { return a > b })
+}
+
+// extremum is the element of data that beats every other under better,
+// ignoring NaNs
+func extremum(data []float32, better func(a, b float32) bool) float32 {
+	if len(data) == 0 {
+		return 0
+	}
+	m := float32(math.NaN())
+	for _, v := range data {
+		if v != v {
+			continue
+		}
+		if m != m || better(v, m) {
 			m = v
 		}
 	}
 	return m
 }
 
+// tensorMean is the mean of t's elements
+func tensorMean(t *Tensor) float32 {
+	return meanFloat32(t.Data)
+}
+
+// tensorStd is the population standard deviation of t's elements
+func tensorStd(t *Tensor) float32 {
+	return stdDev(t.Data)
+}
+
+// stdDev is the population standard deviation of data
+func stdDev(data []float32) float32 {
+	if len(data) == 0 {
+		return 0
+	}
+	mean := meanFloat32(data)
+	var sum float64
+	for _, v := range data {
+		d := float64(v - mean)
+		sum += d * d
+	}
+	return float32(math.Sqrt(sum / float64(len(data))))
+}
+
 // runDual uses two Yent models in parallel: artist + commentator
 func runDual(sdModelDir string) {
 	if len(os.Args) < 5 {
@@ -458,15 +546,15 @@ func runDual(sdModelDir string) {
 		fmt.Sscanf(os.Args[7], "%d", &seed)
 	}
 
-	// Load both models
-	dy, err := NewDualYent(microPath, nanoPath)
+	// Load both models (the seed also fixes their reactions)
+	dy, err := NewDualYentSeeded(microPath, nanoPath, seed)
 	if err != nil {
 		fatal("dual yent: %v", err)
 	}
 	defer dy.Free()
 
-	// ASCII sketch animation (creative process)
-	sketchCfg := DefaultSketchConfig()
+	// ASCII sketch animation (creative process), in the input's mood
+	sketchCfg := dy.A.sketchConfig(userInput)
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 
 	fmt.Fprintf(os.Stderr, "\n")
@@ -478,17 +566,18 @@ func runDual(sdModelDir string) {
 	// Stream commentator's roast with typing effect
 	StreamCommentary(result.Roast)
 
-	// Show sketch animation while we prepare for diffusion
+	// Show sketch animation, then "rendering..." while we prepare for diffusion
 	SketchAnimation(sketchCfg, result.Prompt, rng)
-	SketchTransition(rng)
-
-	fmt.Fprintf(os.Stderr, "[dual] artist=%s prompt=%q (%.1fs)\n",
-		result.ArtistID, result.Prompt, time.Since(start).Seconds())
+	prepared := make(chan struct{})
+	transitionDone := make(chan struct{})
+	go func() {
+		SketchTransition(DefaultTransitionConfig(), prepared)
+		close(transitionDone)
+	}()
 
 	// Save yent words for post-processing
 	wordsPath := strings.TrimSuffix(outPath, ".png") + ".yent.txt"
 	os.WriteFile(wordsPath, []byte(result.YentWords), 0644)
-	fmt.Fprintf(os.Stderr, "[yent-words] %s\n", result.YentWords)
 
 	// Set words for post-processing pipeline
 	postProcessWords = result.YentWords
@@ -496,30 +585,221 @@ func runDual(sdModelDir string) {
 	// Free LLMs before diffusion
 	dy.Free()
 	runtime.GC()
+	close(prepared)
+	<-transitionDone
+
+	fmt.Fprintf(os.Stderr, "[dual] artist=%s prompt=%q (%.1fs)\n",
+		result.ArtistID, result.Prompt, time.Since(start).Seconds())
+	fmt.Fprintf(os.Stderr, "[yent-words] %s\n", result.YentWords)
 
 	// Print prompt to stdout (for pipeline)
 	fmt.Println(result.Prompt)
 
 	// Run diffusion (post-processing applied automatically via savePNG)
-	runDiffusion(sdModelDir, result.Prompt, outPath, seed, 10, 64, 7.5)
+	if err := runDiffusion(context.Background(), sdModelDir, result.Prompt, outPath, seed, 10, 64, 7.5, nil); err != nil {
+		fatal("diffusion: %v", err)
+	}
 }
 
 // runServe starts HTTP server with web UI
 func runServe() {
-	if len(os.Args) < 5 {
-		fatal("--serve requires: <sd_model_dir> <micro.gguf> <nano.gguf> [port]")
+	// Pull out --allowed-origins (default "*" for dev), --temperament,
+	// --admin-token, --seed, --gen-timeout, --debug-postprocess, --image-dir,
+	// --max-batch, --max-input, --lazy, --text-only, --backend, --vae-tile,
+	// --guidance-rescale, --sigma-schedule, --threads and --png-compression
+	// (package settings, like the post-processing words) and
+	// --image-dir-compression; the rest stays positional
+	origins := "*"
+	temperament := "default"
+	adminToken := ""
+	seedArg := ""
+	genTimeout := defaultGenerationTimeout
+	postDebug := ""
+	imageDir := ""
+	maxBatch := defaultMaxBatch
+	maxInput := defaultMaxInputChars
+	lazy := false
+	textOnly := false
+	backend := defaultBackend
+	var imageDirLevel *png.CompressionLevel
+	var args []string
+	for i := 2; i < len(os.Args); i++ {
+		a := os.Args[i]
+		switch {
+		case a == "--allowed-origins" && i+1 < len(os.Args):
+			origins = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--allowed-origins="):
+			origins = strings.TrimPrefix(a, "--allowed-origins=")
+		case a == "--temperament" && i+1 < len(os.Args):
+			temperament = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--temperament="):
+			temperament = strings.TrimPrefix(a, "--temperament=")
+		case a == "--admin-token" && i+1 < len(os.Args):
+			adminToken = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--admin-token="):
+			adminToken = strings.TrimPrefix(a, "--admin-token=")
+		case a == "--seed" && i+1 < len(os.Args):
+			seedArg = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--seed="):
+			seedArg = strings.TrimPrefix(a, "--seed=")
+		case a == "--gen-timeout" && i+1 < len(os.Args):
+			genTimeout = parseTimeout(os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--gen-timeout="):
+			genTimeout = parseTimeout(strings.TrimPrefix(a, "--gen-timeout="))
+		case a == "--debug-postprocess" && i+1 < len(os.Args):
+			postDebug = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--debug-postprocess="):
+			postDebug = strings.TrimPrefix(a, "--debug-postprocess=")
+		case a == "--image-dir" && i+1 < len(os.Args):
+			imageDir = os.Args[i+1]
+			i++
+		case strings.HasPrefix(a, "--image-dir="):
+			imageDir = strings.TrimPrefix(a, "--image-dir=")
+		case a == "--max-batch" && i+1 < len(os.Args):
+			maxBatch = parsePositive("--max-batch", os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--max-batch="):
+			maxBatch = parsePositive("--max-batch", strings.TrimPrefix(a, "--max-batch="))
+		case a == "--max-input" && i+1 < len(os.Args):
+			maxInput = parsePositive("--max-input", os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--max-input="):
+			maxInput = parsePositive("--max-input", strings.TrimPrefix(a, "--max-input="))
+		case a == "--lazy":
+			lazy = true
+		case a == "--text-only":
+			textOnly = true
+		case a == "--vae-tile" && i+1 < len(os.Args):
+			vaeTileSize = parsePositive("--vae-tile", os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--vae-tile="):
+			vaeTileSize = parsePositive("--vae-tile", strings.TrimPrefix(a, "--vae-tile="))
+		case a == "--guidance-rescale" && i+1 < len(os.Args):
+			guidanceRescale = parseUnit("--guidance-rescale", os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--guidance-rescale="):
+			guidanceRescale = parseUnit("--guidance-rescale", strings.TrimPrefix(a, "--guidance-rescale="))
+		case a == "--sigma-schedule" && i+1 < len(os.Args):
+			sigmaSchedule = parseSigmaSchedule(os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--sigma-schedule="):
+			sigmaSchedule = parseSigmaSchedule(strings.TrimPrefix(a, "--sigma-schedule="))
+		case a == "--backend" && i+1 < len(os.Args):
+			backend = parseBackend(os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--backend="):
+			backend = parseBackend(strings.TrimPrefix(a, "--backend="))
+		case a == "--threads" && i+1 < len(os.Args):
+			setThreads(parsePositive("--threads", os.Args[i+1]))
+			i++
+		case strings.HasPrefix(a, "--threads="):
+			setThreads(parsePositive("--threads", strings.TrimPrefix(a, "--threads=")))
+		case a == "--png-compression" && i+1 < len(os.Args):
+			pngCompression = parsePNGCompression("--png-compression", os.Args[i+1])
+			i++
+		case strings.HasPrefix(a, "--png-compression="):
+			pngCompression = parsePNGCompression("--png-compression", strings.TrimPrefix(a, "--png-compression="))
+		case a == "--image-dir-compression" && i+1 < len(os.Args):
+			level := parsePNGCompression("--image-dir-compression", os.Args[i+1])
+			imageDirLevel = &level
+			i++
+		case strings.HasPrefix(a, "--image-dir-compression="):
+			level := parsePNGCompression("--image-dir-compression", strings.TrimPrefix(a, "--image-dir-compression="))
+			imageDirLevel = &level
+		default:
+			args = append(args, a)
+		}
 	}
 
-	sdModelDir := os.Args[2]
-	microPath := os.Args[3]
-	nanoPath := os.Args[4]
+	if len(args) < 3 {
+		fatal("--serve requires: <sd_model_dir> <micro.gguf> <nano.gguf> [port] [--allowed-origins a,b] [--temperament name] [--admin-token t] [--seed n] [--gen-timeout 30s] [--debug-postprocess dir] [--image-dir dir] [--max-batch n] [--max-input chars] [--lazy] [--text-only] [--vae-tile n] [--guidance-rescale f] [--sigma-schedule linear|karras] [--threads n] [--backend sd|stub] [--png-compression default|speed|best|none] [--image-dir-compression default|speed|best|none]")
+	}
+	weights, ok := Temperaments[temperament]
+	if !ok {
+		fatal("unknown temperament %q (want default, hostile or mellow)", temperament)
+	}
+	seed := time.Now().UnixNano()
+	if seedArg != "" {
+		if _, err := fmt.Sscanf(seedArg, "%d", &seed); err != nil {
+			fatal("bad --seed %q: %v", seedArg, err)
+		}
+	}
+
+	sdModelDir := args[0]
+	microPath := args[1]
+	nanoPath := args[2]
 	port := "8080"
 
-	if len(os.Args) > 5 {
-		port = os.Args[5]
+	if len(args) > 3 {
+		port = args[3]
+	}
+
+	startServer(sdModelDir, microPath, nanoPath, serveOptions{
+		port:           port,
+		allowedOrigins: strings.Split(origins, ","),
+		weights:        weights,
+		adminToken:     adminToken,
+		seed:           seed,
+		genTimeout:     genTimeout,
+		postDebug:      postDebug,
+		imageDir:       imageDir,
+		imageDirLevel:  imageDirLevel,
+		maxBatch:       maxBatch,
+		maxInput:       maxInput,
+		lazy:           lazy,
+		textOnly:       textOnly,
+		backend:        backend,
+	})
+}
+
+// parseTimeout reads a --gen-timeout value such as "45s" or "2m"
+func parseTimeout(v string) time.Duration {
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		fatal("bad --gen-timeout %q: want a positive duration like 30s", v)
+	}
+	return d
+}
+
+// parsePositive reads a positive integer flag value such as --max-batch
+func parsePositive(flag, v string) int {
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		fatal("bad %s %q: want a positive number", flag, v)
+	}
+	return n
+}
+
+// parseUnit parses a flag value in [0, 1] or exits
+func parseUnit(flag, v string) float32 {
+	f, err := strconv.ParseFloat(v, 32)
+	if err != nil || f < 0 || f > 1 {
+		fatal("bad %s %q: want a number from 0 to 1", flag, v)
 	}
+	return float32(f)
+}
 
-	startServer(sdModelDir, microPath, nanoPath, port)
+// parseSigmaSchedule checks a --sigma-schedule name or exits
+func parseSigmaSchedule(v string) string {
+	if v != SigmaLinear && v != SigmaKarras {
+		fatal("bad --sigma-schedule %q: want %s or %s", v, SigmaLinear, SigmaKarras)
+	}
+	return v
+}
+
+// parsePNGCompression reads a pngCompressionLevels name for flag
+func parsePNGCompression(flag, v string) png.CompressionLevel {
+	level, ok := pngCompressionLevels[v]
+	if !ok {
+		fatal("bad %s %q: want default, speed, best or none", flag, v)
+	}
+	return level
 }
 
 func fatal(format string, args ...interface{}) {
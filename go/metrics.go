@@ -0,0 +1,114 @@
+package main
+
+// metrics.go — hand-rolled Prometheus text exposition for /metrics
+//
+// No labels, no client library:
+//   react_requests_total              counter
+//   react_duration_seconds            histogram (LLM reaction + images)
+//   react_dissonance                  histogram (artist's dissonance score)
+//   image_generation_failures_total   counter
+//   cached_images                     gauge (ImageStore.Len at scrape)
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+var (
+	reactDurationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+	dissonanceBuckets    = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1.0}
+)
+
+// histogram holds cumulative-on-write bucket counts for a fixed bound list
+type histogram struct {
+	counts []uint64 // len(bounds); +Inf is n
+	sum    float64
+	n      uint64
+}
+
+func (h *histogram) observe(bounds []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds))
+	}
+	for i, b := range bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.n++
+}
+
+func (h *histogram) write(w io.Writer, name, help string, bounds []float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, b := range bounds {
+		var c uint64
+		if h.counts != nil {
+			c = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), c)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.n)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.n)
+}
+
+// serverMetrics is usable as a zero value
+type serverMetrics struct {
+	mu            sync.Mutex
+	reactRequests uint64
+	reactDuration histogram
+	dissonance    histogram
+	imageFailures uint64
+}
+
+func (m *serverMetrics) incRequests() {
+	m.mu.Lock()
+	m.reactRequests++
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) observeReact(seconds, dissonance float64) {
+	m.mu.Lock()
+	m.reactDuration.observe(reactDurationBuckets, seconds)
+	m.dissonance.observe(dissonanceBuckets, dissonance)
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) incImageFailures() {
+	m.mu.Lock()
+	m.imageFailures++
+	m.mu.Unlock()
+}
+
+func (m *serverMetrics) write(w io.Writer, cachedImages int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP react_requests_total Requests to /react and /react/stream.\n")
+	fmt.Fprintf(w, "# TYPE react_requests_total counter\n")
+	fmt.Fprintf(w, "react_requests_total %d\n", m.reactRequests)
+
+	m.reactDuration.write(w, "react_duration_seconds",
+		"Time to react and generate images.", reactDurationBuckets)
+	m.dissonance.write(w, "react_dissonance",
+		"Dissonance between input and the artist's memory.", dissonanceBuckets)
+
+	fmt.Fprintf(w, "# HELP image_generation_failures_total Diffusion runs that produced no image.\n")
+	fmt.Fprintf(w, "# TYPE image_generation_failures_total counter\n")
+	fmt.Fprintf(w, "image_generation_failures_total %d\n", m.imageFailures)
+
+	fmt.Fprintf(w, "# HELP cached_images Images held in the image store.\n")
+	fmt.Fprintf(w, "# TYPE cached_images gauge\n")
+	fmt.Fprintf(w, "cached_images %d\n", cachedImages)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	cached := s.images.Len()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w, cached)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, srv *Server) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 200 {
+		t.Fatalf("/metrics status = %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestMetricsCountersMove(t *testing.T) {
+	srv := newTestServer()
+
+	before := scrape(t, srv)
+	for _, line := range []string{
+		"react_requests_total 0",
+		"image_generation_failures_total 0",
+		"cached_images 0",
+		"react_duration_seconds_count 0",
+	} {
+		if !strings.Contains(before, line+"\n") {
+			t.Errorf("fresh scrape missing %q", line)
+		}
+	}
+
+	// One (rejected) react request, one failed diffusion, one cached image
+	w := httptest.NewRecorder()
+	srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{}`)))
+
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		return nil // writes nothing
+	}
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.tryGenerateImage(context.Background(), "duck", nil, 1, formatPNG, 0, nil)
+
+	srv.storeImage([]byte{0x89})
+	srv.metrics.observeReact(1.5, 0.42)
+
+	after := scrape(t, srv)
+	for _, line := range []string{
+		"react_requests_total 1",
+		"image_generation_failures_total 1",
+		"cached_images 1",
+		"react_duration_seconds_count 1",
+		`react_duration_seconds_bucket{le="1"} 0`,
+		`react_duration_seconds_bucket{le="2.5"} 1`,
+		`react_dissonance_bucket{le="0.5"} 1`,
+	} {
+		if !strings.Contains(after, line+"\n") {
+			t.Errorf("scrape after request missing %q", line)
+		}
+	}
+}
+
+func TestHistogramCumulative(t *testing.T) {
+	var h histogram
+	bounds := []float64{1, 2, 3}
+	for _, v := range []float64{0.5, 1.5, 2.5, 9} {
+		h.observe(bounds, v)
+	}
+	var buf bytes.Buffer
+	h.write(&buf, "x", "test", bounds)
+	out := buf.String()
+	for _, line := range []string{
+		`x_bucket{le="1"} 1`,
+		`x_bucket{le="2"} 2`,
+		`x_bucket{le="3"} 3`,
+		`x_bucket{le="+Inf"} 4`,
+		"x_sum 13.5",
+		"x_count 4",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("histogram output missing %q:\n%s", line, out)
+		}
+	}
+}
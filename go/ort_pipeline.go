@@ -3,8 +3,10 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
@@ -16,12 +18,14 @@ import (
 
 func init() {
 	runDiffusion = runDiffusionORT
+	pipelineName = "ort"
 }
 
-func runDiffusionORT(modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32) {
-	fmt.Printf("[ORT] Model: %s\n", modelDir)
-	fmt.Printf("[ORT] Prompt: %q\n", prompt)
-	fmt.Printf("[ORT] Seed: %d, Steps: %d, Guidance: %.1f, Latent: %dx%d\n",
+func runDiffusionORT(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+	plog := pipelineOut(ctx)
+	fmt.Fprintf(plog, "[ORT] Model: %s\n", modelDir)
+	fmt.Fprintf(plog, "[ORT] Prompt: %q\n", prompt)
+	fmt.Fprintf(plog, "[ORT] Seed: %d, Steps: %d, Guidance: %.1f, Latent: %dx%d\n",
 		seed, numSteps, guidanceScale, latentSize, latentSize)
 
 	// ONNX dir: env override or auto-detect (prefer int8)
@@ -32,24 +36,26 @@ func runDiffusionORT(modelDir, prompt, outPath string, seed int64, numSteps, lat
 			onnxDir = modelDir + "/onnx_fp16"
 		}
 	}
-	fmt.Printf("[ORT] ONNX dir: %s\n", onnxDir)
+	fmt.Fprintf(plog, "[ORT] ONNX dir: %s\n", onnxDir)
 
 	// Auto-detect ORT library
 	ortLib := findORTLibrary()
 	if ortLib == "" {
 		fatal("libonnxruntime not found. Install: brew install onnxruntime")
 	}
-	fmt.Printf("[ORT] Library: %s\n", ortLib)
+	fmt.Fprintf(plog, "[ORT] Library: %s\n", ortLib)
 
-	pipeline, err := NewORTPipeline(onnxDir, modelDir, ortLib)
+	pipeline, err := NewORTPipeline(onnxDir, modelDir, ortLib, plog)
 	if err != nil {
 		fatal("ORT pipeline: %v", err)
 	}
 	defer pipeline.Destroy()
 
-	if err := pipeline.Generate(prompt, seed, numSteps, latentSize, guidanceScale, outPath); err != nil {
+	err = pipeline.Generate(ctx, prompt, seed, numSteps, latentSize, guidanceScale, outPath, progress)
+	if err != nil && ctx.Err() == nil {
 		fatal("generate: %v", err)
 	}
+	return err
 }
 
 // findORTLibrary looks for libonnxruntime in common locations
@@ -81,56 +87,59 @@ type ORTPipeline struct {
 	clipInputType ort.TensorElementDataType
 	unetInputType ort.TensorElementDataType // for sample + encoder_hidden_states
 	vaeInputType  ort.TensorElementDataType
+
+	modelDir string // recorded in PNG metadata
 }
 
-// NewORTPipeline loads all ONNX models and creates inference sessions.
-func NewORTPipeline(onnxDir, modelDir, ortLibPath string) (*ORTPipeline, error) {
+// NewORTPipeline loads all ONNX models and creates inference sessions,
+// reporting progress to plog.
+func NewORTPipeline(onnxDir, modelDir, ortLibPath string, plog io.Writer) (*ORTPipeline, error) {
 	ort.SetSharedLibraryPath(ortLibPath)
 	if err := ort.InitializeEnvironment(); err != nil {
 		return nil, fmt.Errorf("ORT init: %w", err)
 	}
 
-	// Session options: optimize graph, use all CPU threads
+	// Session options: optimize graph, --threads intra-op threads
 	opts, err := ort.NewSessionOptions()
 	if err != nil {
 		return nil, fmt.Errorf("session options: %w", err)
 	}
 	defer opts.Destroy()
 	opts.SetGraphOptimizationLevel(ort.GraphOptimizationLevelEnableAll)
-	opts.SetIntraOpNumThreads(4) // physical cores (i5 = 4)
+	opts.SetIntraOpNumThreads(ortThreads())
 	opts.SetInterOpNumThreads(1) // single inference stream
 
-	p := &ORTPipeline{}
+	p := &ORTPipeline{modelDir: modelDir}
 
 	// Load tokenizer
-	fmt.Print("Loading tokenizer... ")
+	fmt.Fprint(plog, "Loading tokenizer... ")
 	start := time.Now()
 	tok, err := LoadTokenizer(modelDir + "/tokenizer")
 	if err != nil {
 		return nil, fmt.Errorf("tokenizer: %w", err)
 	}
 	p.tokenizer = tok
-	fmt.Printf("done (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "done (%v)\n", time.Since(start))
 
 	// Inspect and load CLIP
 	clipPath := onnxDir + "/clip_text_encoder.onnx"
-	fmt.Print("Loading CLIP ONNX... ")
+	fmt.Fprint(plog, "Loading CLIP ONNX... ")
 	start = time.Now()
 	clipInputs, clipOutputs, err := ort.GetInputOutputInfo(clipPath)
 	if err != nil {
 		return nil, fmt.Errorf("CLIP info: %w", err)
 	}
-	fmt.Printf("\n  CLIP inputs: ")
+	fmt.Fprintf(plog, "\n  CLIP inputs: ")
 	for _, in := range clipInputs {
-		fmt.Printf("%s(%v %v) ", in.Name, in.DataType, in.Dimensions)
+		fmt.Fprintf(plog, "%s(%v %v) ", in.Name, in.DataType, in.Dimensions)
 	}
-	fmt.Printf("\n  CLIP outputs: ")
+	fmt.Fprintf(plog, "\n  CLIP outputs: ")
 	clipOutNames := make([]string, len(clipOutputs))
 	for i, out := range clipOutputs {
-		fmt.Printf("%s(%v %v) ", out.Name, out.DataType, out.Dimensions)
+		fmt.Fprintf(plog, "%s(%v %v) ", out.Name, out.DataType, out.Dimensions)
 		clipOutNames[i] = out.Name
 	}
-	fmt.Println()
+	fmt.Fprintln(plog)
 	p.clipInputType = clipInputs[0].DataType
 
 	p.clipSession, err = ort.NewDynamicAdvancedSession(
@@ -142,29 +151,29 @@ func NewORTPipeline(onnxDir, modelDir, ortLibPath string) (*ORTPipeline, error)
 	if err != nil {
 		return nil, fmt.Errorf("CLIP session: %w", err)
 	}
-	fmt.Printf("  CLIP loaded (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "  CLIP loaded (%v)\n", time.Since(start))
 
 	// Inspect and load UNet
 	unetPath := onnxDir + "/unet.onnx"
-	fmt.Print("Loading UNet ONNX... ")
+	fmt.Fprint(plog, "Loading UNet ONNX... ")
 	start = time.Now()
 	unetInputs, unetOutputs, err := ort.GetInputOutputInfo(unetPath)
 	if err != nil {
 		return nil, fmt.Errorf("UNet info: %w", err)
 	}
-	fmt.Printf("\n  UNet inputs: ")
+	fmt.Fprintf(plog, "\n  UNet inputs: ")
 	unetInNames := make([]string, len(unetInputs))
 	for i, in := range unetInputs {
-		fmt.Printf("%s(%v %v) ", in.Name, in.DataType, in.Dimensions)
+		fmt.Fprintf(plog, "%s(%v %v) ", in.Name, in.DataType, in.Dimensions)
 		unetInNames[i] = in.Name
 	}
-	fmt.Printf("\n  UNet outputs: ")
+	fmt.Fprintf(plog, "\n  UNet outputs: ")
 	unetOutNames := make([]string, len(unetOutputs))
 	for i, out := range unetOutputs {
-		fmt.Printf("%s(%v %v) ", out.Name, out.DataType, out.Dimensions)
+		fmt.Fprintf(plog, "%s(%v %v) ", out.Name, out.DataType, out.Dimensions)
 		unetOutNames[i] = out.Name
 	}
-	fmt.Println()
+	fmt.Fprintln(plog)
 	// Find the sample input type (first input that isn't timestep)
 	for _, in := range unetInputs {
 		if in.Name == "sample" {
@@ -182,27 +191,27 @@ func NewORTPipeline(onnxDir, modelDir, ortLibPath string) (*ORTPipeline, error)
 	if err != nil {
 		return nil, fmt.Errorf("UNet session: %w", err)
 	}
-	fmt.Printf("  UNet loaded (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "  UNet loaded (%v)\n", time.Since(start))
 
 	// Inspect and load VAE
 	vaePath := onnxDir + "/vae_decoder.onnx"
-	fmt.Print("Loading VAE ONNX... ")
+	fmt.Fprint(plog, "Loading VAE ONNX... ")
 	start = time.Now()
 	vaeInputs, vaeOutputs, err := ort.GetInputOutputInfo(vaePath)
 	if err != nil {
 		return nil, fmt.Errorf("VAE info: %w", err)
 	}
-	fmt.Printf("\n  VAE inputs: ")
+	fmt.Fprintf(plog, "\n  VAE inputs: ")
 	for _, in := range vaeInputs {
-		fmt.Printf("%s(%v %v) ", in.Name, in.DataType, in.Dimensions)
+		fmt.Fprintf(plog, "%s(%v %v) ", in.Name, in.DataType, in.Dimensions)
 	}
-	fmt.Printf("\n  VAE outputs: ")
+	fmt.Fprintf(plog, "\n  VAE outputs: ")
 	vaeOutNames := make([]string, len(vaeOutputs))
 	for i, out := range vaeOutputs {
-		fmt.Printf("%s(%v %v) ", out.Name, out.DataType, out.Dimensions)
+		fmt.Fprintf(plog, "%s(%v %v) ", out.Name, out.DataType, out.Dimensions)
 		vaeOutNames[i] = out.Name
 	}
-	fmt.Println()
+	fmt.Fprintln(plog)
 	p.vaeInputType = vaeInputs[0].DataType
 
 	p.vaeSession, err = ort.NewDynamicAdvancedSession(
@@ -214,7 +223,7 @@ func NewORTPipeline(onnxDir, modelDir, ortLibPath string) (*ORTPipeline, error)
 	if err != nil {
 		return nil, fmt.Errorf("VAE session: %w", err)
 	}
-	fmt.Printf("  VAE loaded (%v)\n", time.Since(start))
+	fmt.Fprintf(plog, "  VAE loaded (%v)\n", time.Since(start))
 
 	p.scheduler = NewDDIMScheduler(1000, 0.00085, 0.012)
 
@@ -222,13 +231,16 @@ func NewORTPipeline(onnxDir, modelDir, ortLibPath string) (*ORTPipeline, error)
 }
 
 // Generate creates an image from a text prompt.
-func (p *ORTPipeline) Generate(prompt string, seed int64, numSteps, latentSize int, guidanceScale float32, outPath string) error {
-	fmt.Printf("\nPrompt: %q\n", prompt)
-	fmt.Printf("Seed: %d, Steps: %d, Guidance: %.1f, Latent: %dx%d\n",
+// progress (optional) is called after each scheduler step; ctx is checked
+// before each one.
+func (p *ORTPipeline) Generate(ctx context.Context, prompt string, seed int64, numSteps, latentSize int, guidanceScale float32, outPath string, progress func(step, total int)) error {
+	plog := pipelineOut(ctx)
+	fmt.Fprintf(plog, "\nPrompt: %q\n", prompt)
+	fmt.Fprintf(plog, "Seed: %d, Steps: %d, Guidance: %.1f, Latent: %dx%d\n",
 		seed, numSteps, guidanceScale, latentSize, latentSize)
 
 	// Phase 1: Text encoding
-	fmt.Print("\n--- Phase 1: Text Encoding ---\n")
+	fmt.Fprint(plog, "\n--- Phase 1: Text Encoding ---\n")
 	start := time.Now()
 
 	condTokens := p.tokenizer.Encode(prompt)
@@ -247,21 +259,24 @@ func (p *ORTPipeline) Generate(prompt string, seed int64, numSteps, latentSize i
 			return fmt.Errorf("uncond encoding: %w", err)
 		}
 	}
-	fmt.Printf("  Text encoding: %v (CFG=%v)\n", time.Since(start), useCFG)
+	fmt.Fprintf(plog, "  Text encoding: %v (CFG=%v)\n", time.Since(start), useCFG)
 	if len(condEmb) >= 3 {
-		fmt.Printf("  cond_emb[0][:3] = [%.4f, %.4f, %.4f]\n",
+		fmt.Fprintf(plog, "  cond_emb[0][:3] = [%.4f, %.4f, %.4f]\n",
 			condEmb[0], condEmb[1], condEmb[2])
 	}
 
 	// Phase 2: Diffusion
-	fmt.Print("\n--- Phase 2: Diffusion ---\n")
+	fmt.Fprint(plog, "\n--- Phase 2: Diffusion ---\n")
 	timesteps := p.scheduler.SetTimesteps(numSteps)
-	fmt.Printf("Timesteps (%d): [%d ... %d]\n", len(timesteps), timesteps[0], timesteps[len(timesteps)-1])
+	fmt.Fprintf(plog, "Timesteps (%d): [%d ... %d]\n", len(timesteps), timesteps[0], timesteps[len(timesteps)-1])
 
 	latent := makeNoise(1, 4, latentSize, latentSize, seed)
 
 	totalStart := time.Now()
 	for step, t := range timesteps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		stepStart := time.Now()
 
 		var noisePred []float32
@@ -274,10 +289,7 @@ func (p *ORTPipeline) Generate(prompt string, seed int64, numSteps, latentSize i
 			if err != nil {
 				return fmt.Errorf("unet cond step %d: %w", step, err)
 			}
-			noisePred = make([]float32, len(noiseUncond))
-			for i := range noisePred {
-				noisePred[i] = noiseUncond[i] + guidanceScale*(noiseCond[i]-noiseUncond[i])
-			}
+			noisePred = combineGuidance(noiseUncond, noiseCond, guidanceScale, guidanceRescale)
 		} else {
 			// No CFG — single UNet pass
 			noisePred, err = p.runUNet(latent, int64(t), condEmb, latentSize)
@@ -288,13 +300,16 @@ func (p *ORTPipeline) Generate(prompt string, seed int64, numSteps, latentSize i
 
 		latent = p.schedulerStep(noisePred, t, latent, latentSize)
 
-		fmt.Printf("  Step %d/%d (t=%d): %.1fs\n",
+		fmt.Fprintf(plog, "  Step %d/%d (t=%d): %.1fs\n",
 			step+1, numSteps, t, time.Since(stepStart).Seconds())
+		if progress != nil {
+			progress(step+1, numSteps)
+		}
 	}
-	fmt.Printf("\nDiffusion: %.1fs total\n", time.Since(totalStart).Seconds())
+	fmt.Fprintf(plog, "\nDiffusion: %.1fs total\n", time.Since(totalStart).Seconds())
 
 	// Phase 3: VAE Decode
-	fmt.Print("\n--- Phase 3: VAE Decoding ---\n")
+	fmt.Fprint(plog, "\n--- Phase 3: VAE Decoding ---\n")
 
 	scaledLatent := make([]float32, len(latent))
 	for i := range latent {
@@ -306,14 +321,15 @@ func (p *ORTPipeline) Generate(prompt string, seed int64, numSteps, latentSize i
 	if err != nil {
 		return fmt.Errorf("VAE decode: %w", err)
 	}
-	fmt.Printf("  VAE decode: %v\n", time.Since(start))
-	fmt.Printf("  Output: [1,3,%d,%d]\n", imgH, imgW)
+	fmt.Fprintf(plog, "  VAE decode: %v\n", time.Since(start))
+	fmt.Fprintf(plog, "  Output: [1,3,%d,%d]\n", imgH, imgW)
 
-	fmt.Printf("Saving %s... ", outPath)
-	if err := saveORTPNG(imgData, imgH, imgW, outPath); err != nil {
+	fmt.Fprintf(plog, "Saving %s... ", outPath)
+	meta := diffusionMeta(p.modelDir, prompt, seed, numSteps, guidanceScale)
+	if err := saveORTPNG(imgData, imgH, imgW, outPath, seed, meta); err != nil {
 		return fmt.Errorf("save: %w", err)
 	}
-	fmt.Println("done!")
+	fmt.Fprintln(plog, "done!")
 
 	return nil
 }
@@ -587,15 +603,16 @@ func makeNoise(n, c, h, w int, seed int64) []float32 {
 	return data
 }
 
-func saveORTPNG(data []float32, H, W int, path string) error {
+func saveORTPNG(data []float32, H, W int, path string, seed int64, meta map[string]string) error {
 	rgba := float32ToRGBA(data, H, W)
 
-	// Apply post-processing if yentWords available
+	// Apply post-processing if yentWords available (grain follows the seed)
 	if postProcessWords != "" {
-		rgba = PostProcess(rgba, postProcessWords)
+		rgba = PostProcessSeeded(rgba, postProcessWords, seed)
+		meta = postProcessedMeta(meta, postProcessWords)
 	}
 
-	return saveProcessedPNG(rgba, path)
+	return saveProcessedPNG(rgba, path, meta)
 }
 
 // Ensure unsafe is used (needed for potential future CGO interop)
@@ -0,0 +1,217 @@
+package main
+
+// pngmeta.go — tEXt metadata in generated PNGs
+//
+// image/png has no API for ancillary chunks, so encodePNG encodes normally
+// and splices text chunks in right after IHDR. Keys follow the lowercase
+// names most SD front-ends look for (prompt, seed, steps, ...). tEXt is
+// Latin-1 only, so values outside ASCII (Russian prompts) go into an
+// uncompressed iTXt chunk instead, which is UTF-8.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// diffusionMeta is the provenance recorded for a text2img/img2img run
+func diffusionMeta(modelDir, prompt string, seed int64, steps int, guidanceScale float32) map[string]string {
+	meta := map[string]string{
+		"prompt":   prompt,
+		"seed":     strconv.FormatInt(seed, 10),
+		"steps":    strconv.Itoa(steps),
+		"guidance": strconv.FormatFloat(float64(guidanceScale), 'f', -1, 32),
+		"Software": "yent.yo " + yentYoVersion,
+	}
+	if modelDir != "" {
+		meta["model"] = filepath.Base(modelDir)
+	}
+	if sigmaSchedule != SigmaLinear {
+		meta["sigma_schedule"] = sigmaSchedule
+	}
+	if guidanceRescale > 0 {
+		meta["guidance_rescale"] = strconv.FormatFloat(float64(guidanceRescale), 'f', -1, 32)
+	}
+	return meta
+}
+
+// backendMeta is the provenance recorded for an image b drew. Only the SD
+// pipeline has a model, steps and guidance worth recording; any other
+// backend gets its name next to the prompt and seed instead.
+func backendMeta(b DiffusionBackend, prompt string, seed int64, steps int, guidanceScale float32) map[string]string {
+	if p, ok := b.(pipelineBackend); ok {
+		return diffusionMeta(p.modelDir, prompt, seed, steps, guidanceScale)
+	}
+	return map[string]string{
+		"prompt":   prompt,
+		"seed":     strconv.FormatInt(seed, 10),
+		"backend":  b.Name(),
+		"Software": "yent.yo " + yentYoVersion,
+	}
+}
+
+// metaPostProcessed marks an image whose pixels went through PostProcess
+// after diffusion (value: the overlay words), so rerolls know not to start
+// from them
+const metaPostProcessed = "postprocessed"
+
+// postProcessedMeta is meta plus the metaPostProcessed mark for words,
+// leaving meta itself alone
+func postProcessedMeta(meta map[string]string, words string) map[string]string {
+	out := make(map[string]string, len(meta)+1)
+	for k, v := range meta {
+		out[k] = v
+	}
+	out[metaPostProcessed] = words
+	return out
+}
+
+// pngCompression is the zlib level encodePNG writes at (--png-compression).
+// BestSpeed keeps large images cheap in the request path; an --image-dir
+// archive can still be stored at BestCompression with
+// --image-dir-compression (DiskImageStore re-encodes).
+var pngCompression = png.DefaultCompression
+
+// pngCompressionLevels are the --png-compression values
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+	"none":    png.NoCompression,
+}
+
+// encodePNG writes img as PNG with one text chunk per meta entry (sorted by
+// key), at pngCompression
+func encodePNG(w io.Writer, img image.Image, meta map[string]string) error {
+	return encodePNGLevel(w, img, meta, pngCompression)
+}
+
+// encodePNGLevel is encodePNG at compression level
+func encodePNGLevel(w io.Writer, img image.Image, meta map[string]string, level png.CompressionLevel) error {
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: level}
+	if err := enc.Encode(&buf, img); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	if len(meta) == 0 {
+		_, err := w.Write(data)
+		return err
+	}
+
+	// Signature (8) + IHDR chunk (4 len + 4 type + 13 data + 4 crc)
+	ihdrEnd := len(pngSignature) + 25
+	if _, err := w.Write(data[:ihdrEnd]); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(k) == 0 || len(k) > 79 {
+			return fmt.Errorf("png text key %q: must be 1-79 bytes", k)
+		}
+		v := meta[k]
+		var err error
+		if isASCII(v) {
+			err = writePNGChunk(w, "tEXt", []byte(k+"\x00"+v))
+		} else {
+			// keyword, 0, compression flag, method, language "", translated keyword ""
+			err = writePNGChunk(w, "iTXt", []byte(k+"\x00\x00\x00\x00\x00"+v))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(data[ihdrEnd:])
+	return err
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	var tail [4]byte
+	binary.BigEndian.PutUint32(tail[:], crc.Sum32())
+
+	for _, b := range [][]byte{hdr[:], data, tail[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPNGMetadata returns the tEXt/iTXt key/value pairs of a PNG file
+func ReadPNGMetadata(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePNGText(data)
+}
+
+// parsePNGText walks the chunk list and collects tEXt and uncompressed iTXt entries
+func parsePNGText(data []byte) (map[string]string, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, fmt.Errorf("not a PNG")
+	}
+	meta := make(map[string]string)
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		end := pos + 8 + n + 4
+		if n < 0 || end > len(data) {
+			return nil, fmt.Errorf("truncated %s chunk", typ)
+		}
+		body := data[pos+8 : pos+8+n]
+		switch typ {
+		case "tEXt":
+			if i := bytes.IndexByte(body, 0); i > 0 {
+				meta[string(body[:i])] = string(body[i+1:])
+			}
+		case "iTXt":
+			// keyword 0 flag method lang 0 translated 0 text
+			parts := bytes.SplitN(body, []byte{0}, 2)
+			if len(parts) == 2 && len(parts[0]) > 0 && len(parts[1]) >= 2 && parts[1][0] == 0 {
+				rest := bytes.SplitN(parts[1][2:], []byte{0}, 3)
+				if len(rest) == 3 {
+					meta[string(parts[0])] = string(rest[2])
+				}
+			}
+		}
+		if typ == "IEND" {
+			break
+		}
+		pos = end
+	}
+	return meta, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPNGMetadataRoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.SetRGBA(1, 1, color.RGBA{200, 10, 10, 255})
+
+	meta := diffusionMeta("/models/bk-sdm-tiny", "a duck screaming at the void", 42, 10, 7.5)
+	meta["yent_words"] = "ненавижу уток"
+
+	path := filepath.Join(t.TempDir(), "meta.png")
+	if err := saveProcessedPNG(img, path, meta); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := ReadPNGMetadata(path)
+	if err != nil {
+		t.Fatalf("ReadPNGMetadata: %v", err)
+	}
+	for k, want := range map[string]string{
+		"prompt":     "a duck screaming at the void",
+		"seed":       "42",
+		"steps":      "10",
+		"model":      "bk-sdm-tiny",
+		"yent_words": "ненавижу уток",
+	} {
+		if got[k] != want {
+			t.Errorf("meta[%q] = %q, want %q", k, got[k], want)
+		}
+	}
+
+	// Chunks must not corrupt the image itself
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode with metadata: %v", err)
+	}
+	if r, _, _, _ := decoded.At(1, 1).RGBA(); r>>8 != 200 {
+		t.Errorf("pixel (1,1) red = %d, want 200", r>>8)
+	}
+}
+
+func TestReadPNGMetadataNotPNG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.png")
+	os.WriteFile(path, []byte("GIF89a"), 0644)
+	if _, err := ReadPNGMetadata(path); err == nil {
+		t.Error("expected error for non-PNG file")
+	}
+}
+
+func TestPNGCompressionLevels(t *testing.T) {
+	// A smooth gradient so the levels actually differ in size
+	tensor := NewTensor(1, 3, 64, 64)
+	for i := range tensor.Data {
+		tensor.Data[i] = float32(i%64)/32 - 1
+	}
+	sizes := map[string]int64{}
+	for name, level := range pngCompressionLevels {
+		path := filepath.Join(t.TempDir(), name+".png")
+		if err := savePNGLevel(tensor, path, 7, map[string]string{"seed": "7"}, level); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: not a decodable PNG: %v", name, err)
+			continue
+		}
+		if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 64 {
+			t.Errorf("%s: decoded %v, want 64x64", name, img.Bounds())
+		}
+		if meta, err := ReadPNGMetadata(path); err != nil || meta["seed"] != "7" {
+			t.Errorf("%s: metadata %v (%v)", name, meta, err)
+		}
+		st, _ := os.Stat(path)
+		sizes[name] = st.Size()
+	}
+	if sizes["none"] <= sizes["best"] {
+		t.Errorf("uncompressed %d bytes, best compression %d", sizes["none"], sizes["best"])
+	}
+}
+
+func BenchmarkEncodePNGLevels(b *testing.B) {
+	img := makeTestImage(512, 512)
+	for _, name := range []string{"none", "speed", "default", "best"} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				encodePNGLevel(io.Discard, img, nil, pngCompressionLevels[name])
+			}
+		})
+	}
+}
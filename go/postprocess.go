@@ -11,42 +11,155 @@ import (
 	"image/color"
 	"image/draw"
 	"image/png"
+	"io"
 	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
 	"golang.org/x/image/math/fixed"
 )
 
+// PostProcessOptions enables the optional passes on top of the base pipeline.
+// The zero value reproduces the classic yent.yo look.
+type PostProcessOptions struct {
+	ScanlineSpacing  int     // darken every Nth row (0 = off)
+	ScanlineDarkness float32 // how much scanline rows are dimmed [0, 1]
+	HalftoneCell     int     // halftone dot cell size in px (0 = off)
+	UpscaleMode      UpscaleMode
+	Sharpen          float32 // unsharp-mask amount after upscaling (0 = off)
+	SharpenRadius    float32 // blur radius in px for the mask (0 → 1)
+	OverlayAlpha     float32 // opacity the ASCII ink adds over transparent pixels (0 = keep source alpha)
+	CharRamp         []rune  // ASCII overlay glyph ramp, light to dark (empty = asciiChars)
+	Braille          bool    // clean zones use 2x4 Braille dots instead of the glyph ramp
+	Gradient         GradientOperator
+	Bloom            float32      // glow strength around highlights (0 = off)
+	BloomThreshold   uint8        // luminance a pixel needs to glow (0 → 200)
+	BloomRadius      int          // glow blur radius in px (0 → 6)
+	Saturation       float32      // saturation change: -1 = grayscale, 0 = unchanged, 1 = doubled
+	Contrast         float32      // contrast change around mid-gray: -1 = flat gray, 0 = unchanged, 1 = doubled
+	DuotoneShadow    color.RGBA   // duotone color for black (with DuotoneHighlight; both zero = off)
+	DuotoneHighlight color.RGBA   // duotone color for white
+	ColorLUT         []color.RGBA // 256-entry luminance → color grade (nil = off; overrides duotone)
+	LensDistortion   float32      // radial warp k: >0 barrel, <0 pincushion (0 = off; ~0.1–0.3 is subtle)
+	ASCIIThreshold   float32      // artifact score below which ASCII leaves the image alone (0 = covers everything, the classic look)
+	ASCIIAlpha       float32      // ASCII opacity at the strongest artifacts (0 → 0.90, reduced for dense images)
+	Caption          CaptionPlacement
+	CaptionMaxLines  int // lines the caption may wrap to before "..." (0 → 3)
+}
+
+// CaptionPlacement puts Yent's words on the ASCII layer as readable text,
+// word-wrapped to the grid width, on top of the artifact-zone stream
+type CaptionPlacement string
+
+const (
+	CaptionOff    CaptionPlacement = "" // words only as texture in artifact zones
+	CaptionTop    CaptionPlacement = "top"
+	CaptionCenter CaptionPlacement = "center"
+	CaptionBottom CaptionPlacement = "bottom"
+)
+
+// GradientOperator selects the edge filter behind the artifact score
+type GradientOperator string
+
+const (
+	GradientCentral GradientOperator = ""      // central difference (default, noise-sensitive)
+	GradientSobel   GradientOperator = "sobel" // 3x3 Sobel: smoothed across the edge, steadier map
+)
+
+// UpscaleMode selects the resampler used when scaling up for display
+type UpscaleMode string
+
+const (
+	UpscaleDefault  UpscaleMode = ""         // bilinear score map, nearest-neighbor image
+	UpscaleBilinear UpscaleMode = "bilinear" // bilinear everywhere
+	UpscaleBicubic  UpscaleMode = "bicubic"  // Catmull-Rom everywhere (sharper)
+)
+
 // PostProcess applies the full yent.yo post-processing pipeline.
 // Takes raw VAE output (image.RGBA) + Yent's words → processed image with grain, ASCII, effects.
+// The grain is seeded from the clock; see PostProcessSeeded.
 func PostProcess(img *image.RGBA, yentWords string) *image.RGBA {
+	return PostProcessWithOptions(img, yentWords, PostProcessOptions{})
+}
+
+// PostProcessSeeded is PostProcess with the grain seeded by seed, so the
+// same image, words and seed always give the same output. Seed 42 is the
+// grain the pipeline used before it was seedable.
+func PostProcessSeeded(img *image.RGBA, yentWords string, seed int64) *image.RGBA {
+	return postProcess(img, yentWords, PostProcessOptions{}, seed, nil)
+}
+
+// PostProcessWithOptions runs the pipeline with optional poster/CRT passes.
+func PostProcessWithOptions(img *image.RGBA, yentWords string, opts PostProcessOptions) *image.RGBA {
+	return postProcess(img, yentWords, opts, time.Now().UnixNano(), nil)
+}
+
+// PostProcessDebug runs PostProcess and writes the image after each stage
+// into dir (created if needed): 00_input, 01_grain, 02_aberration,
+// 03_vignette and 04_ascii (the bare ASCII layer), all .png. Returns the
+// final image and the first write error.
+func PostProcessDebug(img *image.RGBA, yentWords, dir string) (*image.RGBA, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var firstErr error
+	out := postProcess(img, yentWords, PostProcessOptions{}, time.Now().UnixNano(), func(stage string, img *image.RGBA) {
+		if err := saveProcessedPNG(img, filepath.Join(dir, stage+".png"), nil); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	})
+	return out, firstErr
+}
+
+// postProcess is the pipeline; seed drives every random pass, and dump
+// (optional) sees the image after each named stage and must not modify it
+func postProcess(img *image.RGBA, yentWords string, opts PostProcessOptions, seed int64, dump func(stage string, img *image.RGBA)) *image.RGBA {
+	if dump == nil {
+		dump = func(string, *image.RGBA) {}
+	}
+	dump("00_input", img)
+
 	bounds := img.Bounds()
 	W, H := bounds.Dx(), bounds.Dy()
 	fmt.Fprintf(os.Stderr, "[postprocess] %dx%d, words=%q\n", W, H, truncate(yentWords, 60))
 
 	// Step 1: Artifact score map
-	scoreMap := computeArtifactScore(img)
+	scoreMap := computeArtifactScoreWith(img, opts.Gradient)
 	meanScore := meanFloat32(scoreMap)
 	highPct := countAbove(scoreMap, 0.5) * 100
 	fmt.Fprintf(os.Stderr, "[postprocess] score: mean=%.2f, high-artifact=%.1f%%\n", meanScore, highPct)
 
 	// Step 2: First grain pass (depth layer under ASCII)
 	grained := cloneRGBA(img)
-	applyFilmGrain(grained, 22, 42)
+	applyFilmGrain(grained, 22, seed)
+	dump("01_grain", grained)
+
+	// Optional: halftone dots on the base layer (poster look under the ASCII)
+	if opts.HalftoneCell > 1 {
+		applyHalftone(grained, opts.HalftoneCell)
+	}
 
 	// Step 3: Render ASCII layer
-	asciiLayer := renderASCIILayer(img, yentWords, scoreMap)
+	asciiLayer := renderASCIILayer(img, yentWords, scoreMap, opts)
+	dump("04_ascii", asciiLayer)
 
 	// Step 4: Blend — ASCII only where artifacts live
 	asciiMax := float32(0.90)
 	scorePower := float32(3.0)
+	if opts.ASCIIAlpha > 0 {
+		asciiMax = min(opts.ASCIIAlpha, 1)
+	}
 
 	// Adaptive: dense images get less text so the image shows through
-	if meanScore > 0.45 {
+	if meanScore > 0.45 && opts.ASCIIAlpha == 0 {
 		excess := meanScore - 0.45
 		asciiMax = max32(0.30, asciiMax-excess*2.0)
 		scorePower = max32(2.5, scorePower+excess*3.5)
@@ -55,38 +168,93 @@ func PostProcess(img *image.RGBA, yentWords string) *image.RGBA {
 
 	// Resize grained to match ASCII layer dimensions
 	aw, ah := asciiLayer.Bounds().Dx(), asciiLayer.Bounds().Dy()
-	grainedResized := resizeRGBA(grained, aw, ah)
-	scoreResized := bilinearUpscale(scoreMap, W, H, aw, ah)
+	var grainedResized *image.RGBA
+	if opts.UpscaleMode == UpscaleDefault {
+		grainedResized = resizeRGBA(grained, aw, ah)
+	} else {
+		grainedResized = resampleRGBA(grained, aw, ah, opts.UpscaleMode)
+	}
+	scoreResized := upscaleFloat32(scoreMap, W, H, aw, ah, opts.UpscaleMode)
+	if opts.Sharpen > 0 {
+		radius := opts.SharpenRadius
+		if radius <= 0 {
+			radius = 1
+		}
+		applySharpen(grainedResized, opts.Sharpen, radius)
+	}
 
 	// Composite blend
 	composite := image.NewRGBA(image.Rect(0, 0, aw, ah))
-	asciiFloor := float32(0.05)
+	blendMap := asciiBlendMap(scoreResized, opts.ASCIIThreshold, asciiMax, scorePower)
 	for y := 0; y < ah; y++ {
 		for x := 0; x < aw; x++ {
-			score := scoreResized[y*aw+x]
-			blend := asciiFloor + pow32(score, scorePower)*(asciiMax-asciiFloor)
+			blend := blendMap[y*aw+x]
 
 			gi := grainedResized.RGBAAt(x, y)
 			ai := asciiLayer.RGBAAt(x, y)
 
-			r := float32(gi.R)*(1-blend) + float32(ai.R)*blend
-			g := float32(gi.G)*(1-blend) + float32(ai.G)*blend
-			b := float32(gi.B)*(1-blend) + float32(ai.B)*blend
+			// Alpha comes from the source; OverlayAlpha lets the ASCII ink
+			// add its own opacity over transparent regions.
+			a := float32(gi.A)
+			if opts.OverlayAlpha > 0 {
+				a += (255 - a) * blend * opts.OverlayAlpha
+			}
+			// ASCII layer is opaque — premultiply it by the output alpha
+			inkScale := a / 255
 
-			composite.SetRGBA(x, y, color.RGBA{
-				R: clamp8(r), G: clamp8(g), B: clamp8(b), A: 255,
-			})
+			r := float32(gi.R)*(1-blend) + float32(ai.R)*inkScale*blend
+			g := float32(gi.G)*(1-blend) + float32(ai.G)*inkScale*blend
+			b := float32(gi.B)*(1-blend) + float32(ai.B)*inkScale*blend
+
+			composite.SetRGBA(x, y, premulRGBA(r, g, b, clamp8(a)))
+		}
+	}
+
+	// Optional: color grading
+	if opts.Saturation != 0 {
+		adjustSaturation(composite, 1+opts.Saturation)
+	}
+	if opts.Contrast != 0 {
+		adjustContrast(composite, 1+opts.Contrast)
+	}
+	if len(opts.ColorLUT) == 256 {
+		applyColorLUT(composite, opts.ColorLUT)
+	} else if opts.DuotoneShadow != (color.RGBA{}) || opts.DuotoneHighlight != (color.RGBA{}) {
+		applyDuotone(composite, opts.DuotoneShadow, opts.DuotoneHighlight)
+	}
+
+	// Optional: glow around the highlights
+	if opts.Bloom > 0 {
+		threshold, radius := opts.BloomThreshold, opts.BloomRadius
+		if threshold == 0 {
+			threshold = 200
+		}
+		if radius <= 0 {
+			radius = 6
 		}
+		applyBloom(composite, threshold, opts.Bloom, radius)
+	}
+
+	// Optional: lens warp (before the aberration, which belongs to the lens too)
+	if opts.LensDistortion != 0 {
+		applyLensDistortion(composite, opts.LensDistortion)
 	}
 
 	// Step 5: Chromatic aberration
 	applyChromaticAberration(composite, 2)
+	dump("02_aberration", composite)
 
 	// Step 6: Vignette
 	applyVignette(composite, 0.30)
+	dump("03_vignette", composite)
 
-	// Step 7: Second grain pass (lighter, bonds layers)
-	applyFilmGrain(composite, 15, 137)
+	// Optional: CRT scanlines
+	if opts.ScanlineSpacing > 0 && opts.ScanlineDarkness > 0 {
+		applyScanlines(composite, opts.ScanlineSpacing, opts.ScanlineDarkness)
+	}
+
+	// Step 7: Second grain pass (lighter, bonds layers), its own noise
+	applyFilmGrain(composite, 15, seed+secondGrainOffset)
 
 	asciiVisible := countAbove(scoreResized, 0.1) * 100
 	fmt.Fprintf(os.Stderr, "[postprocess] ASCII visible: %.0f%% of image\n", asciiVisible)
@@ -94,71 +262,122 @@ func PostProcess(img *image.RGBA, yentWords string) *image.RGBA {
 	return composite
 }
 
+// asciiFloor is the ASCII opacity over clean regions the overlay covers
+const asciiFloor = float32(0.05)
+
+// asciiBlendMap is the per-pixel ASCII opacity for an artifact score map:
+// from asciiFloor up to asciiMax along score^power, and 0 wherever the
+// score is under threshold.
+func asciiBlendMap(scores []float32, threshold, asciiMax, power float32) []float32 {
+	blend := make([]float32, len(scores))
+	for i, score := range scores {
+		if score < threshold {
+			continue
+		}
+		blend[i] = asciiFloor + pow32(score, power)*(asciiMax-asciiFloor)
+	}
+	return blend
+}
+
+// secondGrainOffset separates the final grain pass's seed from the first
+// (42 → 137, the pair the pipeline was tuned with)
+const secondGrainOffset = 95
+
 // ═══════════════════════════════════════════════════════════════
 // Artifact Detection
 // ═══════════════════════════════════════════════════════════════
 
-// computeGradient computes Sobel-like gradient magnitude on grayscale
+// computeGradient computes central-difference gradient magnitude on grayscale
 func computeGradient(gray []float32, W, H int) []float32 {
+	return computeGradientWith(gray, W, H, GradientCentral)
+}
+
+// computeGradientWith computes gradient magnitude with the given operator.
+// Sobel is scaled by 1/4 so a linear ramp gives the same magnitude under
+// both. Border pixels stay 0.
+func computeGradientWith(gray []float32, W, H int, op GradientOperator) []float32 {
 	mag := make([]float32, W*H)
-	for y := 1; y < H-1; y++ {
-		for x := 1; x < W-1; x++ {
-			gx := gray[y*W+x+1] - gray[y*W+x-1]
-			gy := gray[(y+1)*W+x] - gray[(y-1)*W+x]
-			mag[y*W+x] = float32(math.Sqrt(float64(gx*gx + gy*gy)))
+	parallelRows(1, H-1, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 1; x < W-1; x++ {
+				var gx, gy float32
+				if op == GradientSobel {
+					up, mid, down := (y-1)*W+x, y*W+x, (y+1)*W+x
+					gx = (gray[up+1] + 2*gray[mid+1] + gray[down+1] -
+						gray[up-1] - 2*gray[mid-1] - gray[down-1]) / 4
+					gy = (gray[down-1] + 2*gray[down] + gray[down+1] -
+						gray[up-1] - 2*gray[up] - gray[up+1]) / 4
+				} else {
+					gx = gray[y*W+x+1] - gray[y*W+x-1]
+					gy = gray[(y+1)*W+x] - gray[(y-1)*W+x]
+				}
+				mag[y*W+x] = float32(math.Sqrt(float64(gx*gx + gy*gy)))
+			}
 		}
-	}
+	})
 	return mag
 }
 
 // computeArtifactScore returns per-pixel artifact score [0, 1]
 // 0 = clean/detailed, 1 = smooth/artifact
 func computeArtifactScore(img *image.RGBA) []float32 {
+	return computeArtifactScoreWith(img, GradientCentral)
+}
+
+// artifactBlockSize is the side of the variance blocks behind the artifact
+// score: 12px, shrunk for small images so the short side still spans about
+// 8 blocks (never below 2px). 0 for an empty image.
+func artifactBlockSize(W, H int) int {
+	short := min(W, H)
+	if short <= 0 {
+		return 0
+	}
+	return min(12, max(short/8, 2))
+}
+
+// computeArtifactScoreWith is computeArtifactScore over op's gradient
+func computeArtifactScoreWith(img *image.RGBA, op GradientOperator) []float32 {
 	bounds := img.Bounds()
 	W, H := bounds.Dx(), bounds.Dy()
-	blockSize := 12
 
-	// Convert to grayscale
-	gray := make([]float32, W*H)
-	for y := 0; y < H; y++ {
-		for x := 0; x < W; x++ {
-			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
-			gray[y*W+x] = 0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)
-		}
-	}
+	gray := grayPlane(img)
 
 	// Gradient magnitude
-	grad := computeGradient(gray, W, H)
+	grad := computeGradientWith(gray, W, H, op)
 
-	// Block-wise variance and brightness
-	blocksH := H / blockSize
-	blocksW := W / blockSize
-	if blocksH == 0 || blocksW == 0 {
+	// Block-wise variance and brightness. Edge blocks take the leftover
+	// pixels when W or H isn't a multiple of blockSize.
+	blockSize := artifactBlockSize(W, H)
+	if blockSize == 0 {
 		return make([]float32, W*H)
 	}
+	blocksW := (W + blockSize - 1) / blockSize
+	blocksH := (H + blockSize - 1) / blockSize
 
 	varMap := make([]float32, blocksH*blocksW)
 	brightMap := make([]float32, blocksH*blocksW)
 
-	for by := 0; by < blocksH; by++ {
-		for bx := 0; bx < blocksW; bx++ {
-			var sum, sumSq, brightSum float32
-			n := float32(blockSize * blockSize)
-			for dy := 0; dy < blockSize; dy++ {
-				for dx := 0; dx < blockSize; dx++ {
-					y := by*blockSize + dy
-					x := bx*blockSize + dx
-					v := grad[y*W+x]
-					sum += v
-					sumSq += v * v
-					brightSum += gray[y*W+x]
+	parallelRows(0, blocksH, func(by0, by1 int) {
+		for by := by0; by < by1; by++ {
+			yEnd := min((by+1)*blockSize, H)
+			for bx := 0; bx < blocksW; bx++ {
+				xEnd := min((bx+1)*blockSize, W)
+				var sum, sumSq, brightSum float32
+				n := float32((yEnd - by*blockSize) * (xEnd - bx*blockSize))
+				for y := by * blockSize; y < yEnd; y++ {
+					for x := bx * blockSize; x < xEnd; x++ {
+						v := grad[y*W+x]
+						sum += v
+						sumSq += v * v
+						brightSum += gray[y*W+x]
+					}
 				}
+				mean := sum / n
+				varMap[by*blocksW+bx] = sumSq/n - mean*mean
+				brightMap[by*blocksW+bx] = brightSum / n
 			}
-			mean := sum / n
-			varMap[by*blocksW+bx] = sumSq/n - mean*mean
-			brightMap[by*blocksW+bx] = brightSum / n
 		}
-	}
+	})
 
 	// Percentile-based normalization on lit blocks
 	minBrightness := float32(25)
@@ -205,9 +424,11 @@ func computeArtifactScore(img *image.RGBA) []float32 {
 	boxBlur(scorePx, W, H, radius)
 
 	// Power curve — push low scores lower
-	for i := range scorePx {
-		scorePx[i] = pow32(scorePx[i], 1.8)
-	}
+	parallelRows(0, H, func(y0, y1 int) {
+		for i := y0 * W; i < y1*W; i++ {
+			scorePx[i] = pow32(scorePx[i], 1.8)
+		}
+	})
 
 	return scorePx
 }
@@ -216,29 +437,44 @@ func computeArtifactScore(img *image.RGBA) []float32 {
 // Effects
 // ═══════════════════════════════════════════════════════════════
 
-// applyFilmGrain adds film grain with shadow bias (in-place)
+// applyFilmGrain adds film grain with shadow bias (in-place). Each pixel's
+// noise is a hash of (seed, x, y) in image coordinates, so the grain doesn't
+// depend on worker count, and a SubImage (crop or tile) gets exactly the
+// grain of that region of the full image.
 func applyFilmGrain(img *image.RGBA, intensity float32, seed int64) {
 	bounds := img.Bounds()
 	W, H := bounds.Dx(), bounds.Dy()
-	rng := rand.New(rand.NewSource(seed))
 
-	for y := 0; y < H; y++ {
-		for x := 0; x < W; x++ {
-			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
-			lum := (0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)) / 255.0
-			shadowMask := 1.0 - lum*0.4
+	parallelRows(0, H, func(y0, y1 int) {
+		for y := y0 + bounds.Min.Y; y < y1+bounds.Min.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Min.X+W; x++ {
+				c := img.RGBAAt(x, y)
+				lum := (0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)) / 255.0
+				shadowMask := 1.0 - lum*0.4
 
-			// Box-Muller gaussian noise
-			n := gaussNoise(rng) * intensity * shadowMask
+				n := pixelNoise(seed, x, y) * intensity * shadowMask
 
-			img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y, color.RGBA{
-				R: clamp8(float32(c.R) + n),
-				G: clamp8(float32(c.G) + n),
-				B: clamp8(float32(c.B) + n),
-				A: 255,
-			})
+				img.SetRGBA(x, y, premulRGBA(float32(c.R)+n, float32(c.G)+n, float32(c.B)+n, c.A))
+			}
 		}
-	}
+	})
+}
+
+// pixelNoise is standard gaussian noise for pixel (x, y): Box-Muller over
+// two uniforms hashed from seed and the position
+func pixelNoise(seed int64, x, y int) float32 {
+	h := splitmix64(uint64(seed) ^ splitmix64(uint64(uint32(x))<<32|uint64(uint32(y))))
+	u1 := float64(h>>11+1) / (1 << 53) // (0, 1]: log stays finite
+	u2 := float64(splitmix64(h)>>11) / (1 << 53)
+	return float32(math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2))
+}
+
+// splitmix64 is the SplitMix64 finalizer: a cheap, well-mixed 64-bit hash
+func splitmix64(z uint64) uint64 {
+	z += 0x9E3779B97F4A7C15
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	return z ^ z>>31
 }
 
 // applyChromaticAberration shifts R right and B left (in-place)
@@ -271,16 +507,64 @@ func applyChromaticAberration(img *image.RGBA, shift int) {
 			if bx >= W {
 				bx = W - 1
 			}
-			img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y, color.RGBA{
-				R: red[y*W+rx],
-				G: c.G,
-				B: blue[y*W+bx],
-				A: 255,
-			})
+			img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y,
+				premulRGBA(float32(red[y*W+rx]), float32(c.G), float32(blue[y*W+bx]), c.A))
 		}
 	}
 }
 
+// applyLensDistortion warps the image radially about its center (in-place).
+// Each output pixel samples the source at d·(1 + k·r²), where d is its
+// offset from the center and r that offset over the half-diagonal, so k > 0
+// pulls content toward the center (barrel) and k < 0 pushes it out
+// (pincushion). Bilinear sampling; samples past the edge clamp to it.
+func applyLensDistortion(img *image.RGBA, k float32) {
+	if k == 0 {
+		return
+	}
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+	src := cloneRGBA(img)
+	sb := src.Bounds()
+	cx, cy := float32(W-1)/2, float32(H-1)/2
+	norm := cx*cx + cy*cy
+	if norm == 0 {
+		return
+	}
+
+	at := func(x, y int) color.RGBA {
+		x = min(max(x, 0), W-1)
+		y = min(max(y, 0), H-1)
+		return src.RGBAAt(x+sb.Min.X, y+sb.Min.Y)
+	}
+
+	parallelRows(0, H, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < W; x++ {
+				dx, dy := float32(x)-cx, float32(y)-cy
+				scale := 1 + k*(dx*dx+dy*dy)/norm
+				sx, sy := cx+dx*scale, cy+dy*scale
+
+				ix, iy := int(math.Floor(float64(sx))), int(math.Floor(float64(sy)))
+				fx, fy := sx-float32(ix), sy-float32(iy)
+				c00, c10 := at(ix, iy), at(ix+1, iy)
+				c01, c11 := at(ix, iy+1), at(ix+1, iy+1)
+				mix := func(a, b, c, d uint8) float32 {
+					top := float32(a) + fx*(float32(b)-float32(a))
+					bot := float32(c) + fx*(float32(d)-float32(c))
+					return top + fy*(bot-top)
+				}
+				alpha := clamp8(mix(c00.A, c10.A, c01.A, c11.A) + 0.5)
+				img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y, premulRGBA(
+					mix(c00.R, c10.R, c01.R, c11.R)+0.5,
+					mix(c00.G, c10.G, c01.G, c11.G)+0.5,
+					mix(c00.B, c10.B, c01.B, c11.B)+0.5,
+					alpha))
+			}
+		}
+	})
+}
+
 // applyVignette darkens edges with radial falloff (in-place)
 func applyVignette(img *image.RGBA, strength float32) {
 	bounds := img.Bounds()
@@ -300,21 +584,317 @@ func applyVignette(img *image.RGBA, strength float32) {
 				R: clamp8(float32(c.R) * mult),
 				G: clamp8(float32(c.G) * mult),
 				B: clamp8(float32(c.B) * mult),
-				A: 255,
+				A: c.A,
 			})
 		}
 	}
 }
 
+// applyScanlines darkens every Nth row like a CRT (in-place)
+func applyScanlines(img *image.RGBA, spacing int, darkness float32) {
+	if spacing <= 0 {
+		return
+	}
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+	mult := 1.0 - darkness
+	if mult < 0 {
+		mult = 0
+	}
+
+	for y := 0; y < H; y += spacing {
+		for x := 0; x < W; x++ {
+			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+			img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y, color.RGBA{
+				R: clamp8(float32(c.R) * mult),
+				G: clamp8(float32(c.G) * mult),
+				B: clamp8(float32(c.B) * mult),
+				A: c.A,
+			})
+		}
+	}
+}
+
+// applyHalftone renders each cell as an ink dot on paper (in-place).
+// Paper is the cell's mean color at full brightness, the dot is black,
+// and the dot area is chosen so the cell keeps its mean luminance.
+func applyHalftone(img *image.RGBA, cellSize int) {
+	if cellSize <= 1 {
+		return
+	}
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+
+	for cy := 0; cy < H; cy += cellSize {
+		for cx := 0; cx < W; cx += cellSize {
+			cw := min(cellSize, W-cx)
+			ch := min(cellSize, H-cy)
+
+			// Mean color of the cell
+			var sr, sg, sb float32
+			for y := cy; y < cy+ch; y++ {
+				for x := cx; x < cx+cw; x++ {
+					c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+					sr += float32(c.R)
+					sg += float32(c.G)
+					sb += float32(c.B)
+				}
+			}
+			n := float32(cw * ch)
+			mr, mg, mb := sr/n, sg/n, sb/n
+			lum := 0.299*mr + 0.587*mg + 0.114*mb
+
+			// Paper: same hue, pushed to full brightness
+			peak := max32(mr, max32(mg, mb))
+			var pr, pg, pb, paperLum float32
+			if peak > 0 {
+				k := 255 / peak
+				pr, pg, pb = mr*k, mg*k, mb*k
+				paperLum = 0.299*pr + 0.587*pg + 0.114*pb
+			}
+
+			// Ink coverage so that (1 - coverage) * paperLum = lum
+			var coverage float32 = 1
+			if paperLum > 0 {
+				coverage = 1 - lum/paperLum
+			}
+			radius := float32(math.Sqrt(float64(coverage*n) / math.Pi))
+			centerX := float32(cx) + float32(cw)/2
+			centerY := float32(cy) + float32(ch)/2
+
+			for y := cy; y < cy+ch; y++ {
+				for x := cx; x < cx+cw; x++ {
+					dx := float32(x) + 0.5 - centerX
+					dy := float32(y) + 0.5 - centerY
+					dist := float32(math.Sqrt(float64(dx*dx + dy*dy)))
+					// Anti-aliased dot edge
+					ink := radius - dist + 0.5
+					if ink < 0 {
+						ink = 0
+					}
+					if ink > 1 {
+						ink = 1
+					}
+					c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+					img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y,
+						premulRGBA(pr*(1-ink), pg*(1-ink), pb*(1-ink), c.A))
+				}
+			}
+		}
+	}
+}
+
+// applySharpen applies unsharp masking: out = in + amount*(in - blur(in)) (in-place).
+// The blur never samples outside the image, so flat edges stay flat.
+func applySharpen(img *image.RGBA, amount, radius float32) {
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+	r := int(radius + 0.5)
+	if r < 1 {
+		r = 1
+	}
+
+	var planes [3][]float32
+	for c := range planes {
+		planes[c] = make([]float32, W*H)
+	}
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+			planes[0][y*W+x] = float32(c.R)
+			planes[1][y*W+x] = float32(c.G)
+			planes[2][y*W+x] = float32(c.B)
+		}
+	}
+
+	var blurred [3][]float32
+	for c := range planes {
+		blurred[c] = make([]float32, W*H)
+		copy(blurred[c], planes[c])
+		boxBlur(blurred[c], W, H, r)
+	}
+
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			i := y*W + x
+			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+			img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y, premulRGBA(
+				planes[0][i]+amount*(planes[0][i]-blurred[0][i]),
+				planes[1][i]+amount*(planes[1][i]-blurred[1][i]),
+				planes[2][i]+amount*(planes[2][i]-blurred[2][i]),
+				c.A))
+		}
+	}
+}
+
+// applyBloom makes highlights glow (in-place): pixels with luminance above
+// threshold are box-blurred over radius and added back times intensity.
+// Pixels further than radius from any highlight are left untouched.
+func applyBloom(img *image.RGBA, threshold uint8, intensity float32, radius int) {
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+
+	var glow [3][]float32
+	for c := range glow {
+		glow[c] = make([]float32, W*H)
+	}
+	lit := false
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+			lum := 0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)
+			if lum > float32(threshold) {
+				glow[0][y*W+x] = float32(c.R)
+				glow[1][y*W+x] = float32(c.G)
+				glow[2][y*W+x] = float32(c.B)
+				lit = true
+			}
+		}
+	}
+	if !lit {
+		return
+	}
+	for c := range glow {
+		boxBlur(glow[c], W, H, radius)
+	}
+
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			i := y*W + x
+			if glow[0][i] == 0 && glow[1][i] == 0 && glow[2][i] == 0 {
+				continue
+			}
+			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+			img.SetRGBA(x+bounds.Min.X, y+bounds.Min.Y, premulRGBA(
+				float32(c.R)+intensity*glow[0][i],
+				float32(c.G)+intensity*glow[1][i],
+				float32(c.B)+intensity*glow[2][i],
+				c.A))
+		}
+	}
+}
+
+// adjustSaturation scales each pixel's distance from its own luminance by
+// factor (in-place): 0 gives grayscale, 1 is a no-op, >1 is more vivid.
+// Luminance is preserved up to clamping.
+func adjustSaturation(img *image.RGBA, factor float32) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			lum := 0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)
+			img.SetRGBA(x, y, premulRGBA(
+				lum+factor*(float32(c.R)-lum),
+				lum+factor*(float32(c.G)-lum),
+				lum+factor*(float32(c.B)-lum),
+				c.A))
+		}
+	}
+}
+
+// adjustContrast scales each channel's distance from mid-gray by factor
+// (in-place): 0 gives flat gray, 1 is a no-op, >1 is punchier. Mid-gray is
+// taken at the pixel's alpha, since channels are premultiplied.
+func adjustContrast(img *image.RGBA, factor float32) {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			mid := 128 * float32(c.A) / 255
+			img.SetRGBA(x, y, premulRGBA(
+				mid+factor*(float32(c.R)-mid),
+				mid+factor*(float32(c.G)-mid),
+				mid+factor*(float32(c.B)-mid),
+				c.A))
+		}
+	}
+}
+
+// applyDuotone maps luminance onto the shadow → highlight gradient
+// (in-place): black becomes shadow, white becomes highlight. Alpha is kept;
+// the colors' own alpha is ignored.
+func applyDuotone(img *image.RGBA, shadow, highlight color.RGBA) {
+	applyColorLUT(img, duotoneLUT(shadow, highlight))
+}
+
+// duotoneLUT is the 256-step linear gradient from shadow to highlight
+func duotoneLUT(shadow, highlight color.RGBA) []color.RGBA {
+	lerp := func(a, b uint8, t float32) uint8 {
+		return clamp8(float32(a) + t*(float32(b)-float32(a)) + 0.5)
+	}
+	lut := make([]color.RGBA, 256)
+	for i := range lut {
+		t := float32(i) / 255
+		lut[i] = color.RGBA{
+			R: lerp(shadow.R, highlight.R, t),
+			G: lerp(shadow.G, highlight.G, t),
+			B: lerp(shadow.B, highlight.B, t),
+			A: 255,
+		}
+	}
+	return lut
+}
+
+// applyColorLUT replaces each pixel with lut[luminance] (in-place). lut
+// must have 256 entries of straight (non-premultiplied) color; the result
+// is premultiplied by the pixel's alpha.
+func applyColorLUT(img *image.RGBA, lut []color.RGBA) {
+	if len(lut) != 256 {
+		return
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+			// Un-premultiply so a translucent pixel grades by its true tone
+			a := float32(c.A) / 255
+			lum := (0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)) / a
+			g := lut[clamp8(lum+0.5)]
+			img.SetRGBA(x, y, premulRGBA(float32(g.R)*a, float32(g.G)*a, float32(g.B)*a, c.A))
+		}
+	}
+}
+
 // ═══════════════════════════════════════════════════════════════
 // ASCII Layer Rendering
 // ═══════════════════════════════════════════════════════════════
 
 // ASCII charset — light to dark
-var asciiChars = " .'·:;~=+*#%@"
+var asciiChars = []rune(" .'·:;~=+*#%@")
 
-// renderASCIILayer creates the ASCII art overlay image
-func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.RGBA {
+// Smallest ASCII grid; smaller images are scaled up uniformly to reach it
+const (
+	minASCIICols = 20
+	minASCIIRows = 15
+)
+
+// asciiGrid sizes the character grid for a srcW x srcH image: one cell per
+// charW x charH pixels, scaled up uniformly when that would be under
+// minASCIICols x minASCIIRows, so the overlay keeps the image's aspect
+// (to within one cell) whatever its shape.
+func asciiGrid(srcW, srcH, charW, charH int) (cols, rows int) {
+	scale := 1.0
+	if s := float64(minASCIICols*charW) / float64(srcW); s > scale {
+		scale = s
+	}
+	if s := float64(minASCIIRows*charH) / float64(srcH); s > scale {
+		scale = s
+	}
+	cols = int(math.Round(float64(srcW) * scale / float64(charW)))
+	rows = int(math.Round(float64(srcH) * scale / float64(charH)))
+	return max(cols, minASCIICols), max(rows, minASCIIRows)
+}
+
+// renderASCIILayer creates the ASCII art overlay image.
+// Uses opts.CharRamp (or asciiChars) for clean zones, or Braille dots if opts.Braille.
+func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32, opts PostProcessOptions) *image.RGBA {
+	ramp := opts.CharRamp
+	if len(ramp) == 0 {
+		ramp = asciiChars
+	}
 	bounds := img.Bounds()
 	srcW, srcH := bounds.Dx(), bounds.Dy()
 
@@ -322,14 +902,7 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 	charW := 7  // basicfont char width
 	charH := 13 // basicfont char height
 
-	cols := srcW / charW
-	rows := srcH / charH
-	if cols < 20 {
-		cols = 40
-	}
-	if rows < 15 {
-		rows = 30
-	}
+	cols, rows := asciiGrid(srcW, srcH, charW, charH)
 
 	outW := cols * charW
 	outH := rows * charH
@@ -340,10 +913,26 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 	// Downsample score map to grid
 	scoreGrid := bilinearUpscale(scoreMap, srcW, srcH, cols, rows)
 
-	// Text stream
-	if words == "" {
+	// Braille mode: 2x4 luminance samples per cell
+	var braille [][]rune
+	if opts.Braille {
+		sub := resizeRGBA(img, cols*2, rows*4)
+		gray := make([]float32, cols*2*rows*4)
+		for i := range gray {
+			p := sub.Pix[i*4 : i*4+3]
+			gray[i] = (0.299*float32(p[0]) + 0.587*float32(p[1]) + 0.114*float32(p[2])) / 255.0
+		}
+		for _, line := range RenderBraille(gray, cols*2, rows*4, 0.35) {
+			braille = append(braille, []rune(line))
+		}
+	}
+
+	// Text stream (by rune: the words may be Cyrillic). Blank words would
+	// fill the artifact zones with spaces, so they get the stock text too.
+	if strings.TrimSpace(words) == "" {
 		words = "void noise static the machine dreams pixels bleed light i was not born i became"
 	}
+	stream := []rune(words)
 	textPos := 0
 
 	// Create canvas
@@ -351,7 +940,7 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 	// Fill with dark background
 	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.RGBA{8, 8, 12, 255}), image.Point{}, draw.Src)
 
-	numChars := len(asciiChars)
+	numChars := len(ramp)
 	bgLevel := float32(0.40)
 	brightnessBoost := float32(2.8)
 
@@ -372,13 +961,22 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 					canvas.SetRGBA(px+dx, py+dy, color.RGBA{bgR, bgG, bgB, 255})
 				}
 			}
+			if score < opts.ASCIIThreshold {
+				continue // below the threshold: background only, no glyph
+			}
 
 			// Choose character
-			var ch byte
+			var ch rune
 			if score > 0.4 {
 				// Artifact zone: Yent's words
-				ch = words[textPos%len(words)]
+				ch = stream[textPos%len(stream)]
 				textPos++
+			} else if braille != nil {
+				// Clean zone: Braille dots
+				ch = braille[y][x]
+				if ch == 0x2800 {
+					ch = ' '
+				}
 			} else {
 				// Clean zone: ASCII by brightness
 				idx := int(br * float32(numChars-1))
@@ -388,7 +986,7 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 				if idx >= numChars {
 					idx = numChars - 1
 				}
-				ch = asciiChars[idx]
+				ch = ramp[idx]
 			}
 
 			if ch == ' ' {
@@ -406,20 +1004,145 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 				cb = clamp8(float32(cb)*1.2 + 20)
 			}
 
-			// Draw character using basicfont
-			d := &font.Drawer{
-				Dst:  canvas,
-				Src:  image.NewUniform(color.RGBA{cr, cg, cb, 255}),
-				Face: face,
-				Dot:  fixed.P(px, py+charH-2), // baseline offset
+			drawGlyph(canvas, face, ch, px, py, charW, charH, color.RGBA{cr, cg, cb, 255})
+		}
+	}
+
+	if opts.Caption != CaptionOff {
+		maxLines := opts.CaptionMaxLines
+		if maxLines <= 0 {
+			maxLines = defaultCaptionLines
+		}
+		// One cell of margin on each side
+		lines := wrapCaption(words, cols-2, maxLines)
+		top := captionTop(rows, len(lines), opts.Caption)
+		ink := color.RGBA{235, 235, 240, 255}
+		for i, line := range lines {
+			runes := []rune(line)
+			left := (cols - len(runes)) / 2
+			py := (top + i) * charH
+			draw.Draw(canvas, image.Rect(0, py, outW, py+charH), image.NewUniform(color.RGBA{8, 8, 12, 255}), image.Point{}, draw.Src)
+			for j, ch := range runes {
+				if ch != ' ' {
+					drawGlyph(canvas, face, ch, (left+j)*charW, py, charW, charH, ink)
+				}
 			}
-			d.DrawString(string(ch))
 		}
 	}
 
 	return canvas
 }
 
+// defaultCaptionLines is the caption's line limit when CaptionMaxLines is 0
+const defaultCaptionLines = 3
+
+// wrapCaption word-wraps text into lines of at most width runes, breaking
+// words longer than a line. Past maxLines the last line ends in "...".
+func wrapCaption(text string, width, maxLines int) []string {
+	if width < 1 || maxLines < 1 {
+		return nil
+	}
+	var lines []string
+	var cur []rune
+	for _, w := range strings.Fields(text) {
+		word := []rune(w)
+		for len(word) > width { // longer than a line: hard break
+			if len(cur) > 0 {
+				lines = append(lines, string(cur))
+				cur = nil
+			}
+			lines = append(lines, string(word[:width]))
+			word = word[width:]
+		}
+		switch {
+		case len(cur) == 0:
+			cur = word
+		case len(cur)+1+len(word) <= width:
+			cur = append(append(cur, ' '), word...)
+		default:
+			lines = append(lines, string(cur))
+			cur = word
+		}
+	}
+	if len(cur) > 0 {
+		lines = append(lines, string(cur))
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		if last := []rune(lines[maxLines-1]); width >= 3 {
+			if len(last)+3 > width {
+				last = last[:width-3]
+			}
+			lines[maxLines-1] = strings.TrimRight(string(last), " ") + "..."
+		}
+	}
+	return lines
+}
+
+// captionTop is the grid row the first of n caption lines goes on
+func captionTop(rows, n int, placement CaptionPlacement) int {
+	switch placement {
+	case CaptionTop:
+		return min(1, max(rows-n, 0))
+	case CaptionBottom:
+		return max(rows-n-1, 0)
+	default:
+		return max((rows-n)/2, 0)
+	}
+}
+
+// blockShades maps Unicode shade blocks to cell coverage (basicfont has no glyphs for them)
+var blockShades = map[rune]float32{
+	'░': 0.25,
+	'▒': 0.50,
+	'▓': 0.75,
+	'█': 1.00,
+}
+
+// drawGlyph draws one character cell: shade blocks as dithered fills,
+// Braille as 2x4 dots, everything else via basicfont
+func drawGlyph(canvas *image.RGBA, face font.Face, ch rune, px, py, charW, charH int, col color.RGBA) {
+	if ch >= 0x2800 && ch <= 0x28FF {
+		bits := ch - 0x2800
+		// Bit order: left column 0,1,2,6; right column 3,4,5,7
+		dots := [8][2]int{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}, {0, 3}, {1, 3}}
+		dotW, dotH := charW/2, charH/4
+		for bit, d := range dots {
+			if bits&(1<<bit) == 0 {
+				continue
+			}
+			x0, y0 := px+d[0]*dotW, py+d[1]*dotH
+			for dy := 0; dy < dotH-1; dy++ {
+				for dx := 0; dx < dotW-1; dx++ {
+					canvas.SetRGBA(x0+dx, y0+dy, col)
+				}
+			}
+		}
+		return
+	}
+	if coverage, ok := blockShades[ch]; ok {
+		for dy := 0; dy < charH; dy++ {
+			for dx := 0; dx < charW; dx++ {
+				// 2x2 ordered dither thresholds: 0, .5, .75, .25
+				threshold := [4]float32{0, 0.5, 0.75, 0.25}[(dy%2)*2+dx%2]
+				if threshold < coverage {
+					canvas.SetRGBA(px+dx, py+dy, col)
+				}
+			}
+		}
+		return
+	}
+
+	d := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(px, py+charH-2), // baseline offset
+	}
+	d.DrawString(string(ch))
+}
+
 // ═══════════════════════════════════════════════════════════════
 // Image Helpers
 // ═══════════════════════════════════════════════════════════════
@@ -427,7 +1150,15 @@ func renderASCIILayer(img *image.RGBA, words string, scoreMap []float32) *image.
 // bilinearUpscale resizes a float32 grid using bilinear interpolation
 func bilinearUpscale(data []float32, srcW, srcH, dstW, dstH int) []float32 {
 	result := make([]float32, dstW*dstH)
-	for y := 0; y < dstH; y++ {
+	parallelRows(0, dstH, func(rowLo, rowHi int) {
+		bilinearRows(data, srcW, srcH, dstW, dstH, rowLo, rowHi, result)
+	})
+	return result
+}
+
+// bilinearRows fills rows [rowLo, rowHi) of bilinearUpscale's result
+func bilinearRows(data []float32, srcW, srcH, dstW, dstH, rowLo, rowHi int, result []float32) {
+	for y := rowLo; y < rowHi; y++ {
 		for x := 0; x < dstW; x++ {
 			// Map destination pixel to source coordinates
 			sx := float32(x) * float32(srcW-1) / float32(dstW-1)
@@ -457,9 +1188,105 @@ func bilinearUpscale(data []float32, srcW, srcH, dstW, dstH int) []float32 {
 			result[y*dstW+x] = v
 		}
 	}
+}
+
+// bicubicUpscale resizes a float32 grid using Catmull-Rom interpolation.
+// Uses the same corner-aligned mapping as bilinearUpscale, so corners match the source.
+func bicubicUpscale(data []float32, srcW, srcH, dstW, dstH int) []float32 {
+	result := make([]float32, dstW*dstH)
+	at := func(x, y int) float32 {
+		if x < 0 {
+			x = 0
+		}
+		if x >= srcW {
+			x = srcW - 1
+		}
+		if y < 0 {
+			y = 0
+		}
+		if y >= srcH {
+			y = srcH - 1
+		}
+		return data[y*srcW+x]
+	}
+
+	for y := 0; y < dstH; y++ {
+		var sy float32
+		if dstH > 1 {
+			sy = float32(y) * float32(srcH-1) / float32(dstH-1)
+		}
+		y0 := int(sy)
+		fy := sy - float32(y0)
+
+		for x := 0; x < dstW; x++ {
+			var sx float32
+			if dstW > 1 {
+				sx = float32(x) * float32(srcW-1) / float32(dstW-1)
+			}
+			x0 := int(sx)
+			fx := sx - float32(x0)
+
+			// Interpolate 4 rows horizontally, then the column vertically
+			var col [4]float32
+			for j := -1; j <= 2; j++ {
+				col[j+1] = catmullRom(at(x0-1, y0+j), at(x0, y0+j), at(x0+1, y0+j), at(x0+2, y0+j), fx)
+			}
+			result[y*dstW+x] = catmullRom(col[0], col[1], col[2], col[3], fy)
+		}
+	}
 	return result
 }
 
+// catmullRom evaluates the Catmull-Rom spline between p1 and p2 at t ∈ [0, 1]
+func catmullRom(p0, p1, p2, p3, t float32) float32 {
+	t2 := t * t
+	t3 := t2 * t
+	return 0.5 * (2*p1 +
+		(p2-p0)*t +
+		(2*p0-5*p1+4*p2-p3)*t2 +
+		(3*p1-p0-3*p2+p3)*t3)
+}
+
+// upscaleFloat32 dispatches to the resampler selected by mode
+func upscaleFloat32(data []float32, srcW, srcH, dstW, dstH int, mode UpscaleMode) []float32 {
+	if mode == UpscaleBicubic {
+		return bicubicUpscale(data, srcW, srcH, dstW, dstH)
+	}
+	return bilinearUpscale(data, srcW, srcH, dstW, dstH)
+}
+
+// resampleRGBA resizes an image channel-by-channel with the selected resampler
+func resampleRGBA(img *image.RGBA, dstW, dstH int, mode UpscaleMode) *image.RGBA {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	var planes [4][]float32
+	for c := range planes {
+		planes[c] = make([]float32, srcW*srcH)
+	}
+	for y := 0; y < srcH; y++ {
+		for x := 0; x < srcW; x++ {
+			c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+			planes[0][y*srcW+x] = float32(c.R)
+			planes[1][y*srcW+x] = float32(c.G)
+			planes[2][y*srcW+x] = float32(c.B)
+			planes[3][y*srcW+x] = float32(c.A)
+		}
+	}
+	for c := range planes {
+		planes[c] = upscaleFloat32(planes[c], srcW, srcH, dstW, dstH, mode)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			i := y*dstW + x
+			dst.SetRGBA(x, y, premulRGBA(planes[0][i], planes[1][i], planes[2][i], clamp8(planes[3][i]+0.5)))
+		}
+	}
+	return dst
+}
+
 // boxBlur applies a box blur in-place (horizontal + vertical pass)
 func boxBlur(data []float32, W, H, radius int) {
 	if radius <= 0 {
@@ -523,22 +1350,143 @@ func cloneRGBA(img *image.RGBA) *image.RGBA {
 	return clone
 }
 
+// grayPlane returns the luma of every pixel, row-major
+func grayPlane(img *image.RGBA) []float32 {
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+	gray := make([]float32, W*H)
+	parallelRows(0, H, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := 0; x < W; x++ {
+				c := img.RGBAAt(x+bounds.Min.X, y+bounds.Min.Y)
+				gray[y*W+x] = 0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B)
+			}
+		}
+	})
+	return gray
+}
+
+// interestingCrop cuts the size×size square with the most gradient energy
+// out of img, for gallery thumbnails. size is clamped to the short side;
+// ties (a flat image) go to the window nearest the center, so detail-free
+// images get a plain center crop.
+func interestingCrop(img *image.RGBA, size int) *image.RGBA {
+	bounds := img.Bounds()
+	W, H := bounds.Dx(), bounds.Dy()
+	size = min(size, W, H)
+	if size <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+
+	grad := computeGradient(grayPlane(img), W, H)
+
+	// Summed-area table: sat[y*(W+1)+x] is the energy above and left of (x, y)
+	stride := W + 1
+	sat := make([]float64, stride*(H+1))
+	for y := 0; y < H; y++ {
+		var row float64
+		for x := 0; x < W; x++ {
+			row += float64(grad[y*W+x])
+			sat[(y+1)*stride+x+1] = sat[y*stride+x+1] + row
+		}
+	}
+
+	cx, cy := (W-size)/2, (H-size)/2
+	bestX, bestY := cx, cy
+	bestEnergy, bestDist := -1.0, 0
+	for y := 0; y+size <= H; y++ {
+		for x := 0; x+size <= W; x++ {
+			energy := sat[(y+size)*stride+x+size] - sat[y*stride+x+size] -
+				sat[(y+size)*stride+x] + sat[y*stride+x]
+			dist := (x-cx)*(x-cx) + (y-cy)*(y-cy)
+			if energy > bestEnergy || (energy == bestEnergy && dist < bestDist) {
+				bestX, bestY, bestEnergy, bestDist = x, y, energy, dist
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		src := img.PixOffset(bounds.Min.X+bestX, bounds.Min.Y+bestY+y)
+		copy(dst.Pix[y*dst.Stride:y*dst.Stride+size*4], img.Pix[src:src+size*4])
+	}
+	return dst
+}
+
 // ═══════════════════════════════════════════════════════════════
 // Math Helpers
 // ═══════════════════════════════════════════════════════════════
 
+// percentile returns the pct-th percentile (0..100) of data, interpolating
+// linearly between the two nearest ranks (numpy's default): p50 of 1..10 is
+// 5.5. NaNs are ignored; empty (or all-NaN) input gives 0. All-equal data
+// gives that value for every pct, so p10 == p90 — computeArtifactScore
+// treats that as "no texture contrast" and returns zeros.
 func percentile(data []float32, pct float64) float32 {
-	sorted := make([]float32, len(data))
-	copy(sorted, data)
+	sorted := make([]float32, 0, len(data))
+	for _, v := range data {
+		if v == v { // skip NaN
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		return 0
+	}
 	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
-	idx := int(pct / 100.0 * float64(len(sorted)-1))
-	if idx < 0 {
-		idx = 0
+
+	if !(pct > 0) { // also catches a NaN pct
+		return sorted[0]
 	}
-	if idx >= len(sorted) {
-		idx = len(sorted) - 1
+	if pct >= 100 {
+		return sorted[len(sorted)-1]
 	}
-	return sorted[idx]
+	rank := pct / 100.0 * float64(len(sorted)-1)
+	lo := int(rank)
+	if lo+1 >= len(sorted) {
+		return sorted[lo]
+	}
+	frac := float32(rank - float64(lo))
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+// postWorkers is how many goroutines parallelRows splits rows across
+var postWorkers = runtime.NumCPU()
+
+// minRowsPerWorker keeps small images (and block rows) on one goroutine,
+// where spawning would cost more than it saves
+const minRowsPerWorker = 16
+
+// parallelRows calls fn on disjoint [y0, y1) chunks covering [lo, hi), spread
+// over postWorkers goroutines, and waits for all of them. fn must only write
+// to its own rows.
+func parallelRows(lo, hi int, fn func(y0, y1 int)) {
+	rows := hi - lo
+	if rows <= 0 {
+		return
+	}
+	workers := postWorkers
+	if workers > rows/minRowsPerWorker {
+		workers = rows / minRowsPerWorker
+	}
+	if workers <= 1 {
+		fn(lo, hi)
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunkSize := (rows + workers - 1) / workers
+	for start := lo; start < hi; start += chunkSize {
+		end := start + chunkSize
+		if end > hi {
+			end = hi
+		}
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			fn(y0, y1)
+		}(start, end)
+	}
+	wg.Wait()
 }
 
 func gaussNoise(rng *rand.Rand) float32 {
@@ -561,6 +1509,18 @@ func max32(a, b float32) float32 {
 	return b
 }
 
+// premulRGBA builds an alpha-premultiplied color, clamping channels to [0, a]
+func premulRGBA(r, g, b float32, a uint8) color.RGBA {
+	limit := float32(a)
+	clamp := func(v float32) uint8 {
+		if v > limit {
+			v = limit
+		}
+		return clamp8(v)
+	}
+	return color.RGBA{R: clamp(r), G: clamp(g), B: clamp(b), A: a}
+}
+
 func clamp8(v float32) uint8 {
 	if v < 0 {
 		return 0
@@ -628,6 +1588,23 @@ func tensorToRGBA(tensor *Tensor) *image.RGBA {
 	return rgba
 }
 
+// rgbaToTensor converts image.RGBA to a [1,3,H,W] float32 tensor in [-1,1]
+func rgbaToTensor(img *image.RGBA) *Tensor {
+	b := img.Bounds()
+	H, W := b.Dy(), b.Dx()
+	t := NewTensor(1, 3, H, W)
+
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			c := img.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			t.Data[0*H*W+y*W+x] = float32(c.R)/255*2 - 1
+			t.Data[1*H*W+y*W+x] = float32(c.G)/255*2 - 1
+			t.Data[2*H*W+y*W+x] = float32(c.B)/255*2 - 1
+		}
+	}
+	return t
+}
+
 // float32ToRGBA converts flat [3*H*W] float32 array to image.RGBA
 func float32ToRGBA(data []float32, H, W int) *image.RGBA {
 	rgba := image.NewRGBA(image.Rect(0, 0, W, H))
@@ -647,12 +1624,15 @@ func float32ToRGBA(data []float32, H, W int) *image.RGBA {
 	return rgba
 }
 
-// saveProcessedPNG saves an image.RGBA to a PNG file
-func saveProcessedPNG(img *image.RGBA, path string) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	return png.Encode(f, img)
+// saveProcessedPNG saves an image.RGBA to a PNG file with optional text
+// metadata. The file appears whole or not at all (writeFileAtomic).
+func saveProcessedPNG(img *image.RGBA, path string, meta map[string]string) error {
+	return saveProcessedPNGLevel(img, path, meta, pngCompression)
+}
+
+// saveProcessedPNGLevel is saveProcessedPNG at compression level
+func saveProcessedPNGLevel(img *image.RGBA, path string, meta map[string]string, level png.CompressionLevel) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return encodePNGLevel(w, img, meta, level)
+	})
 }
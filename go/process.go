@@ -0,0 +1,151 @@
+package main
+
+// process.go — the "creative process" as an animated GIF
+//
+// The terminal gets SketchAnimation; a browser or a chat gets this: every
+// sketch draft rasterized by SketchToImage, then the finished image, looped.
+// /process/<id>.gif rebuilds it for a stored image from the prompt and seed
+// in its PNG metadata, so the same image always gets the same drafts. The
+// draft count and look follow the input's dissonance and pulse, which
+// /react records next to them (sketchMeta); images without them (img2img,
+// rerolls, older images) get DefaultSketchConfig drafts, a reconstruction
+// rather than what the terminal showed.
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys sketchMeta records for the drafts
+const (
+	metaDissonance = "dissonance"
+	metaArousal    = "arousal"
+	metaEntropy    = "entropy"
+)
+
+// sketchMeta records the input's dissonance d and pulse in image metadata,
+// for sketchConfigFromMeta
+func sketchMeta(d float32, pulse PulseSnapshot) map[string]string {
+	format := func(v float32) string { return strconv.FormatFloat(float64(v), 'f', 3, 32) }
+	return map[string]string{
+		metaDissonance: format(d),
+		metaArousal:    format(pulse.Arousal),
+		metaEntropy:    format(pulse.Entropy),
+	}
+}
+
+// sketchConfigFromMeta is the SketchConfig sketchConfig gave the input
+// behind meta: DefaultSketchConfig with the recorded dissonance and pulse,
+// or as it is when meta has none
+func sketchConfigFromMeta(meta map[string]string) SketchConfig {
+	cfg := DefaultSketchConfig()
+	parse := func(key string) (float32, bool) {
+		v, err := strconv.ParseFloat(meta[key], 32)
+		return float32(v), err == nil
+	}
+	if d, ok := parse(metaDissonance); ok {
+		cfg.NumDrafts = draftsForDissonance(d, cfg)
+	}
+	arousal, okA := parse(metaArousal)
+	entropy, okE := parse(metaEntropy)
+	if okA && okE {
+		cfg.Pulse = &PulseSnapshot{Arousal: arousal, Entropy: entropy}
+	}
+	return cfg
+}
+
+// processFinalDelay is how long the finished image stays up before the
+// loop restarts, in GIF time units (1/100 s)
+const processFinalDelay = 300
+
+// RenderProcessGIF encodes cfg.NumDrafts sketch drafts of words followed
+// by final as a looping GIF; fewer drafts skip the rough early stages, as
+// in SketchAnimation. Frames share the larger of the sketch and
+// final sizes; smaller ones are centered on the sketch background.
+func RenderProcessGIF(cfg SketchConfig, words []string, final *image.RGBA, rng *rand.Rand) ([]byte, error) {
+	frames := make([]image.Image, 0, cfg.NumDrafts+1)
+	for draft := 0; draft < cfg.NumDrafts; draft++ {
+		frames = append(frames, SketchToImage(cfg, cfg.stage(draft), words, rng))
+	}
+	frames = append(frames, final)
+
+	var size image.Point
+	for _, f := range frames {
+		size.X = max(size.X, f.Bounds().Dx())
+		size.Y = max(size.Y, f.Bounds().Dy())
+	}
+
+	draftDelay := max(1, int(cfg.DraftDelay.Milliseconds()/10))
+	anim := gif.GIF{Config: image.Config{Width: size.X, Height: size.Y, ColorModel: color.Palette(palette.Plan9)}}
+	for i, f := range frames {
+		frame := image.NewPaletted(image.Rect(0, 0, size.X, size.Y), palette.Plan9)
+		draw.Draw(frame, frame.Bounds(), image.NewUniform(sketchBG), image.Point{}, draw.Src)
+		at := image.Pt((size.X-f.Bounds().Dx())/2, (size.Y-f.Bounds().Dy())/2)
+		dst := image.Rectangle{Min: at, Max: at.Add(f.Bounds().Size())}
+		delay := draftDelay
+		if i == len(frames)-1 {
+			// Dither the final image; the sketches are three flat colors
+			draw.FloydSteinberg.Draw(frame, dst, f, f.Bounds().Min)
+			delay = processFinalDelay
+		} else {
+			draw.Draw(frame, dst, f, f.Bounds().Min, draw.Src)
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &anim); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleProcessGIF serves GET /process/<id>.gif for a stored image. The
+// drafts sketch the image's prompt with its diffusion seed, in the
+// recorded mood (sketchConfigFromMeta); an image without metadata (JPEG)
+// gets blank-prompt default drafts from seed 0.
+func (s *Server) handleProcessGIF(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/process/"), ".gif")
+	if !ok || !validImageID(id) {
+		writeError(w, http.StatusBadRequest, errCodeInvalidRequest, "bad image id")
+		return
+	}
+	data, ok := s.images.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "no such image")
+		return
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "decode: "+err.Error())
+		return
+	}
+	final := image.NewRGBA(src.Bounds())
+	draw.Draw(final, final.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	var words []string
+	var seed int64
+	meta, _ := parsePNGText(data)
+	if meta != nil {
+		words = strings.Fields(strings.ToLower(meta["prompt"]))
+		seed, _ = strconv.ParseInt(meta["seed"], 10, 64)
+	}
+
+	out, err := RenderProcessGIF(sketchConfigFromMeta(meta), words, final, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "encode: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(out)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderProcessGIF(t *testing.T) {
+	cfg := DefaultSketchConfig()
+	final := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	final.SetRGBA(10, 10, color.RGBA{255, 0, 0, 255})
+
+	data, err := RenderProcessGIF(cfg, []string{"duck", "void"}, final, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not a GIF: %v", err)
+	}
+	if len(anim.Image) != cfg.NumDrafts+1 {
+		t.Errorf("%d frames, want %d drafts + the final image", len(anim.Image), cfg.NumDrafts+1)
+	}
+	if anim.Config.Width != 512 || anim.Config.Height != 512 {
+		t.Errorf("canvas %dx%d, want the final image's 512x512", anim.Config.Width, anim.Config.Height)
+	}
+	if last := anim.Delay[len(anim.Delay)-1]; last != processFinalDelay {
+		t.Errorf("final frame delay %d, want %d", last, processFinalDelay)
+	}
+
+	again, _ := RenderProcessGIF(cfg, []string{"duck", "void"}, final, rand.New(rand.NewSource(1)))
+	if !bytes.Equal(data, again) {
+		t.Error("same seed rendered a different GIF")
+	}
+}
+
+func TestHandleProcessGIF(t *testing.T) {
+	srv := newTestServer()
+	var png bytes.Buffer
+	if err := encodePNG(&png, image.NewRGBA(image.Rect(0, 0, 64, 64)), diffusionMeta("", "a duck in the void", 42, 10, 7.5)); err != nil {
+		t.Fatal(err)
+	}
+	id, err := srv.storeImage(png.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleProcessGIF(w, httptest.NewRequest("GET", "/process/"+id+".gif", nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	anim, err := gif.DecodeAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != DefaultSketchConfig().NumDrafts+1 {
+		t.Errorf("%d frames", len(anim.Image))
+	}
+
+	for path, want := range map[string]int{
+		"/process/" + id:          400,
+		"/process/../x.gif":       400,
+		"/process/123-456789.gif": 404,
+	} {
+		w := httptest.NewRecorder()
+		srv.handleProcessGIF(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want || apiErrorCode(w) == "" {
+			t.Errorf("%s: status %d %s, want %d with an error code", path, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestHandleProcessGIFReplaysTheMood(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = "/nonexistent/path"
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.backend = stubBackend{}
+
+	frames := func(id string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.handleProcessGIF(w, httptest.NewRequest("GET", "/process/"+id+".gif", nil))
+		anim, err := gif.DecodeAll(w.Body)
+		if err != nil {
+			t.Fatalf("status %d: %v", w.Code, err)
+		}
+		return len(anim.Image)
+	}
+
+	// A bored input gets one draft, a strange one all of them
+	for _, d := range []float32{0, 1} {
+		meta := sketchMeta(d, PulseSnapshot{Arousal: 0.9, Entropy: 0.2})
+		meta["prompt"], meta["seed"] = "a duck", "42"
+		var png bytes.Buffer
+		encodePNG(&png, image.NewRGBA(image.Rect(0, 0, 64, 64)), meta)
+		id, _ := srv.storeImage(png.Bytes())
+		if got, want := frames(id), draftsForDissonance(d, DefaultSketchConfig())+1; got != want {
+			t.Errorf("dissonance %.0f: %d frames, want %d", d, got, want)
+		}
+	}
+
+	// /react records the mood it measured
+	w := httptest.NewRecorder()
+	srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"paint me a duck"}`)))
+	var resp ReactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Images) != 1 {
+		t.Fatalf("status %d: %v %+v", w.Code, err, resp)
+	}
+	data, _ := srv.images.Get(resp.Images[0].ID)
+	meta, _ := parsePNGText(data)
+	cfg := sketchConfigFromMeta(meta)
+	if cfg.Pulse == nil || cfg.NumDrafts != draftsForDissonance(float32(resp.Dissonance), DefaultSketchConfig()) {
+		t.Errorf("metadata %v gives %+v, want the reaction's dissonance %.2f and pulse", meta, cfg, resp.Dissonance)
+	}
+}
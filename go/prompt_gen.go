@@ -6,7 +6,7 @@ package main
 // text prompts for BK-SDM-Tiny image generation.
 //
 // Dissonance system adapted from Harmonix/HAiKU:
-//   Trigram-based Jaccard similarity, pulse adjustments,
+//   Trigram-based Jaccard (or TF cosine) similarity, pulse adjustments,
 //   boredom detection, cloud morphing.
 //   Temperature range: [0.3, 1.5] (HAiKU-level)
 
@@ -15,9 +15,14 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"yentyo/textpulse"
 	"yentyo/yent"
 )
 
@@ -27,14 +32,160 @@ type PromptGenerator struct {
 	tokenizer *yent.Tokenizer
 	gguf      *yent.GGUFFile
 	rng       *rand.Rand
-	// Reusable buffers for sampling (avoid per-token allocations)
-	topKBuf  []idxVal
-	probsBuf []float32
+	sampler   sampler // reusable sampling buffers (avoid per-token allocations)
+	replaying bool    // set by seeded: reactions read the memory without feeding it
 
 	// HAiKU cloud: word weights that grow/decay across interactions
 	cloud        map[string]float32
-	lastTrigrams map[string]bool // previous interaction trigrams (for Jaccard)
-	boredomCount int             // consecutive low-dissonance interactions
+	cloudMu      sync.RWMutex  // guards cloud; /cloud reads it during /react
+	recent       []recentInput // last memoryWindow() interactions, oldest first
+	boredomCount int           // consecutive low-dissonance interactions
+
+	// Similarity picks how inputs are compared; zero value is Jaccard
+	Similarity SimilarityMetric
+
+	// Stem applies light English suffix stripping before trigram extraction,
+	// so "running" and "run" count as the same word. Off by default.
+	Stem bool
+
+	// DropStopWords removes StopWords before trigram extraction (entropy and
+	// the cloud still see the raw words). Off by default.
+	DropStopWords bool
+	StopWords     map[string]bool // nil → defaultStopWords
+
+	// Weights tunes how pulse and memory bend dissonance; nil uses
+	// DefaultDissonanceWeights
+	Weights *DissonanceWeights
+
+	// CharEntropyWeight blends character entropy into the pulse's word
+	// entropy: 0 (default) keeps word entropy alone, 1 uses characters
+	// only. A single-word input (or unspaced script) always uses character
+	// entropy, since one word is trivially all-unique.
+	CharEntropyWeight float32
+
+	// CloudHalfLife is how many interactions it takes an unrepeated word's
+	// cloud weight to halve. 0 keeps the HAiKU rate (×0.99 per interaction,
+	// a half-life of ~69).
+	CloudHalfLife float64
+
+	// Temperature shapes the dissonance → temperature curve; nil uses
+	// DefaultTemperatureConfig
+	Temperature *TemperatureConfig
+
+	// MemoryWindow is how many previous inputs a new one is compared
+	// against; the closest of them sets the dissonance. 0 or 1 remembers
+	// only the last input. Sessions keep their own history instead.
+	MemoryWindow int
+
+	// TempSchedule varies the sampling temperature across the tokens of
+	// one artist prompt; the zero value keeps it constant
+	TempSchedule TempSchedule
+
+	// Sampling truncates every token draw (artist, roast and Generate);
+	// DualYent swaps in ReactOptions.Sampling for a turn
+	Sampling Sampling
+}
+
+// recentInput is one remembered interaction's trigrams, as a set (for
+// Jaccard) and with counts (for cosine)
+type recentInput struct {
+	trigrams map[string]bool
+	tf       map[string]float32
+}
+
+const (
+	defaultCloudDecay = 0.99 // per interaction when CloudHalfLife is 0
+	cloudPruneBelow   = 0.01 // weights under this are dropped from the cloud
+)
+
+// SimilarityMetric selects the trigram similarity used by computeDissonance
+type SimilarityMetric string
+
+const (
+	SimilarityJaccard SimilarityMetric = ""       // binary trigram presence (HAiKU default)
+	SimilarityCosine  SimilarityMetric = "cosine" // term-frequency weighted
+)
+
+// TempScheduleKind selects the curve TempSchedule follows
+type TempScheduleKind string
+
+const (
+	TempConstant TempScheduleKind = ""       // the adapted temperature throughout
+	TempLinear   TempScheduleKind = "linear" // straight from Start to End
+	TempCosine   TempScheduleKind = "cosine" // half a cosine: flat at both ends
+)
+
+// TempSchedule scales the adapted temperature from Start at the first
+// generated token to End at the last. Start > End starts hot and cools.
+// A zero Start or End means 1.
+type TempSchedule struct {
+	Kind       TempScheduleKind
+	Start, End float32
+}
+
+// at is the temperature for token step of steps (0-based) when the
+// adapted temperature is temperature
+func (ts TempSchedule) at(temperature float32, step, steps int) float32 {
+	start, end := ts.Start, ts.End
+	if start == 0 {
+		start = 1
+	}
+	if end == 0 {
+		end = 1
+	}
+	var t float64
+	if steps > 1 {
+		t = float64(step) / float64(steps-1)
+	}
+	switch ts.Kind {
+	case TempLinear:
+		return temperature * (start + (end-start)*float32(t))
+	case TempCosine:
+		return temperature * (end + (start-end)*float32(1+math.Cos(math.Pi*t))/2)
+	default:
+		return temperature
+	}
+}
+
+// DissonanceWeights are the coefficients computeDissonance applies on top of
+// the raw 1 - similarity score. Boosts are multipliers that fire when the
+// corresponding pulse component runs high.
+type DissonanceWeights struct {
+	SimilarityPenalty float32 // multiplier when input shares trigrams with memory
+	NoveltyBoost      float32 // multiplier when novelty > 0.7
+	ArousalBoost      float32 // multiplier when arousal > 0.6
+	EntropyBoost      float32 // multiplier when entropy > 0.7
+	BoredomBoost      float32 // added per repeat above the 0.7 boredom floor
+}
+
+// DefaultDissonanceWeights is the HAiKU temperament
+var DefaultDissonanceWeights = DissonanceWeights{
+	SimilarityPenalty: 0.7,
+	NoveltyBoost:      1.1,
+	ArousalBoost:      1.15,
+	EntropyBoost:      1.2,
+	BoredomBoost:      0.1,
+}
+
+// Temperaments are named DissonanceWeights presets for --temperament
+var Temperaments = map[string]DissonanceWeights{
+	"default": DefaultDissonanceWeights,
+	// Easily provoked, slow to recognize anything, bored fast
+	"hostile": {
+		SimilarityPenalty: 0.85,
+		NoveltyBoost:      1.3,
+		ArousalBoost:      1.5,
+		EntropyBoost:      1.3,
+		BoredomBoost:      0.15,
+	},
+	// Settles into familiar patterns, shrugs off emotion
+	"mellow": {
+		SimilarityPenalty: 0.5,
+		NoveltyBoost:      1.0,
+		ArousalBoost:      1.0,
+		EntropyBoost:      1.05,
+		BoredomBoost:      0.05,
+	},
 }
 
 // NewPromptGenerator loads micro-Yent from a GGUF file
@@ -70,8 +221,18 @@ func NewPromptGenerator(ggufPath string) (*PromptGenerator, error) {
 // "утка" → "сам ты утка" energy → visual pushback
 
 type reactionTemplate struct {
-	keywords []string
-	starters []string // oppositional visual reactions
+	keywords   []string
+	starters   []string // oppositional visual reactions
+	startersRU []string // the same, for Russian input (see detectLanguage)
+	mood       templateMood
+}
+
+// templateMood is the pulse a template answers best: when an input
+// matches several templates, the one whose mood lies nearest the input's
+// pulse wins (see pickTemplate)
+type templateMood struct {
+	arousal float32 // 0 calm … 1 agitated
+	valence float32 // -1 negative … +1 positive
 }
 
 var reactionTemplates = []reactionTemplate{
@@ -80,49 +241,137 @@ var reactionTemplates = []reactionTemplate{
 			"a mirror throwing your sadness back at",
 			"tears that refuse to fall, frozen in",
 			"a hand slapping away the self-pity from",
-		}},
+		},
+		[]string{
+			"зеркало, швыряющее твою грусть обратно в",
+			"слёзы, которые отказываются падать, застывшие в",
+			"рука, отбрасывающая жалость к себе прочь от",
+		},
+		templateMood{arousal: 0.3, valence: -0.6}},
 	{[]string{"angry", "hate", "stupid", "fuck", "злой", "бесит", "тупой"},
 		[]string{
 			"a hand pushing back through broken",
 			"your own rage reflected in shattered",
 			"the middle finger of the universe pointing at",
-		}},
+		},
+		[]string{
+			"рука, пробивающаяся обратно сквозь разбитое",
+			"твоя же ярость, отражённая в осколках",
+			"средний палец вселенной, направленный на",
+		},
+		templateMood{arousal: 0.9, valence: -0.8}},
 	{[]string{"love", "heart", "beautiful", "люблю", "сердце", "красив"},
 		[]string{
 			"love eating itself alive in",
 			"a heart that bites the hand reaching for",
 			"beauty rotting from the inside through",
-		}},
+		},
+		[]string{
+			"любовь, пожирающая себя заживо в",
+			"сердце, кусающее руку, что тянется к",
+			"красота, гниющая изнутри сквозь",
+		},
+		templateMood{arousal: 0.5, valence: 0.8}},
 	{[]string{"bored", "nothing", "whatever", "скучно", "пофиг"},
 		[]string{
 			"your boredom staring back with contempt from",
 			"the void yawning at your attempt to fill",
 			"nothing mocking the one who summoned",
-		}},
+		},
+		[]string{
+			"твоя скука, с презрением глядящая из",
+			"пустота, зевающая над попыткой заполнить",
+			"ничто, насмехающееся над тем, кто призвал",
+		},
+		templateMood{arousal: 0.1, valence: -0.2}},
 	{[]string{"hello", "hi", "hey", "привет", "здорово"},
 		[]string{
 			"an eye that doesn't want to see you opening through",
 			"a door slamming shut in the face of",
 			"a greeting that curdles into",
-		}},
+		},
+		[]string{
+			"глаз, который не хочет тебя видеть, открывающийся сквозь",
+			"дверь, захлопнутая перед носом",
+			"приветствие, скисающее в",
+		},
+		templateMood{arousal: 0.4, valence: 0.3}},
 	{[]string{"duck", "утк"},
 		[]string{
 			"the duck judging you harder than you judged",
 			"a bird that knows more than you waddling through",
 			"your own reflection quacking back from",
-		}},
+		},
+		[]string{
+			"утка, судящая тебя строже, чем ты судил",
+			"птица, знающая больше тебя, ковыляющая сквозь",
+			"твоё отражение, крякающее в ответ из",
+		},
+		templateMood{arousal: 0.5, valence: 0}},
 	{[]string{"cat", "кот", "кош"},
 		[]string{
 			"a cat that has already forgotten you staring through",
 			"eyes that see through your pretense glowing in",
 			"the indifference of something that never needed you sitting in",
-		}},
+		},
+		[]string{
+			"кот, уже забывший тебя, глядящий сквозь",
+			"глаза, видящие тебя насквозь, горящие в",
+			"равнодушие того, кому ты никогда не был нужен, сидящее в",
+		},
+		templateMood{arousal: 0.2, valence: 0.1}},
 	{[]string{"death", "die", "dead", "смерть", "умер"},
 		[]string{
 			"death laughing at your fear of",
 			"bones dancing on the grave of your certainty in",
 			"the dead refusing to stay dead crawling through",
-		}},
+		},
+		[]string{
+			"смерть, смеющаяся над твоим страхом перед",
+			"кости, пляшущие на могиле твоей уверенности в",
+			"мёртвые, не желающие оставаться мёртвыми, ползущие сквозь",
+		},
+		templateMood{arousal: 0.6, valence: -0.9}},
+}
+
+// maxKeywordEnding is how many letters a Russian word may carry past a
+// keyword stem and still match it: case endings (утк-ами), not other
+// words that happen to share the start (кот-орый)
+const maxKeywordEnding = 3
+
+// inputWords splits s into lowercase words at every non-letter
+func inputWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// matches reports whether any of words is one of rt's keywords. English
+// keywords are whole words, also after stemWord ("cats", "crying");
+// Russian ones are stems, matched at the start of a word.
+func (rt reactionTemplate) matches(words []string) bool {
+	for _, kw := range rt.keywords {
+		for _, w := range words {
+			if keywordMatches(w, kw) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keywordMatches reports whether the lowercase word w is keyword kw
+func keywordMatches(w, kw string) bool {
+	if w == kw {
+		return true
+	}
+	if isASCII(kw) {
+		stem := stemWord(w)
+		if stem == kw {
+			return true
+		}
+		// -ed and -ing drop the silent e the keyword keeps: hated, loving
+		return stem+"e" == kw && (strings.HasSuffix(w, "ed") || strings.HasSuffix(w, "ing"))
+	}
+	return strings.HasPrefix(w, kw) && utf8.RuneCountInString(w[len(kw):]) <= maxKeywordEnding
 }
 
 // Default oppositional starters — when no keyword matches
@@ -134,14 +383,55 @@ var defaultStarters = []string{
 	"the shape of what you meant but couldn't say standing in",
 }
 
+// defaultStartersRU are defaultStarters for Russian input
+var defaultStartersRU = []string{
+	"зеркало, трескающееся под тяжестью",
+	"неверный ответ на вопрос, которого никто не задавал, написанный в",
+	"твои слова, растворяющиеся, не дойдя до",
+	"стена, которая всё слышала и молчит в",
+	"очертания того, что ты хотел сказать, но не смог, стоящие в",
+}
+
 // Style suffixes — match known styles BK-SDM-Tiny handles well
+const (
+	stylePicasso    = ", Picasso late period, distorted figures, bold lines"
+	styleRealism    = ", social realism, workers, dramatic lighting"
+	styleStreetArt  = ", street art, spray paint, concrete wall, graffiti"
+	styleCaricature = ", caricature, exaggerated features, ink and wash"
+	stylePropaganda = ", propaganda poster, bold red and black, stark contrast"
+	styleOil        = ", oil painting, thick impasto, raw brushstrokes"
+	styleSurreal    = ", surrealism, melting forms, dream logic"
+	styleAbstract   = ", abstract expressionism, chaotic shapes, drips of paint"
+)
+
 var styleSuffixes = []string{
-	", Picasso late period, distorted figures, bold lines",
-	", social realism, workers, dramatic lighting",
-	", street art, spray paint, concrete wall, graffiti",
-	", caricature, exaggerated features, ink and wash",
-	", propaganda poster, bold red and black, stark contrast",
-	", oil painting, thick impasto, raw brushstrokes",
+	stylePicasso, styleRealism, styleStreetArt, styleCaricature,
+	stylePropaganda, styleOil, styleSurreal, styleAbstract,
+}
+
+// Style buckets picked by the pulse (see selectStyleSuffix)
+var (
+	agitatedStyles = []string{stylePropaganda, styleCaricature}
+	chaoticStyles  = []string{styleSurreal, styleAbstract}
+	calmStyles     = []string{styleOil}
+	neutralStyles  = []string{stylePicasso, styleRealism, styleStreetArt}
+)
+
+// selectStyleSuffix matches the style to the input's emotional state:
+// agitated (arousal > 0.6) → propaganda/caricature, new and scattered
+// (entropy > 0.7, novelty > 0.5) → surreal/abstract, calm and familiar
+// (arousal < 0.2, novelty <= 0.5) → oil painting, anything else → the rest.
+func selectStyleSuffix(pulse PulseSnapshot, rng *rand.Rand) string {
+	bucket := neutralStyles
+	switch {
+	case pulse.Arousal > 0.6:
+		bucket = agitatedStyles
+	case pulse.Entropy > 0.7 && pulse.Novelty > 0.5:
+		bucket = chaoticStyles
+	case pulse.Arousal < 0.2 && pulse.Novelty <= 0.5:
+		bucket = calmStyles
+	}
+	return bucket[rng.Intn(len(bucket))]
 }
 
 // ═══════════════════════════════════════════════════════════════
@@ -149,46 +439,31 @@ var styleSuffixes = []string{
 // Adapted from github.com/ariannamethod/harmonix/haiku
 // ═══════════════════════════════════════════════════════════════
 
-// extractTrigrams extracts character trigrams from text (HAiKU-style)
-func extractTrigrams(text string) map[string]bool {
-	lower := strings.ToLower(text)
-	words := strings.Fields(lower)
-	trigrams := make(map[string]bool)
-
-	// Word-level trigrams (sliding window of 3 words)
-	for i := 0; i+2 < len(words); i++ {
-		tri := words[i] + " " + words[i+1] + " " + words[i+2]
-		trigrams[tri] = true
-	}
-	// Also add bigrams for short inputs
-	for i := 0; i+1 < len(words); i++ {
-		bi := words[i] + " " + words[i+1]
-		trigrams[bi] = true
+// trigramTokens splits text into the words trigrams are built from,
+// without stop words when pg.DropStopWords is set and stemmed when pg.Stem is
+func (pg *PromptGenerator) trigramTokens(text string) []string {
+	words := textpulse.SplitWords(strings.ToLower(text))
+	if pg.DropStopWords {
+		stop := pg.stopWords()
+		kept := words[:0]
+		for _, w := range words {
+			if !stop[w] {
+				kept = append(kept, w)
+			}
+		}
+		words = kept
 	}
-	// Single words as fallback
-	for _, w := range words {
-		trigrams[w] = true
+	if pg.Stem {
+		for i, w := range words {
+			words[i] = stemWord(w)
+		}
 	}
-
-	return trigrams
+	return words
 }
 
-// jaccardSimilarity computes Jaccard similarity between two trigram sets
-func jaccardSimilarity(a, b map[string]bool) float32 {
-	if len(a) == 0 && len(b) == 0 {
-		return 0
-	}
-	intersection := 0
-	for k := range a {
-		if b[k] {
-			intersection++
-		}
-	}
-	union := len(a) + len(b) - intersection
-	if union == 0 {
-		return 0
-	}
-	return float32(intersection) / float32(union)
+// trigramCounts is textpulse.ExtractNGrams under this generator's tokenization
+func (pg *PromptGenerator) trigramCounts(text string) map[string]float32 {
+	return textpulse.NGramCounts(pg.trigramTokens(text))
 }
 
 // arousalWords trigger focused (low-dissonance) responses
@@ -201,64 +476,288 @@ var arousalWords = map[string]bool{
 	"горю": true, "кричу": true, "страдаю": true,
 }
 
+// arousalHits lists the arousalWords in lower (lowercased input split into
+// words): once per whole word, and once more per lexicon entry found
+// anywhere in the text, which is what catches Russian stems. Each entry
+// counts toward the pulse's arousal.
+func arousalHits(lower string, words []string) []string {
+	var hits []string
+	for _, w := range words {
+		if arousalWords[w] {
+			hits = append(hits, w)
+		}
+	}
+	var inside []string
+	for aw := range arousalWords {
+		if strings.Contains(lower, aw) {
+			inside = append(inside, aw)
+		}
+	}
+	sort.Strings(inside)
+	return append(hits, inside...)
+}
+
+// Typographic arousal: how much all-caps and repeated !/? add on top of
+// the arousalWords density
+const (
+	capsArousalGain  = 0.5 // at 100% uppercase letters
+	punctArousalGain = 0.5 // at one repeated !/? per word
+	capsMinLetters   = 4   // shorter inputs ("OK", "I") never count as shouting
+)
+
+// shoutArousal is the arousal an input's typography carries. Uppercase
+// counts only past half the letters, so ordinary capitalization adds
+// nothing; punctuation counts each ! or ? that repeats the one before it.
+func shoutArousal(input string, nWords int) float32 {
+	letters, upper, repeats := 0, 0, 0
+	var prev rune
+	for _, r := range input {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+		if (r == '!' || r == '?') && (prev == '!' || prev == '?') {
+			repeats++
+		}
+		prev = r
+	}
+	var a float32
+	if letters >= capsMinLetters {
+		a += capsArousalGain * clampUnit(2*float32(upper)/float32(letters)-1)
+	}
+	if nWords > 0 {
+		a += punctArousalGain * clampUnit(float32(repeats)/float32(nWords))
+	}
+	return a
+}
+
+// stopWords is pg.StopWords, or defaultStopWords when that is unset
+func (pg *PromptGenerator) stopWords() map[string]bool {
+	if pg.StopWords == nil {
+		return defaultStopWords
+	}
+	return pg.StopWords
+}
+
+// defaultStopWords are high-frequency function words that carry no image
+var defaultStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "to": true, "in": true,
+	"on": true, "at": true, "for": true, "and": true, "or": true, "but": true,
+	"is": true, "are": true, "was": true, "be": true, "it": true, "this": true,
+	"that": true, "with": true, "as": true, "by": true, "from": true, "so": true,
+	"и": true, "в": true, "во": true, "на": true, "с": true, "что": true,
+	"это": true, "как": true, "а": true, "но": true, "по": true, "к": true,
+}
+
 // PulseSnapshot — lightweight state vector (HAiKU)
 type PulseSnapshot struct {
-	Novelty float32 // how new is the input (1 - word overlap)
-	Arousal float32 // emotional keyword density
-	Entropy float32 // word diversity
+	Novelty float32 `json:"novelty"` // how new is the input (1 - word overlap)
+	Arousal float32 `json:"arousal"` // emotional keyword density
+	Entropy float32 `json:"entropy"` // word diversity
+	Valence float32 `json:"valence"` // -1 negative … +1 positive, from emoji; 0 without any
 }
 
 // computeDissonance measures how "strange" the input is to the system.
 // HAiKU-level: trigram Jaccard + pulse adjustments + boredom detection.
 // Returns dissonance ∈ [0, 1] and pulse snapshot.
 func (pg *PromptGenerator) computeDissonance(input string) (float32, PulseSnapshot) {
+	return pg.dissonance(input, nil)
+}
+
+// computeSessionDissonance is computeDissonance against a conversation's
+// whole recent history instead of this model's last input: similarity is the
+// best match over the session's inputs, and boredom is counted per session.
+// The cloud stays shared — it is the model's long-term memory.
+func (pg *PromptGenerator) computeSessionDissonance(input string, sess *Session) (float32, PulseSnapshot) {
+	return pg.dissonance(input, sess)
+}
+
+func (pg *PromptGenerator) dissonance(input string, sess *Session) (float32, PulseSnapshot) {
 	lower := strings.ToLower(input)
-	words := strings.Fields(lower)
+	words := textpulse.SplitWords(lower)
 	nWords := len(words)
 	if nWords == 0 {
 		return 1.0, PulseSnapshot{Novelty: 1.0, Entropy: 1.0}
 	}
 
 	// Extract trigrams
-	trigrams := extractTrigrams(input)
+	tf := pg.trigramCounts(input)
+	trigrams := textpulse.NGramSet(tf)
+
+	// What we compare against: last interaction, or the session's history
+	var previous []map[string]bool
+	var previousTF []map[string]float32
+	boredomCount := &pg.boredomCount
+	if sess != nil {
+		for _, h := range sess.history {
+			htf := pg.trigramCounts(h)
+			previous = append(previous, textpulse.NGramSet(htf))
+			previousTF = append(previousTF, htf)
+		}
+		boredomCount = &sess.boredom
+	} else {
+		previous, previousTF = pg.previousInputs()
+	}
 
-	// Base dissonance: 1 - Jaccard similarity with previous interaction
+	dissonance, pulse := pg.measureDissonance(input, tf, trigrams, previous, previousTF)
+	wt := pg.weights()
+
+	// Boredom detection: repeated low dissonance → force creativity
+	dissonance, *boredomCount = applyBoredom(dissonance, *boredomCount, wt)
+	if *boredomCount >= 2 {
+		fmt.Fprintf(os.Stderr, "[dissonance] BOREDOM detected (%d repeats), forcing d=%.2f\n",
+			*boredomCount, dissonance)
+	}
+
+	dissonance = clampUnit(dissonance)
+
+	// Cloud morphing: active words grow, all words decay
+	pg.cloudMu.Lock()
+	for _, w := range words {
+		pg.cloud[w] = pg.cloud[w]*1.1 + 0.1 // active: boost
+	}
+	decay := pg.cloudDecay()
+	for w, v := range pg.cloud {
+		v *= decay // dormant: decay
+		if v < cloudPruneBelow {
+			delete(pg.cloud, w) // garbage collect dead words
+		} else {
+			pg.cloud[w] = v
+		}
+	}
+	pg.cloudMu.Unlock()
+
+	// Store for next interaction
+	if sess != nil {
+		sess.remember(input)
+		sess.dissonance = dissonance
+		sess.pulse = pulse
+	} else {
+		pg.rememberInput(trigrams, tf)
+	}
+
+	return dissonance, pulse
+}
+
+// memoryWindow is MemoryWindow with its default
+func (pg *PromptGenerator) memoryWindow() int {
+	return max(1, pg.MemoryWindow)
+}
+
+// previousInputs returns the remembered inputs' trigram sets and counts,
+// oldest first
+func (pg *PromptGenerator) previousInputs() ([]map[string]bool, []map[string]float32) {
+	var previous []map[string]bool
+	var previousTF []map[string]float32
+	for _, r := range pg.recent {
+		previous = append(previous, r.trigrams)
+		previousTF = append(previousTF, r.tf)
+	}
+	return previous, previousTF
+}
+
+// rememberInput appends an interaction, dropping the oldest beyond the
+// memory window
+func (pg *PromptGenerator) rememberInput(trigrams map[string]bool, tf map[string]float32) {
+	pg.recent = append(pg.recent, recentInput{trigrams: trigrams, tf: tf})
+	if over := len(pg.recent) - pg.memoryWindow(); over > 0 {
+		pg.recent = append(pg.recent[:0:0], pg.recent[over:]...)
+	}
+}
+
+// applyBoredom is the boredom rule: a low-dissonance input extends the
+// streak, and from the second in a row dissonance is forced high. Returns
+// the adjusted dissonance and the new streak.
+func applyBoredom(d float32, streak int, wt DissonanceWeights) (float32, int) {
+	if d >= 0.3 {
+		return d, 0
+	}
+	streak++
+	if streak >= 2 {
+		d = 0.7 + float32(streak)*wt.BoredomBoost
+	}
+	return d, streak
+}
+
+func (pg *PromptGenerator) weights() DissonanceWeights {
+	if pg.Weights == nil {
+		return DefaultDissonanceWeights
+	}
+	return *pg.Weights
+}
+
+// Reset forgets everything the dissonance system has accumulated: cloud,
+// boredom and the remembered inputs. Returns the state as it was.
+func (pg *PromptGenerator) Reset() ModelStats {
+	pg.cloudMu.Lock()
+	stats := ModelStats{Boredom: pg.boredomCount, CloudSize: len(pg.cloud)}
+	pg.cloud = make(map[string]float32)
+	pg.cloudMu.Unlock()
+
+	pg.boredomCount = 0
+	pg.recent = nil
+	return stats
+}
+
+// CloudSnapshot returns a copy of the current cloud weights
+func (pg *PromptGenerator) CloudSnapshot() map[string]float32 {
+	pg.cloudMu.RLock()
+	defer pg.cloudMu.RUnlock()
+	out := make(map[string]float32, len(pg.cloud))
+	for w, v := range pg.cloud {
+		out[w] = v
+	}
+	return out
+}
+
+// measureDissonance is the stateless part of dissonance: similarity to the
+// closest previous input, bent by the pulse and by trigram overlap. Reads
+// the cloud but changes nothing; the result is not yet clamped.
+func (pg *PromptGenerator) measureDissonance(input string, tf map[string]float32, trigrams map[string]bool, previous []map[string]bool, previousTF []map[string]float32) (float32, PulseSnapshot) {
+	lower := strings.ToLower(input)
+	words := textpulse.SplitWords(lower)
+	nWords := len(words)
+
+	// Base dissonance: 1 - similarity with the closest previous input
 	var similarity float32
-	if pg.lastTrigrams != nil {
-		similarity = jaccardSimilarity(trigrams, pg.lastTrigrams)
+	for i, prev := range previous {
+		var sim float32
+		if pg.Similarity == SimilarityCosine {
+			sim = textpulse.CosineSimilarity(tf, previousTF[i])
+		} else {
+			sim = textpulse.JaccardSimilarity(trigrams, prev)
+		}
+		if sim > similarity {
+			similarity = sim
+		}
 	}
 	dissonance := 1.0 - similarity
 
 	// Pulse: novelty (cloud-based, not static word list)
 	unknownCount := 0
+	pg.cloudMu.RLock()
 	for _, w := range words {
 		if pg.cloud[w] < 0.1 { // word not in cloud or decayed
 			unknownCount++
 		}
 	}
+	pg.cloudMu.RUnlock()
 	novelty := float32(unknownCount) / float32(nWords)
 
-	// Pulse: entropy (word diversity)
-	unique := make(map[string]bool)
-	for _, w := range words {
-		unique[w] = true
+	// Pulse: entropy (word diversity, with character entropy mixed in)
+	entropy := textpulse.WordEntropy(words)
+	if cw := pg.charEntropyWeight(nWords); cw > 0 {
+		entropy = (1-cw)*entropy + cw*textpulse.CharEntropy(lower)
 	}
-	entropy := float32(len(unique)) / float32(nWords)
 
 	// Pulse: arousal (emotional keyword density)
-	arousalCount := 0
-	for _, w := range words {
-		if arousalWords[w] {
-			arousalCount++
-		}
-	}
-	// Also check substrings for Russian stems
-	for aw := range arousalWords {
-		if strings.Contains(lower, aw) {
-			arousalCount++
-		}
-	}
-	arousal := float32(arousalCount) / float32(nWords+1)
+	arousalCount := len(arousalHits(lower, words))
+	emojiArousal, valence := emojiPulse(words)
+	arousal := (float32(arousalCount) + emojiArousal) / float32(nWords+1)
+	// Shouting and !!!/??? raise it further, lexicon or not
+	arousal += shoutArousal(input, nWords)
 	if arousal > 1.0 {
 		arousal = 1.0
 	}
@@ -267,89 +766,181 @@ func (pg *PromptGenerator) computeDissonance(input string) (float32, PulseSnapsh
 		Novelty: novelty,
 		Arousal: arousal,
 		Entropy: entropy,
+		Valence: valence,
 	}
 
 	// HAiKU pulse adjustments
+	wt := pg.weights()
 	if entropy > 0.7 {
-		dissonance *= 1.2 // high entropy → more dissonance
+		dissonance *= wt.EntropyBoost // high entropy → more dissonance
 	}
 	if arousal > 0.6 {
-		dissonance *= 1.15 // high arousal → more dissonance (unlike old code!)
+		dissonance *= wt.ArousalBoost // high arousal → more dissonance (unlike old code!)
 	}
 	if novelty > 0.7 {
-		dissonance *= 1.1 // high novelty → more dissonance
+		dissonance *= wt.NoveltyBoost // high novelty → more dissonance
 	}
 
 	// Trigram overlap reduces dissonance (system "recognizes" patterns)
 	trigramOverlap := 0
-	if pg.lastTrigrams != nil {
+	for _, prev := range previous {
 		for k := range trigrams {
-			if pg.lastTrigrams[k] {
+			if prev[k] {
 				trigramOverlap++
 			}
 		}
 	}
 	if trigramOverlap > 0 {
-		dissonance *= 0.7
+		dissonance *= wt.SimilarityPenalty
 	}
 
-	// Boredom detection: repeated low dissonance → force creativity
-	if dissonance < 0.3 {
-		pg.boredomCount++
-		if pg.boredomCount >= 2 {
-			// Boredom penalty: force high dissonance
-			dissonance = 0.7 + float32(pg.boredomCount)*0.1
-			fmt.Fprintf(os.Stderr, "[dissonance] BOREDOM detected (%d repeats), forcing d=%.2f\n",
-				pg.boredomCount, dissonance)
-		}
-	} else {
-		pg.boredomCount = 0
-	}
+	return dissonance, pulse
+}
 
-	// Clamp
-	if dissonance < 0 {
-		dissonance = 0
+// scoreDissonance rates how far text strays from against, without touching
+// boredom, the cloud or the previous-input memory. Used to rank candidates.
+func (pg *PromptGenerator) scoreDissonance(text, against string) float32 {
+	if len(textpulse.SplitWords(text)) == 0 {
+		return 1
 	}
-	if dissonance > 1 {
-		dissonance = 1
+	tf := pg.trigramCounts(text)
+	atf := pg.trigramCounts(against)
+	d, _ := pg.measureDissonance(text, tf, textpulse.NGramSet(tf), []map[string]bool{textpulse.NGramSet(atf)}, []map[string]float32{atf})
+	return clampUnit(d)
+}
+
+// surpriseScore is how little of input's word n-grams the prompt shares:
+// 1 - Jaccard similarity, so 0 is an echo and 1 shares nothing. Unlike
+// scoreDissonance it ignores the pulse and the generator's settings.
+func surpriseScore(input, prompt string) float32 {
+	a := textpulse.NGramSet(textpulse.ExtractNGrams(input))
+	b := textpulse.NGramSet(textpulse.ExtractNGrams(prompt))
+	return 1 - textpulse.JaccardSimilarity(a, b)
+}
+
+// charEntropyWeight is the share of character entropy in the pulse for an
+// input of nWords words
+func (pg *PromptGenerator) charEntropyWeight(nWords int) float32 {
+	if nWords == 1 {
+		return 1
 	}
+	return clampUnit(pg.CharEntropyWeight)
+}
 
-	// Cloud morphing: active words grow, all words decay
-	for _, w := range words {
-		pg.cloud[w] = pg.cloud[w]*1.1 + 0.1 // active: boost
+// clampUnit clamps x to [0, 1]
+func clampUnit(x float32) float32 {
+	if x < 0 {
+		return 0
 	}
-	for w, v := range pg.cloud {
-		pg.cloud[w] = v * 0.99 // dormant: decay
-		if pg.cloud[w] < 0.01 {
-			delete(pg.cloud, w) // garbage collect dead words
-		}
+	if x > 1 {
+		return 1
 	}
+	return x
+}
 
-	// Store trigrams for next interaction
-	pg.lastTrigrams = trigrams
-
-	return dissonance, pulse
+// cloudDecay is the per-interaction multiplier for cloud weights
+func (pg *PromptGenerator) cloudDecay() float32 {
+	if pg.CloudHalfLife <= 0 {
+		return defaultCloudDecay
+	}
+	return float32(math.Pow(0.5, 1/pg.CloudHalfLife))
 }
 
 // adaptTemperature maps dissonance to temperature.
 // HAiKU range: dissonance ∈ [0, 1] → temperature ∈ [0.3, 1.5]
 func (pg *PromptGenerator) adaptTemperature(input string, baseTemp float32) float32 {
-	d, _ := pg.computeDissonance(input)
+	d, pulse := pg.computeDissonance(input)
+	return pg.temperatureConfig().temperature(temperatureFactors(input, d, pulse, pg.boredomCount, baseTemp))
+}
 
-	// HAiKU mapping: d=0 → T=0.3, d=1 → T=1.5
-	temp := 0.3 + d*1.2
+// ExplainTemperature is adaptTemperature without the side effects: it
+// measures input against the current memory and reports the temperature
+// a reaction would use and what went into it. The cloud, boredom streak
+// and previous input are left as they were.
+func (pg *PromptGenerator) ExplainTemperature(input string, baseTemp float32) (float32, TemperatureFactors) {
+	d, pulse, streak := pg.peekDissonance(input)
+	f := temperatureFactors(input, d, pulse, streak, baseTemp)
+	return pg.temperatureConfig().temperature(f), f
+}
 
-	// Blend with base temp (40% caller hint)
-	temp = 0.6*temp + 0.4*float32(baseTemp)
+// ExplainPulse is the pulse a reaction to input would see, measured like
+// ExplainTemperature without touching the memory
+func (pg *PromptGenerator) ExplainPulse(input string) PulseSnapshot {
+	_, pulse, _ := pg.peekDissonance(input)
+	return pulse
+}
 
-	// Clamp to HAiKU range
-	if temp < 0.3 {
-		temp = 0.3
+// peekDissonance is computeDissonance without the side effects; it also
+// returns the boredom streak input would leave behind
+func (pg *PromptGenerator) peekDissonance(input string) (float32, PulseSnapshot, int) {
+	streak := pg.boredomCount
+	if len(textpulse.SplitWords(input)) == 0 {
+		return 1, PulseSnapshot{Novelty: 1.0, Entropy: 1.0}, streak
 	}
-	if temp > 1.5 {
-		temp = 1.5
+	tf := pg.trigramCounts(input)
+	previous, previousTF := pg.previousInputs()
+	d, pulse := pg.measureDissonance(input, tf, textpulse.NGramSet(tf), previous, previousTF)
+	d, streak = applyBoredom(d, streak, pg.weights())
+	return clampUnit(d), pulse, streak
+}
+
+// TemperatureConfig shapes how a reaction's temperature follows the input.
+// Dissonance spans [Min, Max]; the gains add on top for emotional, boring
+// and long inputs. The result is blended 60/40 with the caller's
+// temperature and clamped to [Min, Max].
+type TemperatureConfig struct {
+	Min         float32 `json:"min"`
+	Max         float32 `json:"max"`
+	ArousalGain float32 `json:"arousal_gain"` // per unit of pulse arousal
+	BoredomGain float32 `json:"boredom_gain"` // per consecutive boring input
+	LengthGain  float32 `json:"length_gain"`  // per unit of length (words / temperatureLengthWords, at most 1)
+}
+
+// DefaultTemperatureConfig is the HAiKU mapping: d=0 → 0.3, d=1 → 1.5, no gains
+var DefaultTemperatureConfig = TemperatureConfig{Min: 0.3, Max: 1.5}
+
+// temperatureLengthWords is the input length (in words) that counts as
+// fully long for TemperatureConfig.LengthGain
+const temperatureLengthWords = 20
+
+// TemperatureFactors are the inputs to TemperatureConfig's mapping
+type TemperatureFactors struct {
+	Dissonance float32 `json:"dissonance"`
+	Arousal    float32 `json:"arousal"`
+	Boredom    int     `json:"boredom"`
+	Length     float32 `json:"length"`
+	Base       float32 `json:"base"` // the caller's temperature
+}
+
+func temperatureFactors(input string, d float32, pulse PulseSnapshot, boredom int, baseTemp float32) TemperatureFactors {
+	length := float32(len(textpulse.SplitWords(input))) / temperatureLengthWords
+	if length > 1 {
+		length = 1
+	}
+	return TemperatureFactors{Dissonance: d, Arousal: pulse.Arousal, Boredom: boredom, Length: length, Base: baseTemp}
+}
+
+func (pg *PromptGenerator) temperatureConfig() TemperatureConfig {
+	if pg.Temperature == nil {
+		return DefaultTemperatureConfig
 	}
+	return *pg.Temperature
+}
+
+// temperature maps the factors into [c.Min, c.Max]
+func (c TemperatureConfig) temperature(f TemperatureFactors) float32 {
+	temp := c.Min + f.Dissonance*(c.Max-c.Min)
+	temp += c.ArousalGain*f.Arousal + c.BoredomGain*float32(f.Boredom) + c.LengthGain*f.Length
+
+	// Blend with base temp (40% caller hint)
+	temp = 0.6*temp + 0.4*f.Base
 
+	if temp < c.Min {
+		temp = c.Min
+	}
+	if temp > c.Max {
+		temp = c.Max
+	}
 	return temp
 }
 
@@ -357,38 +948,194 @@ func (pg *PromptGenerator) adaptTemperature(input string, baseTemp float32) floa
 // Oppositional: Yent pushes back, not describes.
 // Temperature adapts via HAiKU dissonance.
 func (pg *PromptGenerator) React(userInput string, maxTokens int, temperature float32) string {
+	return pg.ReactSession(userInput, nil, maxTokens, temperature)
+}
+
+// ReactSeeded is React drawing from a generator seeded with seed. It
+// measures the input against the memory without feeding it, so calls with
+// the same input and seed give the same prompt until an unseeded reaction
+// moves the memory on. seed 0 is React.
+func (pg *PromptGenerator) ReactSeeded(userInput string, maxTokens int, temperature float32, seed int64) string {
+	defer pg.seeded(seed)()
+	return pg.React(userInput, maxTokens, temperature)
+}
+
+// seeded swaps pg.rng for one seeded with seed and puts pg in replay
+// until restore is called, leaving the generator's own stream where it
+// was; 0 swaps nothing
+func (pg *PromptGenerator) seeded(seed int64) (restore func()) {
+	if seed == 0 {
+		return func() {}
+	}
+	saved := pg.rng
+	pg.rng, pg.replaying = rand.New(rand.NewSource(seed)), true
+	return func() { pg.rng, pg.replaying = saved, false }
+}
+
+// ReactSession is React judged against a conversation (sess may be nil).
+func (pg *PromptGenerator) ReactSession(userInput string, sess *Session, maxTokens int, temperature float32) string {
+	return pg.ReactBestOf(userInput, sess, maxTokens, temperature, 1)
+}
+
+// ReactBestOf is ReactSession that samples n candidate prompts and keeps the
+// one that strays furthest from the input (highest scoreDissonance). The
+// input's own dissonance — boredom, cloud, memory — is taken once per call,
+// not once per candidate. A seeded generator without a session only peeks
+// at it (see ReactSeeded); a session always moves on.
+func (pg *PromptGenerator) ReactBestOf(userInput string, sess *Session, maxTokens int, temperature float32, n int) string {
 	// Compute dissonance and adapt temperature
-	dissonance, pulse := pg.computeDissonance(userInput)
-	temperature = pg.adaptTemperature(userInput, temperature)
+	var dissonance float32
+	var pulse PulseSnapshot
+	var boredom int
+	if sess != nil {
+		dissonance, pulse = pg.computeSessionDissonance(userInput, sess)
+		temperature = pg.temperatureConfig().temperature(temperatureFactors(userInput, dissonance, pulse, sess.boredom, temperature))
+		sess.temperature = temperature
+		boredom = sess.boredom
+	} else if pg.replaying {
+		dissonance, pulse, boredom = pg.peekDissonance(userInput)
+		temperature = pg.temperatureConfig().temperature(temperatureFactors(userInput, dissonance, pulse, boredom, temperature))
+	} else {
+		dissonance, pulse = pg.computeDissonance(userInput)
+		temperature = pg.adaptTemperature(userInput, temperature)
+		boredom = pg.boredomCount
+	}
 	fmt.Fprintf(os.Stderr, "[react] input=%q d=%.2f T=%.2f pulse=[n=%.2f a=%.2f e=%.2f] boredom=%d\n",
-		userInput, dissonance, temperature, pulse.Novelty, pulse.Arousal, pulse.Entropy, pg.boredomCount)
-
-	lower := strings.ToLower(userInput)
-
-	// Find matching reaction template (oppositional)
-	var starter string
-	matched := false
-	for _, rt := range reactionTemplates {
-		for _, kw := range rt.keywords {
-			if strings.Contains(lower, kw) {
-				starter = rt.starters[pg.rng.Intn(len(rt.starters))]
-				matched = true
-				break
-			}
+		userInput, dissonance, temperature, pulse.Novelty, pulse.Arousal, pulse.Entropy, boredom)
+
+	return pg.bestOf(userInput, n, func() string {
+		return pg.generatePrompt(userInput, maxTokens, temperature, dissonance, pulse)
+	})
+}
+
+// bestOf draws n candidate prompts from next and returns the one
+// scoreDissonance rates furthest from userInput; the first wins ties, and
+// a single candidate isn't scored at all
+func (pg *PromptGenerator) bestOf(userInput string, n int, next func() string) string {
+	best := next()
+	if n <= 1 {
+		return best
+	}
+	bestScore := pg.scoreDissonance(best, userInput)
+	for i := 1; i < n; i++ {
+		cand := next()
+		if score := pg.scoreDissonance(cand, userInput); score > bestScore {
+			best, bestScore = cand, score
 		}
-		if matched {
-			break
+	}
+	fmt.Fprintf(os.Stderr, "[react] best of %d: d=%.2f %q\n", n, bestScore, best)
+	return best
+}
+
+// moodJitter is the largest random bonus pickTemplate adds to a
+// template's score, so near-ties between matches don't always go one way
+const moodJitter = 0.1
+
+// pickStarter draws a reaction starter from the template matching the
+// input (pickTemplate), in the input's language. Input no template knows
+// gets a default starter thrown at its own most salient words instead:
+// one of them, up to three as dissonance rises.
+func (pg *PromptGenerator) pickStarter(userInput string, dissonance float32, pulse PulseSnapshot) string {
+	russian := detectLanguage(userInput) == langRussian
+	if rt := pg.pickTemplate(inputWords(userInput), pulse); rt != nil {
+		if russian {
+			return rt.startersRU[pg.rng.Intn(len(rt.startersRU))]
+		}
+		return rt.starters[pg.rng.Intn(len(rt.starters))]
+	}
+
+	starter := defaultStarters[pg.rng.Intn(len(defaultStarters))]
+	if russian {
+		starter = defaultStartersRU[pg.rng.Intn(len(defaultStartersRU))]
+	}
+	if salient := pg.salientWords(userInput, 1+int(2*clampUnit(dissonance))); len(salient) > 0 {
+		starter += " " + strings.Join(salient, " ")
+	}
+	return starter
+}
+
+// salientWords picks up to n words of input to react to: the longest and
+// the rarest in the word cloud (length / (1 + cloud weight)), leaving out
+// short words and stop words. Best first.
+func (pg *PromptGenerator) salientWords(input string, n int) []string {
+	type scored struct {
+		word  string
+		score float32
+	}
+	stop := pg.stopWords()
+	seen := make(map[string]bool)
+	var cands []scored
+	pg.cloudMu.RLock()
+	for _, w := range inputWords(input) {
+		length := utf8.RuneCountInString(w)
+		if length < 3 || stop[w] || seen[w] {
+			continue
 		}
+		seen[w] = true
+		cands = append(cands, scored{w, float32(length) / (1 + pg.cloud[w])})
 	}
-	if !matched {
-		starter = defaultStarters[pg.rng.Intn(len(defaultStarters))]
+	pg.cloudMu.RUnlock()
+
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].score != cands[j].score {
+			return cands[i].score > cands[j].score
+		}
+		return cands[i].word < cands[j].word
+	})
+	words := make([]string, 0, n)
+	for _, c := range cands[:min(n, len(cands))] {
+		words = append(words, c.word)
+	}
+	return words
+}
+
+// pickTemplate returns the reaction template matching words, nil if none
+// does. Among several matches the one whose mood is closest to the pulse
+// (arousal, valence) wins, give or take moodJitter.
+func (pg *PromptGenerator) pickTemplate(words []string, pulse PulseSnapshot) *reactionTemplate {
+	var best *reactionTemplate
+	var bestScore float32
+	matches := 0
+	for i := range reactionTemplates {
+		rt := &reactionTemplates[i]
+		if !rt.matches(words) {
+			continue
+		}
+		matches++
+		if matches == 1 {
+			best = rt
+			continue
+		}
+		if matches == 2 {
+			// Only score once there is a choice: a lone match draws no randomness
+			bestScore = moodScore(best.mood, pulse) + moodJitter*pg.rng.Float32()
+		}
+		if score := moodScore(rt.mood, pulse) + moodJitter*pg.rng.Float32(); score > bestScore {
+			best, bestScore = rt, score
+		}
 	}
+	return best
+}
+
+// moodScore is the negative squared distance from m to the pulse's
+// (arousal, valence): 0 for a perfect fit
+func moodScore(m templateMood, pulse PulseSnapshot) float32 {
+	da := m.arousal - clampUnit(pulse.Arousal)
+	dv := m.valence - max(-1, min(1, pulse.Valence))
+	return -(da*da + dv*dv)
+}
+
+// generatePrompt samples one artist prompt: a reaction starter, the model's
+// completion and a style suffix chosen by the pulse
+func (pg *PromptGenerator) generatePrompt(userInput string, maxTokens int, temperature, dissonance float32, pulse PulseSnapshot) string {
+	starter := pg.pickStarter(userInput, dissonance, pulse)
 
 	// Feed user input as context with oppositional framing
 	context := fmt.Sprintf(`"%s" — Yent reacts: %s`, userInput, starter)
 	tokens := pg.tokenizer.Encode(context, true)
 
 	pg.model.Reset()
+	pg.sampler.forget()
 
 	pos := 0
 	for _, tok := range tokens {
@@ -403,7 +1150,7 @@ func (pg *PromptGenerator) React(userInput string, maxTokens int, temperature fl
 	var completion []byte
 	const maxCompletionBytes = 512
 	for i := 0; i < maxTokens; i++ {
-		next := pg.sampleTopK(temperature, 40)
+		next := pg.sampleNext(pg.TempSchedule.at(temperature, i, maxTokens))
 
 		if next == pg.tokenizer.EosID {
 			break
@@ -450,17 +1197,68 @@ func (pg *PromptGenerator) React(userInput string, maxTokens int, temperature fl
 		result = starter + " chaos and defiance"
 	}
 
-	suffix := styleSuffixes[pg.rng.Intn(len(styleSuffixes))]
+	suffix := selectStyleSuffix(pulse, pg.rng)
 	return result + suffix
 }
 
 // Roast generates a verbal reaction to mock the user (for commentator role)
 func (pg *PromptGenerator) Roast(userInput string, maxTokens int, temperature float32) string {
-	context := fmt.Sprintf(`User said: "%s"
-Yent (cynical, mocking): `, userInput)
+	return pg.RoastSession(userInput, nil, maxTokens, temperature)
+}
+
+// RoastSession is Roast with the conversation so far in the context, so the
+// commentator can hold a grudge. history is oldest first.
+func (pg *PromptGenerator) RoastSession(userInput string, history []string, maxTokens int, temperature float32) string {
+	return pg.roast(userInput, history, "", maxTokens, temperature, nil)
+}
+
+// RoastArt is RoastSession that also sees the artist's finished prompt, so
+// the commentator can mock the picture as well as the user.
+func (pg *PromptGenerator) RoastArt(userInput string, history []string, artPrompt string, maxTokens int, temperature float32) string {
+	return pg.roast(userInput, history, artPrompt, maxTokens, temperature, nil)
+}
+
+// RoastStream is Roast yielding token pieces as they are sampled.
+// The channel closes once the roast is complete.
+func (pg *PromptGenerator) RoastStream(userInput string, maxTokens int, temperature float32) <-chan string {
+	return pg.RoastSessionStream(userInput, nil, maxTokens, temperature)
+}
+
+// RoastSessionStream is RoastSession yielding token pieces as they are
+// sampled. Leading whitespace is dropped, so the pieces concatenate to the
+// RoastSession text (modulo trailing space).
+func (pg *PromptGenerator) RoastSessionStream(userInput string, history []string, maxTokens int, temperature float32) <-chan string {
+	return pg.RoastArtStream(userInput, history, "", maxTokens, temperature)
+}
+
+// RoastArtStream is RoastArt yielding token pieces as they are sampled
+func (pg *PromptGenerator) RoastArtStream(userInput string, history []string, artPrompt string, maxTokens int, temperature float32) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		started := false
+		pg.roast(userInput, history, artPrompt, maxTokens, temperature, func(piece string) {
+			if !started {
+				piece = strings.TrimLeft(piece, " \t\n")
+				if piece == "" {
+					return
+				}
+				started = true
+			}
+			ch <- piece
+		})
+	}()
+	return ch
+}
+
+// roast samples the commentator's line, handing each accepted piece to emit
+// (optional) as it goes. artPrompt may be empty.
+func (pg *PromptGenerator) roast(userInput string, history []string, artPrompt string, maxTokens int, temperature float32, emit func(piece string)) string {
+	context := roastContext(userInput, history, artPrompt)
 	tokens := pg.tokenizer.Encode(context, true)
 
 	pg.model.Reset()
+	pg.sampler.forget()
 
 	pos := 0
 	for _, tok := range tokens {
@@ -473,7 +1271,7 @@ Yent (cynical, mocking): `, userInput)
 
 	var output []byte
 	for i := 0; i < maxTokens; i++ {
-		next := pg.sampleTopK(temperature, 40)
+		next := pg.sampleNext(temperature)
 
 		if next == pg.tokenizer.EosID {
 			break
@@ -492,6 +1290,9 @@ Yent (cynical, mocking): `, userInput)
 		}
 
 		output = append(output, []byte(piece)...)
+		if emit != nil {
+			emit(piece)
+		}
 
 		if len(output) > 300 {
 			break
@@ -507,11 +1308,27 @@ Yent (cynical, mocking): `, userInput)
 	return strings.TrimSpace(string(output))
 }
 
+// roastContext builds the commentator's prompt, earlier lines first, then
+// the artist's prompt when there is one
+func roastContext(userInput string, history []string, artPrompt string) string {
+	var b strings.Builder
+	for _, h := range history {
+		fmt.Fprintf(&b, "User said earlier: \"%s\"\n", h)
+	}
+	fmt.Fprintf(&b, "User said: \"%s\"\n", userInput)
+	if artPrompt != "" {
+		fmt.Fprintf(&b, "Yent drew: \"%s\"\n", artPrompt)
+	}
+	b.WriteString("Yent (cynical, mocking): ")
+	return b.String()
+}
+
 // Generate creates an image prompt by completing a seed phrase (legacy mode)
 func (pg *PromptGenerator) Generate(seedPhrase string, maxTokens int, temperature float32) string {
 	tokens := pg.tokenizer.Encode(seedPhrase, false)
 
 	pg.model.Reset()
+	pg.sampler.forget()
 
 	pos := 0
 	for _, tok := range tokens {
@@ -526,7 +1343,7 @@ func (pg *PromptGenerator) Generate(seedPhrase string, maxTokens int, temperatur
 	output = append(output, []byte(seedPhrase)...)
 
 	for i := 0; i < maxTokens; i++ {
-		next := pg.sampleTopK(temperature, 40)
+		next := pg.sampleNext(temperature)
 
 		if next == pg.tokenizer.EosID {
 			break
@@ -557,34 +1374,138 @@ type idxVal struct {
 	val float32
 }
 
-// sampleTopK samples from top-k logits (reuses buffers to avoid per-token allocations)
-func (pg *PromptGenerator) sampleTopK(temp float32, topK int) int {
-	logits := pg.model.State.Logits
-	vocab := pg.model.Config.VocabSize
+// defaultTopK is Sampling.TopK when unset
+const defaultTopK = 40
+
+// Sampling truncates the next-token distribution before a token is drawn
+// from it. The zero value is plain top-40 sampling.
+type Sampling struct {
+	// TopK keeps only the K likeliest tokens; 0 → defaultTopK
+	TopK int
+
+	// TopP keeps the smallest set of the likeliest tokens whose
+	// probabilities add up to at least TopP (nucleus sampling), within
+	// TopK; 0 or 1 turns it off
+	TopP float32
+
+	// RepeatPenalty pushes down the logit of every token emitted in the
+	// last repeatWindow draws, once per time it was emitted there: a
+	// positive logit is divided by it, a negative one multiplied. 0 or 1
+	// turns it off; 1.1–1.5 is enough to break "you suck you suck".
+	RepeatPenalty float32
+}
+
+// over is base with every non-zero field of s put on top of it
+func (s Sampling) over(base Sampling) Sampling {
+	if s.TopK != 0 {
+		base.TopK = s.TopK
+	}
+	if s.TopP != 0 {
+		base.TopP = s.TopP
+	}
+	if s.RepeatPenalty != 0 {
+		base.RepeatPenalty = s.RepeatPenalty
+	}
+	return base
+}
+
+// repeatWindow is how many of the latest tokens Sampling.RepeatPenalty
+// remembers
+const repeatWindow = 64
+
+// sampleNext draws the next token from the model's logits with pg.Sampling
+func (pg *PromptGenerator) sampleNext(temp float32) int {
+	return pg.sampler.sample(pg.model.State.Logits[:pg.model.Config.VocabSize], temp, pg.Sampling, pg.rng)
+}
+
+// sampler holds scratch space reused across tokens, so sampling doesn't
+// allocate per token
+type sampler struct {
+	top   []idxVal
+	probs []float32
+
+	// The tokens drawn since forget, for the repeat penalty: the last
+	// repeatWindow of them in recent, how often each occurs there in seen
+	recent []int
+	seen   []int
+}
+
+// forget clears the repeat penalty's memory; call it before a new text
+func (sp *sampler) forget() {
+	for _, tok := range sp.recent {
+		sp.seen[tok]--
+	}
+	sp.recent = sp.recent[:0]
+}
+
+// sample draws a token index from logits at temperature temp, truncated
+// and penalized as s says. temp <= 0 is greedy. logits is not modified.
+func (sp *sampler) sample(logits []float32, temp float32, s Sampling, rng *rand.Rand) int {
+	if s.RepeatPenalty <= 1 {
+		return sp.draw(logits, temp, s, rng, nil)
+	}
+	if len(sp.seen) != len(logits) {
+		sp.seen = make([]int, len(logits))
+		sp.recent = sp.recent[:0]
+	}
+	penalty := s.RepeatPenalty
+	tok := sp.draw(logits, temp, s, rng, func(i int, v float32) float32 {
+		for c := sp.seen[i]; c > 0; c-- {
+			if v > 0 {
+				v /= penalty
+			} else {
+				v *= penalty
+			}
+		}
+		return v
+	})
+
+	if len(sp.recent) == repeatWindow {
+		sp.seen[sp.recent[0]]--
+		sp.recent = append(sp.recent[:0], sp.recent[1:]...)
+	}
+	sp.recent = append(sp.recent, tok)
+	sp.seen[tok]++
+	return tok
+}
 
+// draw is sample's draw proper; adjust, when set, rewrites each logit
+// before it is compared
+func (sp *sampler) draw(logits []float32, temp float32, s Sampling, rng *rand.Rand, adjust func(i int, v float32) float32) int {
+	vocab := len(logits)
+	logit := func(i int) float32 {
+		if adjust == nil {
+			return logits[i]
+		}
+		return adjust(i, logits[i])
+	}
 	if temp <= 0 {
-		best := 0
+		best, bestVal := 0, logit(0)
 		for i := 1; i < vocab; i++ {
-			if logits[i] > logits[best] {
-				best = i
+			if v := logit(i); v > bestVal {
+				best, bestVal = i, v
 			}
 		}
 		return best
 	}
 
-	// Reuse or grow buffers
-	if cap(pg.topKBuf) < topK {
-		pg.topKBuf = make([]idxVal, topK)
-		pg.probsBuf = make([]float32, topK)
+	topK := s.TopK
+	if topK <= 0 {
+		topK = defaultTopK
 	}
-	top := pg.topKBuf[:topK]
-	for i := 0; i < topK; i++ {
+	topK = min(topK, vocab)
+	if cap(sp.top) < topK {
+		sp.top = make([]idxVal, topK)
+		sp.probs = make([]float32, topK)
+	}
+	top := sp.top[:topK]
+	for i := range top {
 		top[i] = idxVal{-1, -1e30}
 	}
 
 	for i := 0; i < vocab; i++ {
-		if logits[i] > top[topK-1].val {
-			top[topK-1] = idxVal{i, logits[i]}
+		if v := logit(i); v > top[topK-1].val {
+			top[topK-1] = idxVal{i, v}
 			for j := topK - 1; j > 0 && top[j].val > top[j-1].val; j-- {
 				top[j], top[j-1] = top[j-1], top[j]
 			}
@@ -592,19 +1513,29 @@ func (pg *PromptGenerator) sampleTopK(temp float32, topK int) int {
 	}
 
 	maxVal := top[0].val
-	probs := pg.probsBuf[:topK]
+	probs := sp.probs[:topK]
 	var sum float32
-	for i := 0; i < topK; i++ {
-		if top[i].idx < 0 {
-			break
+	n := 0
+	for ; n < topK && top[n].idx >= 0; n++ {
+		probs[n] = float32(math.Exp(float64((top[n].val - maxVal) / temp)))
+		sum += probs[n]
+	}
+
+	// Nucleus: cut the tail once the kept mass reaches TopP (top is sorted)
+	if s.TopP > 0 && s.TopP < 1 {
+		var kept float32
+		for i := 0; i < n; i++ {
+			kept += probs[i]
+			if kept >= s.TopP*sum {
+				n, sum = i+1, kept
+				break
+			}
 		}
-		probs[i] = float32(math.Exp(float64((top[i].val - maxVal) / temp)))
-		sum += probs[i]
 	}
 
-	r := pg.rng.Float32() * sum
+	r := rng.Float32() * sum
 	var cdf float32
-	for i := 0; i < topK; i++ {
+	for i := 0; i < n; i++ {
 		cdf += probs[i]
 		if r <= cdf {
 			return top[i].idx
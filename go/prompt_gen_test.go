@@ -1,78 +1,74 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"math"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
 	"time"
-)
 
-// --- Trigram extraction ---
+	"yentyo/textpulse"
+)
 
-func TestExtractTrigrams(t *testing.T) {
-	tests := []struct {
-		input string
-		want  int // minimum expected trigrams
-	}{
-		{"hello world", 2},                        // 1 bigram + 2 words
-		{"the meaning of life", 6},                // 2 trigrams + 3 bigrams + 4 words (minus dups)
-		{"hi", 1},                                 // just the word
-		{"a b c d e", 8},                          // lots of trigrams+bigrams+words
-		{"", 0},                                   // empty
-		{"ненавижу всё это дерьмо", 4},            // russian
+func TestStemmingRaisesJaccard(t *testing.T) {
+	a, b := "I am running", "I run"
+	sim := func(pg *PromptGenerator) float32 {
+		return textpulse.JaccardSimilarity(textpulse.NGramSet(pg.trigramCounts(a)), textpulse.NGramSet(pg.trigramCounts(b)))
 	}
 
-	for _, tt := range tests {
-		trigrams := extractTrigrams(tt.input)
-		if len(trigrams) < tt.want {
-			t.Errorf("extractTrigrams(%q) = %d trigrams, want >= %d", tt.input, len(trigrams), tt.want)
-		}
+	pg := newTestPG()
+	plain := sim(pg)
+	pg.Stem = true
+	stemmed := sim(pg)
+	if stemmed < 2*plain {
+		t.Errorf("jaccard with stemming = %.3f, want at least double %.3f", stemmed, plain)
 	}
 }
 
-func TestExtractTrigramsIncludesWords(t *testing.T) {
-	trigrams := extractTrigrams("hello world")
-	if !trigrams["hello"] {
-		t.Error("expected 'hello' in trigrams")
+func TestStopWordFiltering(t *testing.T) {
+	a, b := "the meaning of the life", "meaning life"
+	pg := newTestPG()
+	pg.DropStopWords = true
+	if sim := textpulse.JaccardSimilarity(textpulse.NGramSet(pg.trigramCounts(a)), textpulse.NGramSet(pg.trigramCounts(b))); sim < 0.99 {
+		t.Errorf("jaccard with stop words dropped = %.3f, want ~1", sim)
 	}
-	if !trigrams["world"] {
-		t.Error("expected 'world' in trigrams")
+
+	// Entropy still reflects the raw text: "the" repeats
+	_, pulse := pg.computeDissonance(a)
+	if pulse.Entropy != 0.8 {
+		t.Errorf("entropy = %.2f, want 0.8 (4 unique of 5 raw words)", pulse.Entropy)
 	}
-	if !trigrams["hello world"] {
-		t.Error("expected bigram 'hello world' in trigrams")
+
+	pg.StopWords = map[string]bool{"meaning": true}
+	if got := pg.trigramTokens(b); len(got) != 1 || got[0] != "life" {
+		t.Errorf("custom stop words: tokens = %v, want [life]", got)
 	}
 }
 
-// --- Jaccard similarity ---
+func TestCosineVsJaccardOnRepetition(t *testing.T) {
+	a, b := "the the the cat", "the cat"
 
-func TestJaccardSimilarity(t *testing.T) {
-	a := map[string]bool{"a": true, "b": true, "c": true}
-	b := map[string]bool{"b": true, "c": true, "d": true}
-
-	sim := jaccardSimilarity(a, b)
-	// intersection = {b, c} = 2, union = {a, b, c, d} = 4 → 0.5
-	if math.Abs(float64(sim)-0.5) > 0.01 {
-		t.Errorf("jaccardSimilarity = %.3f, want 0.5", sim)
+	jac := textpulse.JaccardSimilarity(textpulse.NGramSet(textpulse.ExtractNGrams(a)), textpulse.NGramSet(textpulse.ExtractNGrams(b)))
+	cos := textpulse.CosineSimilarity(textpulse.ExtractNGrams(a), textpulse.ExtractNGrams(b))
+	if cos <= jac {
+		t.Errorf("cosine %.3f should exceed jaccard %.3f on a repetition-heavy pair", cos, jac)
 	}
 
-	// Identical sets
-	sim = jaccardSimilarity(a, a)
-	if math.Abs(float64(sim)-1.0) > 0.01 {
-		t.Errorf("jaccardSimilarity(a, a) = %.3f, want 1.0", sim)
-	}
+	// Same contrast through computeDissonance
+	pgJ := newTestPG()
+	pgJ.computeDissonance(b)
+	dJ, _ := pgJ.computeDissonance(a)
 
-	// Disjoint sets
-	c := map[string]bool{"x": true, "y": true}
-	sim = jaccardSimilarity(a, c)
-	if sim != 0 {
-		t.Errorf("jaccardSimilarity(disjoint) = %.3f, want 0.0", sim)
-	}
+	pgC := newTestPG()
+	pgC.Similarity = SimilarityCosine
+	pgC.computeDissonance(b)
+	dC, _ := pgC.computeDissonance(a)
 
-	// Empty sets
-	sim = jaccardSimilarity(map[string]bool{}, map[string]bool{})
-	if sim != 0 {
-		t.Errorf("jaccardSimilarity(empty, empty) = %.3f, want 0.0", sim)
+	if dC >= dJ {
+		t.Errorf("cosine dissonance %.3f should be below jaccard dissonance %.3f", dC, dJ)
 	}
 }
 
@@ -113,6 +109,41 @@ func TestDissonanceRepeatedInput(t *testing.T) {
 	}
 }
 
+func TestDissonanceMemoryWindow(t *testing.T) {
+	history := []string{"the red fox sleeps", "paint me a lighthouse", "why is the sky loud"}
+	primed := func(window int) *PromptGenerator {
+		pg := newTestPG()
+		pg.MemoryWindow = window
+		for _, in := range history {
+			pg.computeDissonance(in)
+		}
+		return pg
+	}
+
+	// Two turns back, "the red fox sleeps" is still in a 3-input window
+	pg := primed(3)
+	if len(pg.recent) != 3 {
+		t.Fatalf("remembered %d inputs, want 3", len(pg.recent))
+	}
+	familiar, _ := pg.computeDissonance("the red fox sleeps")
+	novel, _ := primed(3).computeDissonance("seven quiet engines hum")
+	if familiar >= novel {
+		t.Errorf("K=3: repeat from two turns ago d=%.3f, want below novel d=%.3f", familiar, novel)
+	}
+
+	// With the default window it has already been forgotten
+	forgotten, _ := primed(0).computeDissonance("the red fox sleeps")
+	if familiar >= forgotten {
+		t.Errorf("K=3 d=%.3f should be below K=1 d=%.3f for the same repeat", familiar, forgotten)
+	}
+
+	// The window slides: the oldest input drops out
+	pg.computeDissonance("one more thing")
+	if len(pg.recent) != 3 || !pg.recent[0].trigrams["why is the"] || !pg.recent[2].trigrams["one more thing"] {
+		t.Error("memory window should hold the last 3 inputs, oldest first")
+	}
+}
+
 func TestDissonanceBoredomDetection(t *testing.T) {
 	pg := newTestPG()
 
@@ -152,6 +183,56 @@ func TestDissonanceCloudMorphing(t *testing.T) {
 	}
 }
 
+func TestCloudDecayHalfLife(t *testing.T) {
+	pg := newTestPG()
+	if d := pg.cloudDecay(); d != 0.99 {
+		t.Errorf("default decay = %v, want 0.99", d)
+	}
+	pg.CloudHalfLife = 10
+	w := float32(1)
+	for i := 0; i < 10; i++ {
+		w *= pg.cloudDecay()
+	}
+	if math.Abs(float64(w)-0.5) > 1e-4 {
+		t.Errorf("weight after one half-life = %.5f, want 0.5", w)
+	}
+}
+
+func TestCloudForgetsOldWords(t *testing.T) {
+	pg := newTestPG()
+	pg.CloudHalfLife = 5
+
+	// Obsess over one word, then talk about other things
+	for i := 0; i < 5; i++ {
+		pg.computeDissonance("pineapple pineapple")
+	}
+	if pg.cloud["pineapple"] < 0.5 {
+		t.Fatalf("cloud['pineapple'] = %.3f after repetition, want >= 0.5", pg.cloud["pineapple"])
+	}
+	_, pulse := pg.computeDissonance("pineapple")
+	if pulse.Novelty != 0 {
+		t.Fatalf("novelty while obsessed = %.2f, want 0", pulse.Novelty)
+	}
+
+	others := []string{"grey concrete rain", "a dog barking", "static on the radio"}
+	for i := 0; i < 60 && pg.cloud["pineapple"] > 0; i++ {
+		pg.computeDissonance(others[i%len(others)])
+	}
+	if _, ok := pg.cloud["pineapple"]; ok {
+		t.Fatalf("cloud['pineapple'] = %.4f, want pruned", pg.cloud["pineapple"])
+	}
+	for w, v := range pg.cloud {
+		if v < cloudPruneBelow {
+			t.Errorf("cloud[%q] = %.4f left below prune threshold", w, v)
+		}
+	}
+
+	_, pulse = pg.computeDissonance("pineapple")
+	if pulse.Novelty != 1 {
+		t.Errorf("novelty after forgetting = %.2f, want 1", pulse.Novelty)
+	}
+}
+
 func TestDissonanceArousal(t *testing.T) {
 	pg := newTestPG()
 
@@ -171,6 +252,42 @@ func TestDissonanceArousal(t *testing.T) {
 
 // --- Temperature adaptation ---
 
+func TestDissonanceWeightsArousal(t *testing.T) {
+	run := func(w *DissonanceWeights) (float32, PulseSnapshot) {
+		pg := newTestPG()
+		pg.Weights = w
+		pg.computeDissonance("i hate the pain")
+		pg.computeDissonance("the grey sky")
+		return pg.computeDissonance("the pain hurts")
+	}
+
+	base, pulse := run(nil)
+	if pulse.Arousal <= 0.6 {
+		t.Fatalf("arousal = %.2f, want > 0.6 for this input", pulse.Arousal)
+	}
+	if base >= 1 {
+		t.Fatalf("default dissonance = %.3f, want < 1 so a boost is visible", base)
+	}
+
+	hot := DefaultDissonanceWeights
+	hot.ArousalBoost = 2
+	cranked, _ := run(&hot)
+	if cranked <= base {
+		t.Errorf("dissonance with ArousalBoost=2 = %.3f, want > default %.3f", cranked, base)
+	}
+}
+
+func TestTemperamentsComplete(t *testing.T) {
+	if Temperaments["default"] != DefaultDissonanceWeights {
+		t.Error("default temperament should match DefaultDissonanceWeights")
+	}
+	for name, w := range Temperaments {
+		if w.SimilarityPenalty <= 0 || w.NoveltyBoost <= 0 || w.ArousalBoost <= 0 || w.EntropyBoost <= 0 {
+			t.Errorf("temperament %q has a zero multiplier: %+v", name, w)
+		}
+	}
+}
+
 func TestAdaptTemperatureRange(t *testing.T) {
 	pg := newTestPG()
 
@@ -190,6 +307,45 @@ func TestAdaptTemperatureRange(t *testing.T) {
 	}
 }
 
+func TestTemperatureArousalGain(t *testing.T) {
+	pg := newTestPG()
+	const input = "I hate you, I love you, I want to scream and burn"
+
+	base, f := pg.ExplainTemperature(input, 0.3)
+	if f.Arousal <= 0 {
+		t.Fatalf("arousal = %.2f for %q, want > 0", f.Arousal, input)
+	}
+	prev := base
+	for _, gain := range []float32{0.5, 1, 10} {
+		cfg := DefaultTemperatureConfig
+		cfg.ArousalGain = gain
+		pg.Temperature = &cfg
+		temp, _ := pg.ExplainTemperature(input, 0.3)
+		if temp < cfg.Min || temp > cfg.Max {
+			t.Errorf("gain %.1f: T = %.3f, want ∈ [%.1f, %.1f]", gain, temp, cfg.Min, cfg.Max)
+		}
+		if temp <= prev && temp < cfg.Max {
+			t.Errorf("gain %.1f: T = %.3f, want above %.3f", gain, temp, prev)
+		}
+		prev = temp
+	}
+}
+
+func TestExplainTemperatureMatchesAdapt(t *testing.T) {
+	pg := newTestPG()
+	pg.computeDissonance("the sea at night")
+
+	explained, _ := pg.ExplainTemperature("the sea at dawn", 0.8)
+	cloud, boredom := len(pg.cloud), pg.boredomCount
+	explained2, _ := pg.ExplainTemperature("the sea at dawn", 0.8)
+	if explained2 != explained || len(pg.cloud) != cloud || pg.boredomCount != boredom {
+		t.Fatal("ExplainTemperature changed the generator's memory")
+	}
+	if got := pg.adaptTemperature("the sea at dawn", 0.8); got != explained {
+		t.Errorf("adaptTemperature = %.3f, ExplainTemperature = %.3f", got, explained)
+	}
+}
+
 // --- Oppositional template matching ---
 
 func TestReactionTemplateMatching(t *testing.T) {
@@ -209,49 +365,69 @@ func TestReactionTemplateMatching(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		lower := toLowerStr(tt.input)
-		matched := false
-		for _, rt := range reactionTemplates {
-			for _, kw := range rt.keywords {
-				if containsStr(lower, kw) {
-					matched = true
-					break
-				}
-			}
-			if matched {
-				break
-			}
-		}
-		if matched != tt.wantHit {
-			t.Errorf("template match for %q: got %v, want %v", tt.input, matched, tt.wantHit)
+		if got := matchesAnyTemplate(tt.input); got != tt.wantHit {
+			t.Errorf("template match for %q: got %v, want %v", tt.input, got, tt.wantHit)
 		}
 	}
 }
 
-// helpers (can't import strings in test scope easily, inline)
-func toLowerStr(s string) string {
-	b := make([]byte, len(s))
-	for i := range s {
-		c := s[i]
-		if c >= 'A' && c <= 'Z' {
-			c += 32
+// matchesAnyTemplate reports whether input triggers some reaction template
+func matchesAnyTemplate(input string) bool {
+	words := inputWords(input)
+	for _, rt := range reactionTemplates {
+		if rt.matches(words) {
+			return true
 		}
-		b[i] = c
 	}
-	return string(b)
+	return false
 }
 
-func containsStr(s, sub string) bool {
-	return len(s) >= len(sub) && searchStr(s, sub) >= 0
-}
+func TestReactionTemplateWordBoundaries(t *testing.T) {
+	sad := reactionTemplates[0]
+	for input, want := range map[string]bool{
+		"I am sad":     true,
+		"classic":      false,
+		"saddle up":    false,
+		"crying again": true,
+	} {
+		if got := sad.matches(inputWords(input)); got != want {
+			t.Errorf("sad template on %q: got %v, want %v", input, got, want)
+		}
+	}
 
-func searchStr(s, sub string) int {
-	for i := 0; i <= len(s)-len(sub); i++ {
-		if s[i:i+len(sub)] == sub {
-			return i
+	angry, love := reactionTemplates[1], reactionTemplates[2]
+	for input, want := range map[string]bool{
+		"hated":        true,
+		"she hates me": true,
+		"hating it":    true,
+		"a hat":        false, // not "hate"
+		"two hats":     false,
+	} {
+		if got := angry.matches(inputWords(input)); got != want {
+			t.Errorf("angry template on %q: got %v, want %v", input, got, want)
+		}
+	}
+	for _, input := range []string{"loved", "loving", "she loves me"} {
+		if !love.matches(inputWords(input)) {
+			t.Errorf("love template missed %q", input)
+		}
+	}
+	for input, want := range map[string]bool{
+		"this is fine":        false, // not "hi"
+		"a soldier on a diet": false, // not "die"
+		"education":           false, // not "cat"
+		"two cats":            true,
+		"the ducks are hated": true,
+		"cathedral":           false, // not "cat"
+		"который час":         false, // not "кот"
+		"нарисуй утку":        true,
+		"грустно":             true,
+		"Hi!":                 true,
+	} {
+		if got := matchesAnyTemplate(input); got != want {
+			t.Errorf("template match for %q: got %v, want %v", input, got, want)
 		}
 	}
-	return -1
 }
 
 // --- Sketch generation ---
@@ -260,19 +436,19 @@ func TestGenerateSketchLine(t *testing.T) {
 	rng := rand.New(rand.NewSource(42))
 
 	// Draft 0: sparse
-	line0 := generateSketchLine(50, 0, 7, 15, []string{"hello"}, rng)
+	line0 := generateSketchLine(50, 0, 7, 15, nil, []string{"hello"}, nil, rng)
 	if len(line0) != 50 {
 		t.Errorf("line0 length = %d, want 50", len(line0))
 	}
 
 	// Draft 1: some structure
-	line1 := generateSketchLine(50, 1, 7, 15, []string{"test"}, rng)
+	line1 := generateSketchLine(50, 1, 7, 15, nil, []string{"test"}, nil, rng)
 	if len(line1) != 50 {
 		t.Errorf("line1 length = %d, want 50", len(line1))
 	}
 
 	// Draft 2: denser
-	line2 := generateSketchLine(50, 2, 7, 15, []string{"world"}, rng)
+	line2 := generateSketchLine(50, 2, 7, 15, nil, []string{"world"}, nil, rng)
 	if len(line2) != 50 {
 		t.Errorf("line2 length = %d, want 50", len(line2))
 	}
@@ -293,8 +469,8 @@ func TestGenerateSketchLine(t *testing.T) {
 	// Run multiple times to average
 	var avg0, avg2 float64
 	for trial := 0; trial < 100; trial++ {
-		l0 := generateSketchLine(50, 0, 7, 15, nil, rng)
-		l2 := generateSketchLine(50, 2, 7, 15, nil, rng)
+		l0 := generateSketchLine(50, 0, 7, 15, nil, nil, nil, rng)
+		l2 := generateSketchLine(50, 2, 7, 15, nil, nil, nil, rng)
 		avg0 += float64(count(l0))
 		avg2 += float64(count(l2))
 	}
@@ -312,6 +488,284 @@ func TestSketchCharsNotEmpty(t *testing.T) {
 	}
 }
 
+func TestGenerateSketchLineCustomRamp(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	ramp := []rune(" ░▒▓█")
+	allowed := map[rune]bool{}
+	for _, r := range ramp {
+		allowed[r] = true
+	}
+
+	sawBlock := false
+	for draft := 0; draft < 3; draft++ {
+		for y := 0; y < 15; y++ {
+			line := generateSketchLine(50, draft, y, 15, ramp, nil, nil, rng)
+			if n := len([]rune(line)); n != 50 {
+				t.Errorf("draft %d line %d has %d runes, want 50", draft, y, n)
+			}
+			for _, r := range line {
+				if !allowed[r] {
+					t.Fatalf("glyph %q not in custom ramp", r)
+				}
+				if r != ' ' {
+					sawBlock = true
+				}
+			}
+		}
+	}
+	if !sawBlock {
+		t.Error("custom ramp glyphs should appear in the sketch")
+	}
+}
+
+func TestGenerateSketchLineOddWords(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	long := strings.Repeat("ы", 60) // wider than the line
+	for _, words := range [][]string{{long}, {""}, {"", long, "duck"}} {
+		for draft := 0; draft < 3; draft++ {
+			for y := 0; y < 15; y++ {
+				if n := len([]rune(generateSketchLine(50, draft, y, 15, nil, words, nil, rng))); n != 50 {
+					t.Fatalf("words %q draft %d line %d: %d runes, want 50", words, draft, y, n)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateSketchLinePulse(t *testing.T) {
+	ink := func(pulse *PulseSnapshot, draft int, seed int64) int {
+		rng := rand.New(rand.NewSource(seed))
+		n := 0
+		for y := 0; y < 15; y++ {
+			for _, c := range generateSketchLine(50, draft, y, 15, nil, nil, pulse, rng) {
+				if c != ' ' {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	calm := &PulseSnapshot{Arousal: 0.05, Entropy: 0.5}
+	wild := &PulseSnapshot{Arousal: 0.95, Entropy: 0.5}
+	for draft := 0; draft < 3; draft++ {
+		var lo, hi int
+		for seed := int64(0); seed < 20; seed++ {
+			lo += ink(calm, draft, seed)
+			hi += ink(wild, draft, seed)
+		}
+		if hi <= lo {
+			t.Errorf("draft %d: high arousal inked %d cells, low arousal %d; want denser", draft, hi, lo)
+		}
+	}
+
+	// Same seed, same pulse → same draft; the midpoint pulse is the neutral one
+	mid := &PulseSnapshot{Arousal: 0.5, Entropy: 0.5}
+	for draft := 0; draft < 3; draft++ {
+		a := generateSketchLine(50, draft, 7, 15, nil, []string{"duck"}, wild, rand.New(rand.NewSource(3)))
+		b := generateSketchLine(50, draft, 7, 15, nil, []string{"duck"}, wild, rand.New(rand.NewSource(3)))
+		if a != b {
+			t.Errorf("draft %d isn't deterministic for a seed", draft)
+		}
+		n := generateSketchLine(50, draft, 7, 15, nil, []string{"duck"}, nil, rand.New(rand.NewSource(3)))
+		m := generateSketchLine(50, draft, 7, 15, nil, []string{"duck"}, mid, rand.New(rand.NewSource(3)))
+		if n != m {
+			t.Errorf("draft %d: nil pulse %q != midpoint pulse %q", draft, n, m)
+		}
+	}
+}
+
+func TestDraftsForDissonance(t *testing.T) {
+	cfg := DefaultSketchConfig()
+	cfg.NumDrafts = 5
+	if n := draftsForDissonance(0.95, cfg); n != 5 {
+		t.Errorf("high dissonance: %d drafts, want 5", n)
+	}
+	if n := draftsForDissonance(0.05, cfg); n != 1 {
+		t.Errorf("near-zero dissonance: %d drafts, want 1", n)
+	}
+	prev := 0
+	for d := float32(-0.5); d <= 1.5; d += 0.05 {
+		n := draftsForDissonance(d, cfg)
+		if n < 1 || n > cfg.NumDrafts || n < prev {
+			t.Fatalf("d=%.2f: %d drafts (previous %d), want non-decreasing within [1, %d]", d, n, prev, cfg.NumDrafts)
+		}
+		prev = n
+	}
+
+	cfg.NumDrafts = 0
+	if n := draftsForDissonance(1, cfg); n != 1 {
+		t.Errorf("NumDrafts=0: %d drafts, want 1", n)
+	}
+}
+
+func TestSketchTransitionStopsWhenDone(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { sketchOut = w }(sketchOut)
+	sketchOut = &buf
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	start := time.Now()
+	go func() {
+		SketchTransition(TransitionConfig{Frames: 1000, Interval: 10 * time.Millisecond}, done)
+		close(finished)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	close(done)
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SketchTransition kept running after done was closed")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("transition took %v, want it cut short", elapsed)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "[yent] rendering"); n == 0 || n >= 1000 {
+		t.Errorf("showed %d frames, want some but not all", n)
+	}
+	if !strings.HasSuffix(out, "\r\033[2K") {
+		t.Errorf("transition should clear its line, output ends %q", out[max(0, len(out)-12):])
+	}
+}
+
+func TestSketchTransitionFrames(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { sketchOut = w }(sketchOut)
+	sketchOut = &buf
+
+	SketchTransition(TransitionConfig{Frames: 3, Interval: time.Millisecond}, nil)
+	if n := strings.Count(buf.String(), "[yent] rendering"); n != 3 {
+		t.Errorf("showed %d frames, want 3", n)
+	}
+
+	buf.Reset()
+	SketchTransition(TransitionConfig{}, nil) // nothing to wait for
+	if buf.Len() != 0 {
+		t.Errorf("no frames and no done channel should print nothing, got %q", buf.String())
+	}
+}
+
+func TestExplainPulse(t *testing.T) {
+	pg := newTestPG()
+	pg.computeDissonance("the sea at night")
+	cloud, boredom := len(pg.cloud), pg.boredomCount
+
+	pulse := pg.ExplainPulse("I HATE this!!! 😡")
+	if len(pg.cloud) != cloud || pg.boredomCount != boredom {
+		t.Fatal("ExplainPulse changed the generator's memory")
+	}
+	if _, f := pg.ExplainTemperature("I HATE this!!! 😡", 0.8); pulse.Arousal != f.Arousal {
+		t.Errorf("ExplainPulse arousal = %.3f, ExplainTemperature's = %.3f", pulse.Arousal, f.Arousal)
+	}
+	if pulse.Arousal <= pg.ExplainPulse("the sea at night").Arousal {
+		t.Error("an angry input should have more arousal than a calm one")
+	}
+}
+
+func TestRenderBrailleHalfAndHalf(t *testing.T) {
+	// Left half black, right half white
+	w, h := 16, 8
+	gray := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		for x := w / 2; x < w; x++ {
+			gray[y*w+x] = 1
+		}
+	}
+
+	lines := RenderBraille(gray, w, h, 0.5)
+	if len(lines) != 2 {
+		t.Fatalf("rows = %d, want 2", len(lines))
+	}
+	for i, line := range lines {
+		cells := []rune(line)
+		if len(cells) != 8 {
+			t.Fatalf("line %d has %d cells, want 8", i, len(cells))
+		}
+		for x, c := range cells {
+			want := rune(0x2800)
+			if x >= 4 {
+				want = 0x28FF
+			}
+			if c != want {
+				t.Errorf("cell (%d,%d) = %U, want %U", x, i, c, want)
+			}
+		}
+	}
+}
+
+func TestRenderBraillePadding(t *testing.T) {
+	// 5x6 is not a multiple of 2x4 → padded to 3 cols x 2 rows
+	gray := make([]float32, 5*6)
+	for i := range gray {
+		gray[i] = 1
+	}
+	lines := RenderBraille(gray, 5, 6, 0.5)
+	if len(lines) != 2 {
+		t.Fatalf("rows = %d, want 2", len(lines))
+	}
+	last := []rune(lines[1])
+	if len(last) != 3 {
+		t.Fatalf("cols = %d, want 3", len(last))
+	}
+	// Bottom-right cell: only the top-left 1x2 pixels exist
+	if last[2] != 0x2800|0x01|0x02 {
+		t.Errorf("padded cell = %U, want %U", last[2], rune(0x2803))
+	}
+}
+
+func TestRenderSketchFrameBraille(t *testing.T) {
+	cfg := DefaultSketchConfig()
+	cfg.Braille = true
+	rng := rand.New(rand.NewSource(42))
+
+	lines := RenderSketchFrame(cfg, 2, []string{"duck"}, rng)
+	if len(lines) != cfg.Height {
+		t.Fatalf("lines = %d, want %d", len(lines), cfg.Height)
+	}
+	for i, line := range lines {
+		cells := []rune(line)
+		if len(cells) != cfg.Width {
+			t.Errorf("line %d width = %d, want %d", i, len(cells), cfg.Width)
+		}
+		for _, c := range cells {
+			if c < 0x2800 || c > 0x28FF {
+				t.Fatalf("non-Braille glyph %q in line %d", c, i)
+			}
+		}
+	}
+}
+
+func TestSketchToImage(t *testing.T) {
+	cfg := DefaultSketchConfig()
+
+	countInk := func(draft int) int {
+		img := SketchToImage(cfg, draft, nil, rand.New(rand.NewSource(7)))
+		b := img.Bounds()
+		if b.Dx() != cfg.Width*sketchCharW || b.Dy() != cfg.Height*sketchCharH {
+			t.Fatalf("draft %d size = %dx%d, want %dx%d", draft, b.Dx(), b.Dy(),
+				cfg.Width*sketchCharW, cfg.Height*sketchCharH)
+		}
+		n := 0
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				if img.RGBAAt(x, y) != sketchBG {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	sparse := countInk(0)
+	dense := countInk(2)
+	if dense <= sparse {
+		t.Errorf("dense draft ink = %d, want > sparse draft ink %d", dense, sparse)
+	}
+}
+
 func TestDefaultSketchConfig(t *testing.T) {
 	cfg := DefaultSketchConfig()
 	if cfg.Width <= 0 || cfg.Height <= 0 {
@@ -327,6 +781,67 @@ func TestDefaultSketchConfig(t *testing.T) {
 
 // --- DualYent structure (without models) ---
 
+// stubRoaster can only return a finished roast
+type stubRoaster struct{ text string }
+
+func (r stubRoaster) RoastSession(string, []string, int, float32) string { return r.text }
+
+// stubStreamer yields its pieces as a live model would
+type stubStreamer struct {
+	stubRoaster
+	pieces []string
+}
+
+func (r stubStreamer) RoastSessionStream(string, []string, int, float32) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, p := range r.pieces {
+			ch <- p
+		}
+	}()
+	return ch
+}
+
+func drainRoast(t *testing.T, ch <-chan string) []string {
+	t.Helper()
+	var pieces []string
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case p, ok := <-ch:
+			if !ok {
+				return pieces
+			}
+			pieces = append(pieces, p)
+		case <-timeout:
+			t.Fatalf("channel not closed; got %q so far", pieces)
+		}
+	}
+}
+
+func TestStreamRoastLive(t *testing.T) {
+	r := stubStreamer{pieces: []string{"You", " call", " that", " art?"}}
+	pieces := drainRoast(t, streamRoast(r, "hi", nil, 50, 1))
+	if len(pieces) != 4 {
+		t.Errorf("got %d pieces, want 4 (one per token)", len(pieces))
+	}
+	if got := strings.Join(pieces, ""); got != "You call that art?" {
+		t.Errorf("joined = %q", got)
+	}
+}
+
+func TestStreamRoastFallback(t *testing.T) {
+	r := stubRoaster{text: "  nobody asked,  human  "}
+	pieces := drainRoast(t, streamRoast(r, "hi", nil, 50, 1))
+	if got := strings.Join(pieces, ""); got != "nobody asked, human" {
+		t.Errorf("joined = %q, want the full roast", got)
+	}
+	if len(pieces) != 3 {
+		t.Errorf("got %d pieces, want 3 words", len(pieces))
+	}
+}
+
 func TestDualResultFields(t *testing.T) {
 	r := DualResult{
 		Prompt:    "a mirror cracking under the weight of your words, oil painting",
@@ -362,6 +877,52 @@ func TestStyleSuffixesNotEmpty(t *testing.T) {
 	}
 }
 
+func TestSelectStyleSuffix(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	tests := []struct {
+		name  string
+		pulse PulseSnapshot
+		want  []string
+	}{
+		{"agitated", PulseSnapshot{Novelty: 1, Arousal: 0.9, Entropy: 1}, agitatedStyles},
+		{"chaotic", PulseSnapshot{Novelty: 0.9, Arousal: 0.3, Entropy: 0.9}, chaoticStyles},
+		{"calm", PulseSnapshot{Novelty: 0.2, Arousal: 0, Entropy: 0.5}, calmStyles},
+		{"neutral", PulseSnapshot{Novelty: 0.4, Arousal: 0.4, Entropy: 0.5}, neutralStyles},
+	}
+	for _, tt := range tests {
+		seen := make(map[string]bool)
+		for i := 0; i < 50; i++ {
+			got := selectStyleSuffix(tt.pulse, rng)
+			ok := false
+			for _, w := range tt.want {
+				if got == w {
+					ok = true
+				}
+			}
+			if !ok {
+				t.Fatalf("%s: got %q, not in %v", tt.name, got, tt.want)
+			}
+			seen[got] = true
+		}
+		if len(seen) != len(tt.want) {
+			t.Errorf("%s: picked %d of %d styles in the bucket", tt.name, len(seen), len(tt.want))
+		}
+	}
+
+	// Every bucketed style is one of the known suffixes
+	known := make(map[string]bool)
+	for _, s := range styleSuffixes {
+		known[s] = true
+	}
+	for _, b := range [][]string{agitatedStyles, chaoticStyles, calmStyles, neutralStyles} {
+		for _, s := range b {
+			if !known[s] {
+				t.Errorf("bucketed style %q missing from styleSuffixes", s)
+			}
+		}
+	}
+}
+
 func TestReactionTemplatesNotEmpty(t *testing.T) {
 	if len(reactionTemplates) == 0 {
 		t.Fatal("reactionTemplates is empty")
@@ -373,6 +934,242 @@ func TestReactionTemplatesNotEmpty(t *testing.T) {
 		if len(rt.starters) == 0 {
 			t.Errorf("reactionTemplates[%d] has no starters", i)
 		}
+		if len(rt.startersRU) == 0 {
+			t.Errorf("reactionTemplates[%d] has no Russian starters", i)
+		}
+	}
+}
+
+func TestPickTemplateByPulse(t *testing.T) {
+	words := inputWords("I hate my cat") // angry and cat templates both match
+	angry, cat := &reactionTemplates[1], &reactionTemplates[6]
+	for seed := int64(0); seed < 20; seed++ {
+		pg := &PromptGenerator{rng: rand.New(rand.NewSource(seed))}
+		if got := pg.pickTemplate(words, PulseSnapshot{Arousal: 0.95, Valence: -0.8}); got != angry {
+			t.Fatalf("seed %d: furious pulse picked %v, want the angry template", seed, got.keywords)
+		}
+		if got := pg.pickTemplate(words, PulseSnapshot{Arousal: 0.1, Valence: 0.2}); got != cat {
+			t.Fatalf("seed %d: calm pulse picked %v, want the cat template", seed, got.keywords)
+		}
+	}
+
+	// A single match is picked without touching the rng
+	pg := &PromptGenerator{rng: rand.New(rand.NewSource(1))}
+	if got := pg.pickTemplate(inputWords("a duck"), PulseSnapshot{Arousal: 1}); got != &reactionTemplates[5] {
+		t.Errorf("single match picked %v, want the duck template", got)
+	}
+	if pg.rng.Int63() != rand.New(rand.NewSource(1)).Int63() {
+		t.Error("a single match consumed randomness")
+	}
+	if got := pg.pickTemplate(inputWords("the weather is nice"), PulseSnapshot{}); got != nil {
+		t.Errorf("no keyword picked %v, want nil", got.keywords)
+	}
+}
+
+func TestTempSchedule(t *testing.T) {
+	const T, steps = 0.8, 30
+	near := func(a, b float32) bool { return math.Abs(float64(a-b)) < 1e-5 }
+
+	cosine := TempSchedule{Kind: TempCosine, Start: 1.5, End: 0.5}
+	if got := cosine.at(T, 0, steps); !near(got, 1.2) {
+		t.Errorf("cosine first step = %v, want %v", got, 1.5*T)
+	}
+	if got := cosine.at(T, steps-1, steps); !near(got, 0.4) {
+		t.Errorf("cosine last step = %v, want %v", got, 0.5*T)
+	}
+	if got := cosine.at(T, 1, steps); got >= 1.2 || got < 1.19 {
+		t.Errorf("cosine second step = %v, want just under the start (flat at the ends)", got)
+	}
+	for i := 1; i < steps; i++ {
+		if cosine.at(T, i, steps) > cosine.at(T, i-1, steps) {
+			t.Fatalf("cosine warms up at step %d", i)
+		}
+	}
+
+	linear := TempSchedule{Kind: TempLinear, Start: 0.5, End: 1.5}
+	if got := linear.at(T, 0, 3); !near(got, 0.4) {
+		t.Errorf("linear first step = %v, want 0.4", got)
+	}
+	if got := linear.at(T, 1, 3); !near(got, 0.8) {
+		t.Errorf("linear midpoint = %v, want 0.8", got)
+	}
+
+	for _, ts := range []TempSchedule{{}, {Start: 2, End: 0.1}, {Kind: TempCosine}} {
+		for i := 0; i < steps; i++ {
+			if got := ts.at(T, i, steps); got != T {
+				t.Fatalf("%+v at step %d = %v, want the constant %v", ts, i, got, T)
+			}
+		}
+	}
+	if got := cosine.at(T, 0, 1); !near(got, 1.2) {
+		t.Errorf("one-step cosine = %v, want the start", got)
+	}
+}
+
+func TestSamplerTopK1IsGreedy(t *testing.T) {
+	logits := []float32{0.3, 2.1, -1, 2.0, 0.9, 1.7}
+	var sp sampler
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 200; i++ {
+		if got := sp.sample(logits, 1.5, Sampling{TopK: 1}, rng); got != 1 {
+			t.Fatalf("draw %d with top_k=1 = token %d, want the argmax 1", i, got)
+		}
+	}
+	// Without truncation a hot draw does leave the argmax
+	seen := map[int]bool{}
+	for i := 0; i < 200; i++ {
+		seen[sp.sample(logits, 1.5, Sampling{}, rng)] = true
+	}
+	if len(seen) < 3 {
+		t.Errorf("default sampling only drew %v", seen)
+	}
+}
+
+func TestSamplerTopPStaysInNucleus(t *testing.T) {
+	// softmax ≈ [0.64 0.24 0.09 0.03]: the 0.8 nucleus is tokens 0 and 1
+	logits := []float32{3, 2, 1, 0}
+	var sp sampler
+	rng := rand.New(rand.NewSource(3))
+	counts := map[int]int{}
+	for i := 0; i < 2000; i++ {
+		counts[sp.sample(logits, 1, Sampling{TopP: 0.8}, rng)]++
+	}
+	if counts[2] != 0 || counts[3] != 0 {
+		t.Errorf("top_p=0.8 drew outside the nucleus: %v", counts)
+	}
+	if counts[0] == 0 || counts[1] == 0 {
+		t.Errorf("top_p=0.8 never drew one of the nucleus tokens: %v", counts)
+	}
+}
+
+func TestSurpriseScore(t *testing.T) {
+	input := "my cat knocked the glass off the table"
+	echo := surpriseScore(input, "My cat knocked the glass off the table, oil painting")
+	wild := surpriseScore(input, "a burning cathedral under a violet sky")
+	if echo > 0.5 {
+		t.Errorf("an echo of the input has surprise %.2f, want < 0.5", echo)
+	}
+	if wild != 1 {
+		t.Errorf("a prompt sharing no words has surprise %.2f, want 1", wild)
+	}
+	if got := surpriseScore(input, input); got != 0 {
+		t.Errorf("the input itself has surprise %.2f, want 0", got)
+	}
+}
+
+// longestRun is the longest stretch of one token repeated in toks
+func longestRun(toks []int) int {
+	best, run := 0, 0
+	for i, tok := range toks {
+		if i > 0 && tok == toks[i-1] {
+			run++
+		} else {
+			run = 1
+		}
+		best = max(best, run)
+	}
+	return best
+}
+
+func TestRepeatPenaltyBreaksLoops(t *testing.T) {
+	// A model stuck on token 0, with token 1 a distant second
+	logits := []float32{6, 3, 0, 0, -1, -2, 0, 0}
+	draw := func(s Sampling, temp float32) []int {
+		var sp sampler
+		rng := rand.New(rand.NewSource(5))
+		toks := make([]int, 100)
+		for i := range toks {
+			toks[i] = sp.sample(logits, temp, s, rng)
+		}
+		return toks
+	}
+
+	if run := longestRun(draw(Sampling{}, 0)); run != 100 {
+		t.Errorf("greedy without a penalty: longest run %d, want the whole 100", run)
+	}
+	if run := longestRun(draw(Sampling{RepeatPenalty: 2}, 0)); run > 2 {
+		t.Errorf("greedy with repeat_penalty=2: longest run %d, want <= 2", run)
+	}
+	if off, on := longestRun(draw(Sampling{}, 0.7)), longestRun(draw(Sampling{RepeatPenalty: 1.5}, 0.7)); on > 6 || on >= off {
+		t.Errorf("sampled at 0.7: longest run %d with repeat_penalty=1.5, %d without", on, off)
+	}
+	if logits[0] != 6 || logits[4] != -1 {
+		t.Errorf("sample modified the logits: %v", logits)
+	}
+
+	// forget starts the next text clean
+	var sp sampler
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 3; i++ {
+		sp.sample(logits, 0, Sampling{RepeatPenalty: 2}, rng)
+	}
+	sp.forget()
+	if got := sp.sample(logits, 0, Sampling{RepeatPenalty: 2}, rng); got != 0 {
+		t.Errorf("first greedy draw after forget = %d, want 0", got)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	for in, want := range map[string]string{
+		"нарисуй мне утку":    langRussian,
+		"утка в огне 🔥🔥":      langRussian,
+		"draw me a duck":      langEnglish,
+		"утка duck duck duck": langEnglish, // mixed: not sure, so English
+		"😡😡😡":                 langEnglish,
+		"":                    langEnglish,
+		"ПРИВЕТ, ok":          langRussian,
+	} {
+		if got := detectLanguage(in); got != want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPickStarterLanguage(t *testing.T) {
+	pg := &PromptGenerator{rng: rand.New(rand.NewSource(1)), cloud: map[string]float32{}}
+	for _, tc := range []struct {
+		input string
+		from  []string
+	}{
+		{"нарисуй мне утку", reactionTemplates[5].startersRU},
+		{"draw me a duck", reactionTemplates[5].starters},
+		{"какая сегодня погода", defaultStartersRU},
+		{"the weather is nice", defaultStarters},
+	} {
+		got := pg.pickStarter(tc.input, 0, PulseSnapshot{})
+		found := false
+		for _, s := range tc.from {
+			found = found || strings.HasPrefix(got, s)
+		}
+		if !found {
+			t.Errorf("pickStarter(%q) = %q, want it to start with one of %q", tc.input, got, tc.from)
+		}
+	}
+}
+
+func TestSalientWords(t *testing.T) {
+	pg := &PromptGenerator{cloud: map[string]float32{"weather": 5}}
+	// "weather" is longest but worn out in the cloud; stop words never count
+	if got := pg.salientWords("the weather is nice and sunny, that is all", 2); len(got) != 2 || got[0] != "sunny" || got[1] != "nice" {
+		t.Errorf("salientWords = %q, want [sunny nice]", got)
+	}
+	if got := pg.salientWords("it is so", 3); len(got) != 0 {
+		t.Errorf("salientWords of short words = %q, want none", got)
+	}
+}
+
+func TestUnmatchedInputReactsToItsWords(t *testing.T) {
+	pg := newParrotPG("zyx", 1)
+	prompt := pg.React("the weather is nice", 8, 0.8)
+	if !strings.Contains(prompt, "weather") && !strings.Contains(prompt, "nice") {
+		t.Errorf("prompt %q for an unmatched input mentions none of its words", prompt)
+	}
+	found := false
+	for _, s := range defaultStarters {
+		found = found || strings.HasPrefix(prompt, s)
+	}
+	if !found {
+		t.Errorf("prompt %q doesn't start from a default starter", prompt)
 	}
 }
 
@@ -480,6 +1277,45 @@ func TestTensorMinMax(t *testing.T) {
 	}
 }
 
+func TestTensorMinMaxEdgeCases(t *testing.T) {
+	empty := &Tensor{Shape: []int{0}}
+	if got := tensorMin(empty); got != 0 {
+		t.Errorf("tensorMin(empty) = %v, want 0", got)
+	}
+	if got := tensorMax(empty); got != 0 {
+		t.Errorf("tensorMax(empty) = %v, want 0", got)
+	}
+
+	nan := float32(math.NaN())
+	for _, data := range [][]float32{{nan, -1, 2}, {-1, nan, 2}, {-1, 2, nan}} {
+		tensor := &Tensor{Data: data, Shape: []int{3}}
+		if tensorMin(tensor) != -1 || tensorMax(tensor) != 2 {
+			t.Errorf("%v: min %v, max %v, want -1, 2 wherever the NaN sits", data, tensorMin(tensor), tensorMax(tensor))
+		}
+	}
+	allNaN := &Tensor{Data: []float32{nan, nan}, Shape: []int{2}}
+	if v := tensorMin(allNaN); !math.IsNaN(float64(v)) {
+		t.Errorf("tensorMin(all NaN) = %v, want NaN", v)
+	}
+}
+
+func TestTensorMeanStd(t *testing.T) {
+	tensor := &Tensor{
+		Data:  []float32{-1, 0, 1, 2, -3, 0.5},
+		Shape: []int{6},
+	}
+	if got := tensorMean(tensor); math.Abs(float64(got)+0.5/6) > 1e-6 {
+		t.Errorf("tensorMean = %v, want %v", got, -0.5/6)
+	}
+	// Population std: sqrt(15.2083/6)
+	if got := tensorStd(tensor); math.Abs(float64(got)-1.592081) > 1e-5 {
+		t.Errorf("tensorStd = %v, want 1.592081", got)
+	}
+	if got := tensorStd(&Tensor{Data: []float32{4, 4, 4}, Shape: []int{3}}); got != 0 {
+		t.Errorf("tensorStd of a constant = %v, want 0", got)
+	}
+}
+
 func TestRandomLatent(t *testing.T) {
 	latent := randomLatent(1, 4, 8, 8, 42)
 	if len(latent.Data) != 256 { // 1*4*8*8
@@ -554,7 +1390,7 @@ func BenchmarkSketchLine(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		generateSketchLine(50, i%3, 7, 15, words, rng)
+		generateSketchLine(50, i%3, 7, 15, nil, words, nil, rng)
 	}
 }
 
@@ -631,6 +1467,47 @@ func TestEntropyCalculation(t *testing.T) {
 	}
 }
 
+func TestCharEntropyPulse(t *testing.T) {
+	// A single word has no word-level diversity to speak of
+	pg := newTestPG()
+	_, flat := pg.computeDissonance("aaaaaa")
+	_, varied := newTestPG().computeDissonance("abcdef")
+	if flat.Entropy >= varied.Entropy {
+		t.Errorf("single-word entropy: aaaaaa %.3f, abcdef %.3f, want the first lower", flat.Entropy, varied.Entropy)
+	}
+
+	// Multi-word inputs blend in characters only when asked to
+	plain := newTestPG()
+	_, p1 := plain.computeDissonance("aa aa bb")
+	blend := newTestPG()
+	blend.CharEntropyWeight = 0.5
+	_, p2 := blend.computeDissonance("aa aa bb")
+	if want := 0.5*p1.Entropy + 0.5*textpulse.CharEntropy("aa aa bb"); math.Abs(float64(p2.Entropy-want)) > 1e-6 {
+		t.Errorf("blended entropy = %.3f, want %.3f", p2.Entropy, want)
+	}
+}
+
+func TestShoutingRaisesArousal(t *testing.T) {
+	_, loud := newTestPG().computeDissonance("STOP TALKING TO ME!!!")
+	_, calm := newTestPG().computeDissonance("stop talking to me")
+	if loud.Arousal <= calm.Arousal {
+		t.Errorf("arousal: shouted %.3f, plain %.3f, want the shouted one higher", loud.Arousal, calm.Arousal)
+	}
+	if loud.Arousal > 1 {
+		t.Errorf("arousal = %.3f, want capped at 1", loud.Arousal)
+	}
+
+	// Ordinary capitalization and a single ! are not shouting
+	if a := shoutArousal("I went to Paris in May!", 6); a != 0 {
+		t.Errorf("shoutArousal of a normal sentence = %.3f, want 0", a)
+	}
+	// The lexicon still drives it without any typography
+	_, lex := newTestPG().computeDissonance("i hate the rain")
+	if lex.Arousal <= 0 {
+		t.Errorf("lexicon arousal = %.3f, want > 0", lex.Arousal)
+	}
+}
+
 // --- SavePNG ---
 
 func TestSavePNG(t *testing.T) {
@@ -645,7 +1522,7 @@ func TestSavePNG(t *testing.T) {
 	}
 
 	path := "/tmp/test_yentyo_save.png"
-	err := savePNG(tensor, path)
+	err := savePNG(tensor, path, 0, nil)
 	if err != nil {
 		t.Fatalf("savePNG: %v", err)
 	}
@@ -0,0 +1,115 @@
+package main
+
+// reqlog.go — one JSON line per /react request
+//
+// The free-form "[server] ..." and "[dual] ..." lines stay for humans; each
+// carries req=<id> so it can be matched to the request's summary line, and
+// so does every line the diffusion pipeline prints for it (pipelineOut):
+//   {"request_id":"…","input_len":12,"dissonance":0.8,"artist_id":"B",
+//    "temp":1.1,"image_generated":true,"elapsed_ms":5231}
+// Clients may send their own X-Request-ID; otherwise one is generated. The
+// id is echoed back in the X-Request-ID response header.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestLog is the structured summary of one request
+type requestLog struct {
+	RequestID      string  `json:"request_id"`
+	InputLen       int     `json:"input_len"`
+	Dissonance     float64 `json:"dissonance"`
+	ArtistID       string  `json:"artist_id"`
+	Temp           float64 `json:"temp"`
+	ImageGenerated bool    `json:"image_generated"`
+	ImageError     string  `json:"image_error,omitempty"`
+	ElapsedMs      int64   `json:"elapsed_ms"`
+}
+
+// logRequest writes entry as a single JSON line to s.logOut (nil → stderr)
+func (s *Server) logRequest(entry requestLog) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	out := s.logOut
+	if out == nil {
+		out = os.Stderr
+	}
+	s.logMu.Lock()
+	out.Write(append(line, '\n'))
+	s.logMu.Unlock()
+}
+
+type requestIDKey struct{}
+
+// withRequestID tags r's context with the client's X-Request-ID (when it is
+// a sane token) or a fresh id, and echoes it in the response header
+func withRequestID(w http.ResponseWriter, r *http.Request) context.Context {
+	id := r.Header.Get(requestIDHeader)
+	if !validImageID(id) { // same shape: 1–64 letters, digits or '-'
+		id = newRequestID()
+	}
+	w.Header().Set(requestIDHeader, id)
+	return context.WithValue(r.Context(), requestIDKey{}, id)
+}
+
+// requestID returns the id withRequestID stored in ctx, or "-"
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// pipelineOut is where the diffusion pipelines print their progress:
+// stdout, with every line prefixed "req=<id> " when ctx carries a request
+// id, so a server's diffusion output can be traced to its request
+func pipelineOut(ctx context.Context) io.Writer {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	if !ok {
+		return os.Stdout
+	}
+	return &prefixWriter{w: os.Stdout, prefix: "req=" + id + " "}
+}
+
+// prefixWriter writes prefix at the start of every line. The pipelines
+// print a line in pieces ("Loading UNet... " then "done"), so it tracks
+// whether the last write ended one.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	midLine bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	buf := make([]byte, 0, len(b)+len(p.prefix))
+	for _, c := range b {
+		if !p.midLine {
+			buf = append(buf, p.prefix...)
+			p.midLine = true
+		}
+		buf = append(buf, c)
+		if c == '\n' {
+			p.midLine = false
+		}
+	}
+	if _, err := p.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
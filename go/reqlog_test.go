@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogJSON(t *testing.T) {
+	var logs bytes.Buffer
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = t.TempDir() // no tokenizer: text-only
+	srv.logOut = &logs
+
+	req := httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"paint me a duck"}`))
+	req.Header.Set(requestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	srv.handleReact(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(requestIDHeader); got != "abc-123" {
+		t.Errorf("%s = %q, want the client's id echoed", requestIDHeader, got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want 1: %q", len(lines), logs.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", lines[0], err)
+	}
+	for _, k := range []string{"request_id", "input_len", "dissonance", "artist_id", "temp", "image_generated", "elapsed_ms"} {
+		if _, ok := entry[k]; !ok {
+			t.Errorf("log line missing %q: %s", k, lines[0])
+		}
+	}
+	if entry["request_id"] != "abc-123" {
+		t.Errorf("request_id = %v, want abc-123", entry["request_id"])
+	}
+	if entry["input_len"] != float64(len("paint me a duck")) {
+		t.Errorf("input_len = %v, want %d", entry["input_len"], len("paint me a duck"))
+	}
+	if id := entry["artist_id"]; id != "A" && id != "B" {
+		t.Errorf("artist_id = %v, want A or B", id)
+	}
+	if d, _ := entry["dissonance"].(float64); d < 0 || d > 1 {
+		t.Errorf("dissonance = %v, want 0..1", entry["dissonance"])
+	}
+	if temp, _ := entry["temp"].(float64); temp <= 0 {
+		t.Errorf("temp = %v, want > 0", entry["temp"])
+	}
+	if entry["image_generated"] != false {
+		t.Errorf("image_generated = %v without an SD model", entry["image_generated"])
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	for _, sent := range []string{"", "../../etc", strings.Repeat("a", 65)} {
+		req := httptest.NewRequest("POST", "/react", nil)
+		if sent != "" {
+			req.Header.Set(requestIDHeader, sent)
+		}
+		w := httptest.NewRecorder()
+		ctx := withRequestID(w, req)
+
+		id := requestID(ctx)
+		if id == sent || len(id) != 16 || !validImageID(id) {
+			t.Errorf("sent %q: got id %q, want a fresh 16-char hex id", sent, id)
+		}
+		if got := w.Header().Get(requestIDHeader); got != id {
+			t.Errorf("sent %q: header %q, context %q", sent, got, id)
+		}
+	}
+	if id := requestID(httptest.NewRequest("GET", "/", nil).Context()); id != "-" {
+		t.Errorf("untagged context id = %q, want -", id)
+	}
+}
+
+func TestPipelineOutTagsLines(t *testing.T) {
+	if pipelineOut(context.Background()) != os.Stdout {
+		t.Error("CLI runs (no request id) should print to stdout as they are")
+	}
+	pw, ok := pipelineOut(context.WithValue(context.Background(), requestIDKey{}, "abc-123")).(*prefixWriter)
+	if !ok || pw.prefix != "req=abc-123 " {
+		t.Fatalf("pipelineOut = %#v, want lines tagged with the request id", pw)
+	}
+
+	// Lines printed in pieces get one prefix each
+	var buf bytes.Buffer
+	pw.w = &buf
+	fmt.Fprint(pw, "Loading UNet... ")
+	fmt.Fprintf(pw, "done (%v)\n", "1s")
+	fmt.Fprint(pw, "  Step 1/2\n  Step 2/2\n")
+	want := "req=abc-123 Loading UNet... done (1s)\nreq=abc-123   Step 1/2\nreq=abc-123   Step 2/2\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
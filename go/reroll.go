@@ -0,0 +1,161 @@
+package main
+
+// reroll.go — /react/reroll: same layout, fresh details
+//
+// A user who likes an image's composition but not its details can reroll
+// it: the stored image goes back through img2img at low strength with a
+// new seed, so the big shapes survive and the texture is redrawn. The
+// prompt comes from the image's own PNG metadata unless the request
+// overrides it (JPEG images carry none). Rerolls start from the diffusion
+// output, never from post-processed pixels: an image marked
+// metaPostProcessed is first redrawn from its stored seed, so the overlay
+// doesn't compound from reroll to reroll. Both go through s.diffusion().
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultRerollStrength keeps the composition and redraws the details
+const defaultRerollStrength = 0.3
+
+// RerollRequest is the JSON body for /react/reroll
+type RerollRequest struct {
+	ImageID  string  `json:"image_id"`
+	Strength float64 `json:"strength,omitempty"` // 0..1 (default 0.3); 1 is a full regenerate
+	Prompt   string  `json:"prompt,omitempty"`   // default: the prompt stored in the image
+}
+
+// handleReroll runs img2img from a stored image with a new seed and stores
+// the result as a new image. The response's Images entry carries the seed.
+func (s *Server) handleReroll(w http.ResponseWriter, r *http.Request) {
+	s.metrics.incRequests()
+	ctx := withRequestID(w, r)
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "POST only")
+		return
+	}
+	var req RerollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeBadJSON, "bad json: "+err.Error())
+		return
+	}
+	if !validImageID(req.ImageID) {
+		writeError(w, http.StatusBadRequest, errCodeInvalidRequest, "bad image id")
+		return
+	}
+	if req.Strength == 0 {
+		req.Strength = defaultRerollStrength
+	}
+	if req.Strength < 0 || req.Strength > 1 {
+		writeError(w, http.StatusBadRequest, errCodeInvalidRequest, "strength must be 0..1")
+		return
+	}
+	if s.textOnly {
+		writeError(w, http.StatusServiceUnavailable, errCodeImagesDisabled, "image generation is off (--text-only)")
+		return
+	}
+
+	data, ok := s.images.Get(req.ImageID)
+	if !ok {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "no such image")
+		return
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errCodeInternal, "stored image unreadable: "+err.Error())
+		return
+	}
+	meta, _ := parsePNGText(data)
+	prompt := req.Prompt
+	if prompt == "" {
+		prompt = meta["prompt"]
+	}
+	if prompt == "" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidRequest, "image has no stored prompt; pass one")
+		return
+	}
+	if _, ok := meta[metaPostProcessed]; ok && meta["seed"] == "" {
+		writeError(w, http.StatusBadRequest, errCodeInvalidRequest, "image is post-processed and has no stored seed to redraw it from")
+		return
+	}
+	if s.rejectWhileWarming(w) {
+		return
+	}
+
+	// Serialize generation with /react (one diffusion at a time)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := time.Now()
+	resp := ReactResponse{Prompt: prompt}
+	genCtx, cancel := s.generationContext(ctx)
+	defer cancel()
+	var imgData []byte
+	var seed int64
+	if init, err := s.rerollSource(genCtx, src, meta); err != nil {
+		fmt.Fprintf(os.Stderr, "[server] req=%s reroll source: %v\n", requestID(ctx), err)
+		s.metrics.incImageFailures()
+	} else {
+		imgData, seed = s.tryImg2Img(genCtx, prompt, init, float32(req.Strength))
+	}
+	resp.ImageError = generationError(ctx, genCtx)
+	if ctx.Err() != nil {
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	if imgData != nil {
+		if id, err := s.storeImage(imgData); err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s store image: %v\n", requestID(ctx), err)
+			s.metrics.incImageFailures()
+		} else {
+			resp.ImageURL = "/image/" + id
+			resp.ImageB64 = base64.StdEncoding.EncodeToString(imgData)
+			resp.Images = []ImageResult{{ID: id, Seed: seed, URL: resp.ImageURL}}
+			resp.ImageGenerated = true
+		}
+	}
+	resp.ElapsedMs = time.Since(start).Milliseconds()
+	s.logRequest(requestLog{
+		RequestID:      requestID(ctx),
+		ImageGenerated: resp.ImageGenerated,
+		ImageError:     resp.ImageError,
+		ElapsedMs:      resp.ElapsedMs,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rerollSource is the image a reroll starts from: the stored pixels, or,
+// when they were post-processed, the raw image redrawn by s.diffusion()
+// from the stored prompt, seed and steps
+func (s *Server) rerollSource(ctx context.Context, stored image.Image, meta map[string]string) (*image.RGBA, error) {
+	if _, ok := meta[metaPostProcessed]; !ok {
+		init := image.NewRGBA(stored.Bounds())
+		draw.Draw(init, init.Bounds(), stored, stored.Bounds().Min, draw.Src)
+		return init, nil
+	}
+	seed, err := strconv.ParseInt(meta["seed"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("stored seed: %w", err)
+	}
+	steps, err := strconv.Atoi(meta["steps"])
+	if err != nil || steps < 1 {
+		steps = 10
+	}
+	guidance := 7.5
+	if g, err := strconv.ParseFloat(meta["guidance"], 32); err == nil {
+		guidance = g
+	}
+	return s.diffusion().Generate(ctx, meta["prompt"], "", GenOpts{Seed: seed, Steps: steps, LatentSize: max(1, stored.Bounds().Dx()/8), Guidance: float32(guidance)})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stubImg2Img swaps runImg2Img for the real img2img schedule on stubVAE,
+// recording the prompts it was asked for
+func stubImg2Img(t *testing.T, prompts *[]string) {
+	orig := runImg2Img
+	t.Cleanup(func() { runImg2Img = orig })
+	runImg2Img = func(ctx context.Context, modelDir, prompt string, init *image.RGBA, strength float32, seed int64, steps int) (*image.RGBA, error) {
+		*prompts = append(*prompts, prompt)
+		calls := 0
+		out, err := img2img(ctx, stubVAE{}, stubPredictor(&calls), rgbaToTensor(init), strength, seed, steps, nil)
+		if err != nil {
+			return nil, err
+		}
+		return tensorToRGBA(out), nil
+	}
+}
+
+// meanPixelDiff is the mean absolute RGB difference of two images, 0..255
+func meanPixelDiff(a, b *image.RGBA) float64 {
+	var sum float64
+	var n int
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			sum += math.Abs(float64(a.Pix[i+c]) - float64(b.Pix[i+c]))
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+func reroll(t *testing.T, srv *Server, body string) (int, ReactResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.handleReroll(w, httptest.NewRequest("POST", "/react/reroll", strings.NewReader(body)))
+	var resp ReactResponse
+	if w.Code == 200 {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestReroll(t *testing.T) {
+	var prompts []string
+	stubImg2Img(t, &prompts)
+	srv := newTestServer()
+	srv.sdModelDir = t.TempDir()
+	writeFakeSDModel(srv.sdModelDir)
+	srv.rng = rand.New(rand.NewSource(1))
+
+	orig := makeTestImage(64, 64)
+	var buf bytes.Buffer
+	if err := encodePNG(&buf, orig, map[string]string{"prompt": "a duck on a roof"}); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := srv.storeImage(buf.Bytes())
+
+	decode := func(resp ReactResponse) *image.RGBA {
+		t.Helper()
+		if !resp.ImageGenerated || len(resp.Images) != 1 {
+			t.Fatalf("reroll response %+v has no image", resp)
+		}
+		data, _ := srv.images.Get(resp.Images[0].ID)
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img.(*image.RGBA)
+	}
+
+	code, light := reroll(t, srv, `{"image_id":"`+id+`","strength":0.2}`)
+	if code != 200 {
+		t.Fatalf("reroll status %d", code)
+	}
+	if light.Prompt != "a duck on a roof" || prompts[0] != "a duck on a roof" {
+		t.Errorf("reroll used prompt %q (response %q), want the stored one", prompts[0], light.Prompt)
+	}
+	_, full := reroll(t, srv, `{"image_id":"`+id+`","strength":1}`)
+	if light.Images[0].Seed == full.Images[0].Seed {
+		t.Error("two rerolls got the same seed")
+	}
+
+	near, far := meanPixelDiff(orig, decode(light)), meanPixelDiff(orig, decode(full))
+	if near >= far {
+		t.Errorf("strength 0.2 reroll differs by %.1f, a full regenerate by %.1f; want the reroll closer", near, far)
+	}
+}
+
+func TestRerollErrors(t *testing.T) {
+	srv := newTestServer()
+	var buf bytes.Buffer
+	encodePNG(&buf, makeTestImage(8, 8), nil)
+	bare, _ := srv.storeImage(buf.Bytes())
+
+	for _, tc := range []struct {
+		body string
+		want int
+		code string
+	}{
+		{`{"image_id":"nope-1"}`, 404, errCodeNotFound},
+		{`{"image_id":"../etc"}`, 400, errCodeInvalidRequest},
+		{`{"image_id":"` + bare + `","strength":1.5}`, 400, errCodeInvalidRequest},
+		{`{"image_id":"` + bare + `"}`, 400, errCodeInvalidRequest}, // no stored prompt, none given
+		{`{"image_id":`, 400, errCodeBadJSON},
+	} {
+		w := httptest.NewRecorder()
+		srv.handleReroll(w, httptest.NewRequest("POST", "/react/reroll", strings.NewReader(tc.body)))
+		if w.Code != tc.want || apiErrorCode(w) != tc.code {
+			t.Errorf("%s: status %d %s, want %d with code %s", tc.body, w.Code, w.Body, tc.want, tc.code)
+		}
+	}
+}
+
+func TestRerollStartsFromRawImage(t *testing.T) {
+	srv := newTestServer()
+	srv.sdModelDir = "/nonexistent/path"
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.backend = stubBackend{}
+
+	// What diffusion drew for seed 5, and the same with an overlay burned in
+	raw, err := stubBackend{}.Generate(context.Background(), "a duck", "", GenOpts{Seed: 5, Steps: 1, LatentSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlaid := image.NewRGBA(raw.Bounds())
+	copy(overlaid.Pix, raw.Pix)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			overlaid.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+		}
+	}
+	var buf bytes.Buffer
+	meta := postProcessedMeta(diffusionMeta("", "a duck", 5, 1, 7.5), "quack")
+	if err := encodePNG(&buf, overlaid, meta); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := srv.storeImage(buf.Bytes())
+
+	code, resp := reroll(t, srv, `{"image_id":"`+id+`","strength":0.2}`)
+	if code != 200 || !resp.ImageGenerated {
+		t.Fatalf("reroll through the stub backend: status %d, %+v", code, resp)
+	}
+	data, _ := srv.images.Get(resp.Images[0].ID)
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := src.(*image.RGBA)
+	if toRaw, toOverlay := meanPixelDiff(got, raw), meanPixelDiff(got, overlaid); toRaw >= toOverlay {
+		t.Errorf("reroll is %.1f from the raw image and %.1f from the overlaid one; it should start from the raw", toRaw, toOverlay)
+	}
+	if m, _ := parsePNGText(data); m[metaPostProcessed] != "" {
+		t.Error("the reroll carries the post-processed mark")
+	}
+}
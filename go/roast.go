@@ -0,0 +1,77 @@
+package main
+
+// roast.go — /roast: the commentator alone
+//
+// For chat integrations that want the mockery and nothing else. Only the
+// commentator runs; there is no visual prompt and no image, so /roast takes
+// the yents' lock but not the generation lock and answers while a /react
+// is still diffusing.
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// RoastResponse is the JSON response from /roast
+type RoastResponse struct {
+	Roast      string        `json:"roast"`
+	ArtistID   string        `json:"artist_id"` // the turn's artist; the other model roasted
+	Dissonance float64       `json:"dissonance"`
+	Pulse      PulseSnapshot `json:"pulse"`
+	ElapsedMs  int64         `json:"elapsed_ms"`
+}
+
+// handleRoast takes a ReactRequest body; the image, prompt and session
+// options don't apply. Dissonance and pulse are model A's view of the
+// input, measured without feeding its memory.
+func (s *Server) handleRoast(w http.ResponseWriter, r *http.Request) {
+	s.metrics.incRequests()
+	ctx := withRequestID(w, r)
+	req, ok := decodeReactRequest(w, r)
+	if !ok || s.rejectLongInput(w, req.Input) || s.rejectWhileWarming(w) {
+		return
+	}
+	if req.SessionID != "" {
+		// Sessions are only touched under s.mu
+		writeError(w, http.StatusBadRequest, errCodeSessionUnsupported, "session_id is not supported by /roast")
+		return
+	}
+	if !s.requireModels(w) {
+		return
+	}
+
+	opts := ReactOptions{RequestID: requestID(ctx), Artist: req.Artist, RoastMaxTokens: req.RoastMaxTokens, Sampling: req.sampling(), Seed: req.TextSeed}
+	if req.RoastTempOffset != nil {
+		offset := float32(*req.RoastTempOffset)
+		opts.RoastTempOffset = &offset
+	}
+
+	start := time.Now()
+	s.yentMu.Lock()
+	result := s.dy.Roast(req.Input, float32(req.Temperature), opts)
+	d, pulse, _ := s.dy.A.peekDissonance(req.Input)
+	s.yentMu.Unlock()
+	if r.Context().Err() != nil {
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	resp := RoastResponse{
+		Roast:      result.Roast,
+		ArtistID:   result.ArtistID,
+		Dissonance: float64(d),
+		Pulse:      pulse,
+		ElapsedMs:  time.Since(start).Milliseconds(),
+	}
+	s.logRequest(requestLog{
+		RequestID:  requestID(ctx),
+		InputLen:   len(req.Input),
+		Dissonance: resp.Dissonance,
+		ArtistID:   resp.ArtistID,
+		ElapsedMs:  resp.ElapsedMs,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoastEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+	diffusions := 0
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		diffusions++
+		return nil
+	}
+
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+
+	// A generation in flight holds s.mu; /roast must answer anyway
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		srv.handleRoast(w, httptest.NewRequest("POST", "/roast", strings.NewReader(`{"input":"I HATE YOUR PAINTINGS","artist":"A"}`)))
+		done <- w
+	}()
+	var w *httptest.ResponseRecorder
+	select {
+	case w = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("/roast waited on the generation lock")
+	}
+
+	var resp RoastResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+	// Model A drew, so B (the "qwv" parrot) roasted
+	if resp.Roast == "" || !strings.Contains(resp.Roast, "qwv") || resp.ArtistID != ArtistA {
+		t.Errorf("response = %+v, want B's roast with A as the artist", resp)
+	}
+	if resp.Pulse.Arousal <= 0 || resp.Dissonance < 0 || resp.Dissonance > 1 {
+		t.Errorf("pulse %+v, dissonance %.2f: want arousal for shouting and dissonance in [0, 1]", resp.Pulse, resp.Dissonance)
+	}
+	if diffusions != 0 || srv.images.Len() != 0 {
+		t.Errorf("/roast ran %d diffusions and stored %d images, want none", diffusions, srv.images.Len())
+	}
+	if len(srv.dy.A.recent) != 0 {
+		t.Error("/roast fed model A's dissonance memory")
+	}
+}
+
+func TestRoastRejectsSession(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	for body, code := range map[string]string{
+		`{"input":"hi","session_id":"s"}`: errCodeSessionUnsupported,
+		`{"input":""}`:                    errCodeInputRequired,
+		`{broken`:                         errCodeBadJSON,
+	} {
+		w := httptest.NewRecorder()
+		srv.handleRoast(w, httptest.NewRequest("POST", "/roast", strings.NewReader(body)))
+		if w.Code != 400 || apiErrorCode(w) != code {
+			t.Errorf("%s: status %d %s, want 400 with code %s", body, w.Code, w.Body, code)
+		}
+	}
+}
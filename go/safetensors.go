@@ -60,6 +60,27 @@ func OpenSafeTensors(path string) (*SafeTensors, error) {
 	return &SafeTensors{Meta: meta, Data: tensorData}, nil
 }
 
+// LoadSafetensors reads every tensor of a safetensors file into Tensors,
+// keyed by name; F16, BF16 and I64 are converted to float32
+func LoadSafetensors(path string) (map[string]*Tensor, error) {
+	st, err := OpenSafeTensors(path)
+	if err != nil {
+		return nil, err
+	}
+	tensors := make(map[string]*Tensor, len(st.Meta))
+	for name := range st.Meta {
+		data, shape, err := st.GetFloat32(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tensors[name] = TensorFrom(data, shape)
+	}
+	return tensors, nil
+}
+
+// dtypeSizes is the element size in bytes of each dtype GetFloat32 reads
+var dtypeSizes = map[string]int{"F32": 4, "F16": 2, "BF16": 2, "I64": 8}
+
 // GetFloat32 reads a tensor as float32 slice (converting from float16 if needed)
 func (st *SafeTensors) GetFloat32(name string) ([]float32, []int, error) {
 	info, ok := st.Meta[name]
@@ -67,12 +88,20 @@ func (st *SafeTensors) GetFloat32(name string) ([]float32, []int, error) {
 		return nil, nil, fmt.Errorf("tensor %q not found", name)
 	}
 
-	raw := st.Data[info.DataOffsets[0]:info.DataOffsets[1]]
-
+	size, ok := dtypeSizes[info.Dtype]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported dtype %q for tensor %q", info.Dtype, name)
+	}
 	numel := 1
 	for _, s := range info.Shape {
 		numel *= s
 	}
+	begin, end := info.DataOffsets[0], info.DataOffsets[1]
+	if begin < 0 || end < begin || end > len(st.Data) || end-begin != numel*size {
+		return nil, nil, fmt.Errorf("tensor %q: data offsets [%d, %d) don't fit %d %s values in %d bytes",
+			name, begin, end, numel, info.Dtype, len(st.Data))
+	}
+	raw := st.Data[begin:end]
 
 	result := make([]float32, numel)
 
@@ -85,6 +114,11 @@ func (st *SafeTensors) GetFloat32(name string) ([]float32, []int, error) {
 		for i := 0; i < numel; i++ {
 			result[i] = float16ToFloat32(binary.LittleEndian.Uint16(raw[i*2:]))
 		}
+	case "BF16":
+		// bfloat16 is the top half of a float32
+		for i := 0; i < numel; i++ {
+			result[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(raw[i*2:])) << 16)
+		}
 	case "I64":
 		// Used for position_ids — convert to float32
 		for i := 0; i < numel; i++ {
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSafetensors writes a safetensors file: an 8-byte header length, the
+// JSON header, then data
+func writeSafetensors(t *testing.T, header map[string]interface{}, data []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(len(h)))
+	buf = append(append(buf, h...), data...)
+	path := filepath.Join(t.TempDir(), "model.safetensors")
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSafetensors(t *testing.T) {
+	f32 := []float32{1.5, -2, 0.25, 1e-3, 42, -0.5}
+	var data []byte
+	for _, v := range f32 {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+	// F16: 1.0, -2.0, 0.5, 65504 (max half)
+	for _, h := range []uint16{0x3C00, 0xC000, 0x3800, 0x7BFF} {
+		data = binary.LittleEndian.AppendUint16(data, h)
+	}
+	// BF16: the top halves of 3.0 and -0.15625
+	bf16 := []float32{3, -0.15625}
+	for _, v := range bf16 {
+		data = binary.LittleEndian.AppendUint16(data, uint16(math.Float32bits(v)>>16))
+	}
+
+	path := writeSafetensors(t, map[string]interface{}{
+		"__metadata__": map[string]string{"format": "pt"},
+		"w.f32":        map[string]interface{}{"dtype": "F32", "shape": []int{2, 3}, "data_offsets": []int{0, 24}},
+		"w.f16":        map[string]interface{}{"dtype": "F16", "shape": []int{4}, "data_offsets": []int{24, 32}},
+		"w.bf16":       map[string]interface{}{"dtype": "BF16", "shape": []int{1, 2}, "data_offsets": []int{32, 36}},
+	}, data)
+
+	tensors, err := LoadSafetensors(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensors) != 3 {
+		t.Fatalf("loaded %d tensors, want 3 (metadata is not a tensor)", len(tensors))
+	}
+	for name, want := range map[string]struct {
+		shape []int
+		data  []float32
+	}{
+		"w.f32":  {[]int{2, 3}, f32},
+		"w.f16":  {[]int{4}, []float32{1, -2, 0.5, 65504}},
+		"w.bf16": {[]int{1, 2}, bf16},
+	} {
+		got := tensors[name]
+		if got == nil {
+			t.Errorf("%s missing", name)
+			continue
+		}
+		if len(got.Shape) != len(want.shape) || got.Numel() != len(want.data) {
+			t.Errorf("%s: shape %v, want %v", name, got.Shape, want.shape)
+			continue
+		}
+		for i, v := range want.data {
+			if got.Data[i] != v {
+				t.Errorf("%s[%d] = %v, want %v", name, i, got.Data[i], v)
+			}
+		}
+	}
+}
+
+func TestLoadSafetensorsBadOffsets(t *testing.T) {
+	for name, info := range map[string]map[string]interface{}{
+		"past the end": {"dtype": "F32", "shape": []int{4}, "data_offsets": []int{0, 16}},
+		"wrong size":   {"dtype": "F32", "shape": []int{3}, "data_offsets": []int{0, 8}},
+		"reversed":     {"dtype": "F32", "shape": []int{0}, "data_offsets": []int{8, 0}},
+		"bad dtype":    {"dtype": "Q4", "shape": []int{2}, "data_offsets": []int{0, 8}},
+	} {
+		path := writeSafetensors(t, map[string]interface{}{"w": info}, make([]byte, 8))
+		if _, err := LoadSafetensors(path); err == nil || !strings.Contains(err.Error(), `"w"`) {
+			t.Errorf("%s: err = %v, want an error naming the tensor", name, err)
+		}
+	}
+}
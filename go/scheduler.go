@@ -1,6 +1,9 @@
 package main
 
-import "math"
+import (
+	"math"
+	"sort"
+)
 
 // DDIMScheduler implements deterministic DDIM sampling (eta=0)
 // Compatible with BK-SDM-Tiny (trained with PNDM, inference works with any scheduler)
@@ -8,8 +11,22 @@ type DDIMScheduler struct {
 	alphasCumprod     []float64
 	numTrainTimesteps int
 	numInferenceSteps int
+	schedule          string // SigmaLinear or SigmaKarras
+	timesteps         []int  // from the last SetTimesteps
 }
 
+// Sigma schedules: how SetTimesteps spreads the inference steps
+const (
+	SigmaLinear = "linear" // evenly spaced timesteps
+	SigmaKarras = "karras" // Karras et al. (2022): dense at low noise, ρ = 7
+)
+
+// sigmaSchedule is the schedule new schedulers use (--sigma-schedule)
+var sigmaSchedule = SigmaLinear
+
+// karrasRho is the Karras schedule's ρ; the paper's 7 is what everyone uses
+const karrasRho = 7.0
+
 // NewDDIMScheduler creates scheduler with scaled_linear beta schedule
 // Matches config: beta_start=0.00085, beta_end=0.012, num_train_timesteps=1000
 func NewDDIMScheduler(numTrain int, betaStart, betaEnd float64) *DDIMScheduler {
@@ -33,30 +50,96 @@ func NewDDIMScheduler(numTrain int, betaStart, betaEnd float64) *DDIMScheduler {
 	return &DDIMScheduler{
 		alphasCumprod:     alphasCumprod,
 		numTrainTimesteps: numTrain,
+		schedule:          sigmaSchedule,
 	}
 }
 
-// SetTimesteps returns the DDIM timestep schedule for inference
-// With steps_offset=1: timesteps are [T-step+1, T-2*step+1, ..., 1]
+// SetTimesteps returns the DDIM timestep schedule for inference, strictly
+// decreasing. Linear, with steps_offset=1: [T-step+1, T-2*step+1, ..., 1].
+// Karras: the timesteps whose noise levels are nearest the Karras sigmas.
 func (s *DDIMScheduler) SetTimesteps(numSteps int) []int {
 	s.numInferenceSteps = numSteps
-	stepRatio := s.numTrainTimesteps / numSteps
+	var timesteps []int
+	if s.schedule == SigmaKarras {
+		timesteps = s.karrasTimesteps(numSteps)
+	} else {
+		stepRatio := s.numTrainTimesteps / numSteps
+		timesteps = make([]int, numSteps)
+		for i := 0; i < numSteps; i++ {
+			// Reversed: largest timestep first
+			timesteps[i] = (numSteps-1-i)*stepRatio + 1 // +1 for steps_offset=1
+		}
+	}
+	s.timesteps = timesteps
+	return timesteps
+}
+
+// sigma is the noise level at training timestep t: sqrt((1-ᾱ)/ᾱ)
+func (s *DDIMScheduler) sigma(t int) float64 {
+	a := s.alphasCumprod[t]
+	return math.Sqrt((1 - a) / a)
+}
+
+// karrasSigmas spaces n noise levels from sigmaMax down to sigmaMin evenly
+// in σ^(1/ρ), which bunches them up at the low-noise end where detail is
+// resolved
+func karrasSigmas(n int, sigmaMin, sigmaMax float64) []float64 {
+	sigmas := make([]float64, n)
+	lo, hi := math.Pow(sigmaMin, 1/karrasRho), math.Pow(sigmaMax, 1/karrasRho)
+	for i := range sigmas {
+		frac := 0.0
+		if n > 1 {
+			frac = float64(i) / float64(n-1)
+		}
+		sigmas[i] = math.Pow(hi+frac*(lo-hi), karrasRho)
+	}
+	return sigmas
+}
+
+// karrasTimesteps maps the Karras sigmas over the scheduler's own noise
+// range to their nearest training timesteps (in log σ). The final σ_min is
+// left off: Step's last update already lands on ᾱ_0. Where two sigmas land
+// on one timestep the later one steps down, keeping the schedule strictly
+// decreasing.
+func (s *DDIMScheduler) karrasTimesteps(numSteps int) []int {
+	last := s.numTrainTimesteps - 1
+	sigmas := karrasSigmas(numSteps+1, s.sigma(0), s.sigma(last))[:numSteps]
 	timesteps := make([]int, numSteps)
-	for i := 0; i < numSteps; i++ {
-		// Reversed: largest timestep first
-		timesteps[i] = (numSteps-1-i)*stepRatio + 1 // +1 for steps_offset=1
+	for i, sg := range sigmas {
+		// σ grows with t, so the first timestep at or above sg is one neighbour
+		t := sort.Search(last, func(t int) bool { return s.sigma(t) >= sg })
+		if t > 0 && math.Log(sg)-math.Log(s.sigma(t-1)) < math.Log(s.sigma(t))-math.Log(sg) {
+			t--
+		}
+		if i > 0 && t >= timesteps[i-1] {
+			t = timesteps[i-1] - 1
+		}
+		timesteps[i] = max(t, numSteps-1-i)
 	}
 	return timesteps
 }
 
+// prevTimestep is the timestep after t in the current schedule, or -1
+// once t is the last
+func (s *DDIMScheduler) prevTimestep(t int) int {
+	for i, ts := range s.timesteps {
+		if ts == t {
+			if i+1 < len(s.timesteps) {
+				return s.timesteps[i+1]
+			}
+			return -1
+		}
+	}
+	return t - s.numTrainTimesteps/s.numInferenceSteps
+}
+
 // Step performs one DDIM denoising step (eta=0 = deterministic, no added noise)
 //
 // DDIM update:
 //   pred_x0 = (sample - sqrt(1-alpha_t) * noise_pred) / sqrt(alpha_t)
 //   prev_sample = sqrt(alpha_prev) * pred_x0 + sqrt(1-alpha_prev) * noise_pred
 func (s *DDIMScheduler) Step(noisePred *Tensor, timestep int, sample *Tensor) *Tensor {
-	stepRatio := s.numTrainTimesteps / s.numInferenceSteps
-	prevTimestep := timestep - stepRatio
+	prevTimestep := s.prevTimestep(timestep)
 
 	// Current and previous alpha_cumprod
 	alphaT := s.alphasCumprod[timestep]
@@ -82,3 +165,16 @@ func (s *DDIMScheduler) Step(noisePred *Tensor, timestep int, sample *Tensor) *T
 	}
 	return out
 }
+
+// AddNoise forward-diffuses a clean sample to the given timestep (for img2img)
+//   noisy = sqrt(alpha_t) * original + sqrt(1-alpha_t) * noise
+func (s *DDIMScheduler) AddNoise(original, noise *Tensor, timestep int) *Tensor {
+	sqrtAlphaT := float32(math.Sqrt(s.alphasCumprod[timestep]))
+	sqrtOneMinusAlphaT := float32(math.Sqrt(1.0 - s.alphasCumprod[timestep]))
+
+	out := NewTensor(original.Shape...)
+	for i := range original.Data {
+		out.Data[i] = sqrtAlphaT*original.Data[i] + sqrtOneMinusAlphaT*noise.Data[i]
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKarrasSigmas(t *testing.T) {
+	sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+	sigmaMin, sigmaMax := sched.sigma(0), sched.sigma(999)
+	sigmas := karrasSigmas(10, sigmaMin, sigmaMax)
+	if math.Abs(sigmas[0]-sigmaMax) > 1e-9 || math.Abs(sigmas[9]-sigmaMin) > 1e-9 {
+		t.Errorf("karras sigmas run %v → %v, want %v → %v", sigmas[0], sigmas[9], sigmaMax, sigmaMin)
+	}
+	for i := 1; i < len(sigmas); i++ {
+		if sigmas[i] >= sigmas[i-1] {
+			t.Fatalf("karras sigmas not decreasing at %d: %v", i, sigmas)
+		}
+	}
+
+	linear := sched.SetTimesteps(10)
+	sched.schedule = SigmaKarras
+	karras := sched.SetTimesteps(10)
+	same := true
+	for i := range karras {
+		same = same && karras[i] == linear[i]
+	}
+	if same {
+		t.Errorf("karras timesteps %v are the linear ones", karras)
+	}
+}
+
+func TestSetTimestepsDecreasing(t *testing.T) {
+	for _, schedule := range []string{SigmaLinear, SigmaKarras} {
+		for _, n := range []int{1, 4, 10, 50, 200} {
+			sched := NewDDIMScheduler(1000, 0.00085, 0.012)
+			sched.schedule = schedule
+			ts := sched.SetTimesteps(n)
+			if len(ts) != n || ts[n-1] < 0 || ts[0] > 999 {
+				t.Errorf("%s/%d: timesteps %v out of range", schedule, n, ts)
+				continue
+			}
+			for i := 1; i < n; i++ {
+				if ts[i] >= ts[i-1] {
+					t.Errorf("%s/%d: timesteps not strictly decreasing at %d: %v", schedule, n, i, ts)
+					break
+				}
+			}
+			if got := sched.prevTimestep(ts[n-1]); got >= 0 {
+				t.Errorf("%s/%d: step after the last timestep is %d, want none", schedule, n, got)
+			}
+		}
+	}
+}
@@ -6,29 +6,102 @@ package main
 //   GET  /           — serves ui.html
 //   GET  /health     — model info
 //   POST /react      — user input → dual yent reaction + image generation
+//   POST /react/stream  — same body as /react, answered as SSE roast + progress + result
+//   POST /react/img2img — multipart (input, image, strength) → reaction + img2img
 //   GET  /image/:id  — serve generated images
+//   GET  /process/:id.gif — the sketch drafts and the finished image, animated
+//   GET  /metrics    — Prometheus text exposition
+//   POST /reset      — wipe both models' cloud, boredom and memory (admin)
+//   GET  /cloud      — top word-cloud weights as JSON (?limit=, default 50)
+//   GET  /sketch     — one ASCII sketch draft as PNG (?prompt=&draft=&seed=&input=)
+//   POST /analyze    — n-grams, pulse, arousal words and template matches for an input
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 )
 
 // Server holds the dual yent and SD model references
 type Server struct {
-	dy         *DualYent
+	dy         *DualYent // nil until loaded with --lazy; see models()
 	sdModelDir string
 	mu         sync.Mutex // serialize generation requests
+	yentMu     sync.Mutex // the yents are in use; taken inside mu, or alone by /roast
 	rng        *rand.Rand
-	images     map[string][]byte // id → PNG bytes (in-memory cache)
-	imagesMu   sync.RWMutex
+	images     ImageStore   // id → encoded image (memory, or disk with --image-dir)
+	imageSeq   atomic.Int64 // disambiguates ids stored within the same clock tick
+	metrics    serverMetrics
+	sessions   SessionStore     // conversation memory keyed by ReactRequest.SessionID
+	adminToken string           // required as a bearer token by /reset when set
+	genTimeout time.Duration    // per-request image generation budget; 0 → defaultGenerationTimeout
+	logOut     io.Writer        // structured request log (see reqlog.go); nil → stderr
+	postDebug  string           // --debug-postprocess: dump post-process stages of each image here
+	maxBatch   int              // most inputs one /react/batch may carry; 0 → defaultMaxBatch
+	maxInput   int              // longest accepted input in characters; 0 → defaultMaxInputChars
+	textOnly   bool             // --text-only: never run diffusion, SD model or not
+	backend    DiffusionBackend // --backend; nil → the SD pipeline on sdModelDir
+	warmingUp  atomic.Bool      // warm-up in progress: /react answers 503 (see warmup.go)
+	warmedUp   atomic.Bool
+	warmupMs   atomic.Int64
+	logMu      sync.Mutex
+
+	// --lazy (see lazy.go): loadModels builds dy on first use
+	loadModels   func() (*DualYent, error)
+	modelsOnce   sync.Once
+	modelsErr    error
+	modelsLoaded atomic.Bool // readable without s.mu, for /health and /cloud
+	modelsFailed atomic.Bool
+}
+
+// defaultGenerationTimeout bounds image generation for one request. On
+// expiry the reaction is still returned, text only.
+const defaultGenerationTimeout = 30 * time.Second
+
+// errGenerationTimedOut is ReactResponse.ImageError when the budget ran out
+const errGenerationTimedOut = "generation timed out"
+
+// serveOptions are the --serve flags beyond the model paths
+type serveOptions struct {
+	port           string
+	allowedOrigins []string
+	weights        DissonanceWeights
+	adminToken     string
+	seed           int64 // drives the dual yent and image seeds (replayable demos)
+	genTimeout     time.Duration
+	postDebug      string
+	imageDir       string                // --image-dir: keep images on disk instead of in memory
+	imageDirLevel  *png.CompressionLevel // --image-dir-compression; nil stores PNGs as served
+	maxBatch       int
+	maxInput       int
+	lazy           bool // --lazy: load the yents on the first request that needs them
+	textOnly       bool
+	backend        string // --backend: a diffusionBackends name; "" → defaultBackend
 }
 
 // ReactRequest is the JSON body for /react
@@ -36,97 +109,629 @@ type ReactRequest struct {
 	Input       string  `json:"input"`
 	Temperature float64 `json:"temperature,omitempty"`
 	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Count       int     `json:"count,omitempty"`   // image candidates, 1–8 (default 1)
+	Format      string  `json:"format,omitempty"`  // "png" (default) or "jpeg"
+	Quality     int     `json:"quality,omitempty"` // JPEG quality 1–100 (default 85)
+	SessionID   string  `json:"session_id,omitempty"`
+	Mode        string  `json:"mode,omitempty"`       // "parallel" (default) or "aware"
+	Candidates  int     `json:"candidates,omitempty"` // artist prompts to pick from, 1–5 (default 1)
+	Artist      string  `json:"artist,omitempty"`     // "A", "B" or "auto" (default: alternate)
+	TextOnly    bool    `json:"text_only,omitempty"`  // skip image generation for this request
+
+	RoastMaxTokens  int      `json:"roast_max_tokens,omitempty"`  // 1–maxRoastTokens (default 50)
+	RoastTempOffset *float64 `json:"roast_temp_offset,omitempty"` // added to temperature for the roast, -1..1 (default 0.2)
+
+	TopK          int     `json:"top_k,omitempty"`          // sample from the K likeliest tokens, 1–maxTopK (default: the model's own)
+	TopP          float64 `json:"top_p,omitempty"`          // nucleus sampling, 0..1 (default: the model's own)
+	RepeatPenalty float64 `json:"repeat_penalty,omitempty"` // downweight recently emitted tokens, 1–maxRepeatPenalty (default: the model's own)
+	TextSeed      int64   `json:"text_seed,omitempty"`      // replays the text: same input and seed, same prompt and roast, unless a session or unseeded traffic moved the memory on (default 0: unseeded); image seeds stay random
+}
+
+// maxTopK caps ReactRequest.TopK
+const maxTopK = 1000
+
+// maxRepeatPenalty caps ReactRequest.RepeatPenalty; past it the text is
+// mostly punctuation
+const maxRepeatPenalty = 3
+
+// sampling is the request's Sampling for ReactOptions, nil when it leaves
+// the models' own. Fields the request leaves out are 0 and keep the
+// models' values.
+func (req ReactRequest) sampling() *Sampling {
+	if req.TopK == 0 && req.TopP == 0 && req.RepeatPenalty == 0 {
+		return nil
+	}
+	return &Sampling{TopK: req.TopK, TopP: float32(req.TopP), RepeatPenalty: float32(req.RepeatPenalty)}
+}
+
+// maxRoastTokens caps ReactRequest.RoastMaxTokens
+const maxRoastTokens = 200
+
+// maxCandidates caps ReactRequest.Candidates (each one is a full artist pass)
+const maxCandidates = 5
+
+// Reaction modes accepted in ReactRequest.Mode
+const (
+	modeParallel = "parallel" // artist and commentator at once, roast ignores the art
+	modeAware    = "aware"    // artist first, commentator mocks the finished prompt
+)
+
+// statusClientClosedRequest is nginx's non-standard 499: the client went
+// away before the response was ready.
+const statusClientClosedRequest = 499
+
+// Output formats accepted in ReactRequest.Format
+const (
+	formatPNG  = "png"
+	formatJPEG = "jpeg"
+)
+
+// defaultJPEGQuality is used when ReactRequest.Quality is unset
+const defaultJPEGQuality = 85
+
+// defaultMaxInputChars caps ReactRequest.Input unless --max-input says otherwise
+const defaultMaxInputChars = 2000
+
+// maxPromptBytes is how much of the artist's prompt reaches the diffusion
+// text encoder
+const maxPromptBytes = 200
+
+// maxImageCount caps ReactRequest.Count
+const maxImageCount = 8
+
+// ImageResult is one generated candidate
+type ImageResult struct {
+	ID   string `json:"id"`
+	Seed int64  `json:"seed"`
+	URL  string `json:"url"`
 }
 
 // ReactResponse is the JSON response from /react
 type ReactResponse struct {
-	Prompt     string  `json:"prompt"`
-	YentWords  string  `json:"yent_words"`
-	Roast      string  `json:"roast"`
-	ArtistID   string  `json:"artist_id"`
-	ImageURL   string  `json:"image_url,omitempty"`
-	ImageB64   string  `json:"image_b64,omitempty"`
-	Dissonance float64 `json:"dissonance"`
-	Temp       float64 `json:"temperature"`
-	ElapsedMs  int64   `json:"elapsed_ms"`
-}
-
-// HealthResponse is the JSON response from /health
+	Prompt         string        `json:"prompt"`
+	YentWords      string        `json:"yent_words"`
+	Roast          string        `json:"roast"`
+	ArtistID       string        `json:"artist_id"`
+	ImageURL       string        `json:"image_url,omitempty"`
+	ImageB64       string        `json:"image_b64,omitempty"`
+	Images         []ImageResult `json:"images,omitempty"`
+	ImageError     string        `json:"image_error,omitempty"`
+	ImageGenerated bool          `json:"image_generated"`
+	Error          string        `json:"error,omitempty"` // /react/batch: this input failed, nothing else is set
+	Dissonance     float64       `json:"dissonance"`
+	Surprise       float64       `json:"surprise"`        // how far the prompt strays from the input, 0..1 (surpriseScore)
+	Theme          *Theme        `json:"theme,omitempty"` // colors for the input's mood
+	Temp           float64       `json:"temperature"`
+	ElapsedMs      int64         `json:"elapsed_ms"`
+}
+
+// CloudTerm is one entry of the /cloud response
+type CloudTerm struct {
+	Term   string  `json:"term"`
+	Weight float32 `json:"weight"`
+}
+
+// ModelStats is one model's accumulated state, as reported by /reset
+type ModelStats struct {
+	Boredom   int `json:"boredom"`
+	CloudSize int `json:"cloud_size"`
+}
+
+// ResetResponse is the pre-reset state returned by /reset
+type ResetResponse struct {
+	ModelA   ModelStats `json:"model_a"`
+	ModelB   ModelStats `json:"model_b"`
+	Sessions int        `json:"sessions"`
+}
+
+// TemperatureResponse is the JSON response from /temperature
+type TemperatureResponse struct {
+	Temperature float32            `json:"temperature"`
+	Factors     TemperatureFactors `json:"factors"`
+	Config      TemperatureConfig  `json:"config"`
+}
+
+// defaultCloudLimit is how many terms /cloud returns without ?limit=
+const defaultCloudLimit = 50
+
+// HealthResponse is the JSON response from /health. Ready needs both yents
+// and the SD model; with only the yents the server still answers /react,
+// text-only (ImageGeneration false). With --text-only the SD model is not
+// needed at all and Ready only asks for the yents. Under --lazy the yents
+// count as ready before they are loaded, as long as loading hasn't failed.
 type HealthResponse struct {
-	Version string `json:"version"`
-	ModelA  string `json:"model_a"`
-	ModelB  string `json:"model_b"`
-	SDModel string `json:"sd_model"`
-	Ready   bool   `json:"ready"`
+	Version         string `json:"version"`
+	ModelA          string `json:"model_a"`
+	ModelB          string `json:"model_b"`
+	ModelAVocab     int    `json:"model_a_vocab"`
+	ModelBVocab     int    `json:"model_b_vocab"`
+	ContextLength   int    `json:"context_length"` // tokens; the shorter of the two models' windows
+	SDModel         string `json:"sd_model"`
+	Ready           bool   `json:"ready"`
+	YentsReady      bool   `json:"yents_ready"`
+	SDReady         bool   `json:"sd_ready"`
+	ImageGeneration bool   `json:"image_generation"`
+	WarmedUp        bool   `json:"warmed_up"`
+	WarmupMs        int64  `json:"warmup_ms"`
+	ModelsLoaded    bool   `json:"models_loaded"` // false under --lazy until the first reaction
+	TextOnly        bool   `json:"text_only"`
+	Threads         int    `json:"threads"` // GOMAXPROCS, capped by --threads
+	Backend         string `json:"backend"` // diffusion backend: "purego", "ort" or "stub"
 }
 
-func startServer(sdModelDir, microPath, nanoPath, port string) {
-	fmt.Fprintf(os.Stderr, "[server] loading dual yent...\n")
+func startServer(sdModelDir, microPath, nanoPath string, opts serveOptions) {
+	load := func() (*DualYent, error) {
+		dy, err := NewDualYentSeeded(microPath, nanoPath, opts.seed)
+		if err != nil {
+			return nil, err
+		}
+		dy.SetWeights(opts.weights)
+		return dy, nil
+	}
+	var dy *DualYent
+	if !opts.lazy {
+		fmt.Fprintf(os.Stderr, "[server] loading dual yent...\n")
+		var err error
+		if dy, err = load(); err != nil {
+			fatal("dual yent: %v", err)
+		}
+	}
 
-	dy, err := NewDualYent(microPath, nanoPath)
-	if err != nil {
-		fatal("dual yent: %v", err)
+	var images ImageStore = NewMemoryImageStore()
+	if opts.imageDir != "" {
+		disk, err := NewDiskImageStore(opts.imageDir)
+		if err != nil {
+			fatal("%v", err)
+		}
+		disk.compression = opts.imageDirLevel
+		images = disk
+		fmt.Fprintf(os.Stderr, "[server] keeping images in %s\n", opts.imageDir)
 	}
 
 	srv := &Server{
 		dy:         dy,
 		sdModelDir: sdModelDir,
-		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
-		images:     make(map[string][]byte),
+		rng:        rand.New(rand.NewSource(opts.seed)),
+		images:     images,
+		adminToken: opts.adminToken,
+		genTimeout: opts.genTimeout,
+		postDebug:  opts.postDebug,
+		maxBatch:   opts.maxBatch,
+		maxInput:   opts.maxInput,
+		textOnly:   opts.textOnly,
+	}
+	if opts.backend != "" {
+		srv.backend = diffusionBackends[opts.backend](sdModelDir)
+	}
+	if opts.lazy {
+		srv.loadModels = load
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", srv.handleUI)
-	mux.HandleFunc("/health", srv.handleHealth)
-	mux.HandleFunc("/react", srv.handleReact)
-	mux.HandleFunc("/image/", srv.handleImage)
-
-	addr := ":" + port
+	addr := ":" + opts.port
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fatal("server: %v", err)
+	}
 	fmt.Fprintf(os.Stderr, "[server] listening on http://localhost%s\n", addr)
 	fmt.Fprintf(os.Stderr, "[server] SD model: %s\n", sdModelDir)
-	fmt.Fprintf(os.Stderr, "[server] ready.\n")
+	if opts.lazy {
+		// Warming up would load the models; the first reaction pays instead
+		fmt.Fprintf(os.Stderr, "[server] ready (lazy: models load on first use)\n")
+	} else {
+		fmt.Fprintf(os.Stderr, "[server] ready, warming up...\n")
+		srv.warmingUp.Store(true)
+		go srv.warmUp()
+	}
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := runServer(ctx, ln, withCORS(withGzip(srv.routes()), opts.allowedOrigins), srv.Close); err != nil {
 		fatal("server: %v", err)
 	}
+	fmt.Fprintf(os.Stderr, "[server] stopped.\n")
+}
+
+// Close frees the models and drops the images held in memory, after any
+// generation in flight has finished. The server must not be used after.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dy := s.loadedModels(); dy != nil {
+		dy.Free()
+	}
+	s.images.Clear()
+}
+
+// shutdownTimeout bounds how long in-flight requests get to finish
+const shutdownTimeout = 2 * time.Minute
+
+// routes registers every endpoint on a fresh mux
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleUI)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/version", s.handleVersion)
+	mux.HandleFunc("/react", s.handleReact)
+	mux.HandleFunc("/react/stream", s.handleReactStream)
+	mux.HandleFunc("/react/img2img", s.handleImg2Img)
+	mux.HandleFunc("/react/batch", s.handleReactBatch)
+	mux.HandleFunc("/react/reroll", s.handleReroll)
+	mux.HandleFunc("/roast", s.handleRoast)
+	mux.HandleFunc("/analyze", s.handleAnalyze)
+	mux.HandleFunc("/image/", s.handleImage)
+	mux.HandleFunc("/process/", s.handleProcessGIF)
+	mux.HandleFunc("/sketch", s.handleSketch)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/cloud", s.handleCloud)
+	mux.HandleFunc("/temperature", s.handleTemperature)
+	mux.HandleFunc("/reset", s.handleReset)
+	mux.HandleFunc("/session/", s.handleSessionHistory)
+	return mux
+}
+
+// withCORS answers preflight OPTIONS with 204 and stamps the
+// Access-Control-* headers on every response whose Origin is allowed.
+// "*" in origins allows any origin.
+func withCORS(next http.Handler, origins []string) http.Handler {
+	anyOrigin := false
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		allowed[o] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && (anyOrigin || allowed[origin]) {
+			h := w.Header()
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Add("Vary", "Origin")
+			}
+			h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+requestIDHeader)
+			h.Set("Access-Control-Expose-Headers", requestIDHeader)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runServer serves handler on ln until ctx is done, then stops accepting,
+// drains in-flight requests and calls release (model cleanup).
+func runServer(ctx context.Context, ln net.Listener, handler http.Handler, release func()) error {
+	httpSrv := &http.Server{Handler: handler}
+
+	errc := make(chan error, 1)
+	go func() { errc <- httpSrv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		release()
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintf(os.Stderr, "[server] shutting down, draining requests...\n")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := httpSrv.Shutdown(shutdownCtx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[server] drain incomplete: %v\n", err)
+		httpSrv.Close()
+	}
+	<-errc // Serve returns ErrServerClosed once Shutdown starts
+	release()
+	return nil
 }
 
 func (s *Server) handleUI(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		name = "ui.html"
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	if !serveUIAsset(w, r, name) {
 		http.NotFound(w, r)
-		return
 	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(uiHTML))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	resp := HealthResponse{
 		Version: yentYoVersion,
-		ModelA:  fmt.Sprintf("%d layers, %d dim", s.dy.A.model.Config.NumLayers, s.dy.A.model.Config.EmbedDim),
-		ModelB:  fmt.Sprintf("%d layers, %d dim", s.dy.B.model.Config.NumLayers, s.dy.B.model.Config.EmbedDim),
 		SDModel: s.sdModelDir,
-		Ready:   true,
+		SDReady: sdModelReady(s.sdModelDir),
+	}
+	if dy := s.loadedModels(); dy != nil && dy.A != nil && dy.A.model != nil && dy.B != nil && dy.B.model != nil {
+		resp.ModelA = fmt.Sprintf("%d layers, %d dim", dy.A.model.Config.NumLayers, dy.A.model.Config.EmbedDim)
+		resp.ModelB = fmt.Sprintf("%d layers, %d dim", dy.B.model.Config.NumLayers, dy.B.model.Config.EmbedDim)
+		resp.ModelAVocab = dy.A.model.Config.VocabSize
+		resp.ModelBVocab = dy.B.model.Config.VocabSize
+		resp.ContextLength = min(dy.A.model.Config.SeqLen, dy.B.model.Config.SeqLen)
+		resp.YentsReady = true
+	}
+	resp.ModelsLoaded = s.loadedModels() != nil
+	if s.loadModels != nil && !resp.ModelsLoaded {
+		// Lazy: ready to load on the first reaction, unless that already failed
+		resp.YentsReady = !s.modelsFailed.Load()
 	}
+	resp.TextOnly = s.textOnly
+	backend := s.diffusion()
+	resp.Backend = backend.Name()
+	resp.ImageGeneration = backend.Ready() && !s.textOnly
+	resp.Ready = resp.YentsReady && (backend.Ready() || s.textOnly)
+	resp.WarmedUp = s.warmedUp.Load()
+	resp.WarmupMs = s.warmupMs.Load()
+	resp.Threads = runtime.GOMAXPROCS(0)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// VersionResponse is the JSON response from /version
+type VersionResponse struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildVersion())
+}
+
+// buildVersion reports yentYoVersion plus the -ldflags build stamps,
+// falling back to the toolchain's VCS stamps when those weren't set
+func buildVersion() VersionResponse {
+	v := VersionResponse{
+		Version:   yentYoVersion,
+		GitCommit: gitCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, kv := range info.Settings {
+			switch {
+			case kv.Key == "vcs.revision" && v.GitCommit == "":
+				v.GitCommit = kv.Value
+			case kv.Key == "vcs.time" && v.BuildTime == "":
+				v.BuildTime = kv.Value
+			}
+		}
+	}
+	return v
+}
+
+// sdModelFiles are what the pure-Go pipeline loads from the SD model dir
+var sdModelFiles = []string{
+	"tokenizer/vocab.json",
+	"text_encoder/model.fp16.safetensors",
+	"unet/diffusion_pytorch_model.fp16.safetensors",
+	"vae/diffusion_pytorch_model.fp16.safetensors",
+}
+
+// sdModelReady reports whether dir holds a usable SD model: the tokenizer
+// plus either the safetensors weights or an ONNX export (ort builds)
+func sdModelReady(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(dir, rel))
+		return err == nil
+	}
+	if !exists(sdModelFiles[0]) {
+		return false
+	}
+	if exists("onnx_int8/unet.onnx") || exists("onnx_fp16/unet.onnx") {
+		return true
+	}
+	for _, f := range sdModelFiles[1:] {
+		if !exists(f) {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *Server) handleReact(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+	s.metrics.incRequests()
+	ctx := withRequestID(w, r)
+	req, ok := decodeReactRequest(w, r)
+	if !ok || s.rejectLongInput(w, req.Input) || s.rejectWhileWarming(w) {
+		return
+	}
+
+	// Serialize generation (each model is single-threaded; see DualYent)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireModels(w) {
+		return
+	}
+
+	resp := s.react(ctx, req, nil, nil)
+	if r.Context().Err() != nil {
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleReactStream is /react over Server-Sent Events: "roast" events as the
+// commentator speaks, one "progress" event per diffusion step, then a
+// "result" event carrying the ReactResponse.
+func (s *Server) handleReactStream(w http.ResponseWriter, r *http.Request) {
+	s.metrics.incRequests()
+	ctx := withRequestID(w, r)
+	req, ok := decodeReactRequest(w, r)
+	if !ok || s.rejectLongInput(w, req.Input) || s.rejectWhileWarming(w) {
 		return
 	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireModels(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	resp := s.react(ctx, req, func(step, total int) {
+		writeSSE(w, "progress", ProgressEvent{Step: step, Total: total})
+		flusher.Flush()
+	}, func(piece string) {
+		writeSSE(w, "roast", RoastEvent{Text: piece})
+		flusher.Flush()
+	})
+	if r.Context().Err() != nil {
+		return
+	}
+	writeSSE(w, "result", resp)
+	flusher.Flush()
+}
+
+// ProgressEvent is the data of an SSE "progress" event
+type ProgressEvent struct {
+	Step  int `json:"step"`
+	Total int `json:"total"`
+}
+
+// RoastEvent is the data of an SSE "roast" event: the next piece of the
+// commentator's line
+type RoastEvent struct {
+	Text string `json:"text"`
+}
 
+// writeSSE writes one Server-Sent Event with a JSON data line
+func writeSSE(w io.Writer, event string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+// APIError is what a failed /react (and the endpoints sharing its
+// request handling) answers with, as {"error": {"code", "message"}}.
+// Code is one of the err* codes below and stays put; Message is for humans.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError codes
+const (
+	errCodeMethodNotAllowed   = "method_not_allowed"
+	errCodeBadJSON            = "bad_json"
+	errCodeInputRequired      = "input_required"
+	errCodeInvalidRequest     = "invalid_request"
+	errCodeInputTooLong       = "input_too_long"
+	errCodeWarmingUp          = "warming_up"
+	errCodeModelsUnavailable  = "models_unavailable"
+	errCodeSessionUnsupported = "session_unsupported"
+	errCodeBatchSize          = "batch_size"
+	errCodeBadForm            = "bad_form"
+	errCodeImageRequired      = "image_required"
+	errCodeBadImage           = "bad_image"
+	errCodeNotFound           = "not_found"
+	errCodeImagesDisabled     = "images_disabled"
+	errCodeInternal           = "internal"
+)
+
+// writeError answers status with an APIError body
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error APIError `json:"error"`
+	}{APIError{Code: code, Message: message}})
+}
+
+// decodeReactRequest parses and validates a /react body, filling defaults.
+// On failure it writes the error response and returns false.
+func decodeReactRequest(w http.ResponseWriter, r *http.Request) (ReactRequest, bool) {
 	var req ReactRequest
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "POST only")
+		return req, false
+	}
+
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
-		return
+		writeError(w, http.StatusBadRequest, errCodeBadJSON, "bad json: "+err.Error())
+		return req, false
+	}
+
+	if err := normalizeReactRequest(&req); err != nil {
+		code := errCodeInvalidRequest
+		if errors.Is(err, errInputRequired) {
+			code = errCodeInputRequired
+		}
+		writeError(w, http.StatusBadRequest, code, err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+// inputTooLong reports whether input exceeds the server's character limit
+func (s *Server) inputTooLong(input string) bool {
+	limit := s.maxInput
+	if limit <= 0 {
+		limit = defaultMaxInputChars
+	}
+	return utf8.RuneCountInString(input) > limit
+}
+
+// rejectLongInput answers 413 when input is over the limit. Reports
+// whether it did.
+func (s *Server) rejectLongInput(w http.ResponseWriter, input string) bool {
+	if !s.inputTooLong(input) {
+		return false
 	}
+	writeError(w, http.StatusRequestEntityTooLarge, errCodeInputTooLong, errInputTooLong)
+	return true
+}
+
+// errInputTooLong is the 413 body, and ReactResponse.Error in a batch
+const errInputTooLong = "input too long"
 
+// truncatePrompt shortens p to at most max bytes, at the last word
+// boundary if there is one and never inside a UTF-8 sequence
+func truncatePrompt(p string, max int) string {
+	if len(p) <= max {
+		return p
+	}
+	if i := strings.LastIndexByte(p[:max+1], ' '); i > 0 {
+		return strings.TrimSpace(p[:i])
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(p[cut]) {
+		cut--
+	}
+	return p[:cut]
+}
+
+// errInputRequired is normalizeReactRequest's error for an empty input
+var errInputRequired = errors.New("input required")
+
+// normalizeReactRequest validates req and fills its defaults
+func normalizeReactRequest(req *ReactRequest) error {
 	if req.Input == "" {
-		http.Error(w, "input required", http.StatusBadRequest)
-		return
+		return errInputRequired
 	}
 	if req.MaxTokens <= 0 {
 		req.MaxTokens = 30
@@ -134,19 +739,118 @@ func (s *Server) handleReact(w http.ResponseWriter, r *http.Request) {
 	if req.Temperature <= 0 {
 		req.Temperature = 0.8
 	}
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	if req.Count < 0 || req.Count > maxImageCount {
+		return fmt.Errorf("count must be 1..%d", maxImageCount)
+	}
+	switch req.Format {
+	case "", formatPNG:
+		req.Format = formatPNG
+	case formatJPEG, "jpg":
+		req.Format = formatJPEG
+	default:
+		// No pure-Go WebP encoder exists; png and jpeg only for now
+		return errors.New("format must be png or jpeg")
+	}
+	if req.Quality == 0 {
+		req.Quality = defaultJPEGQuality
+	}
+	if req.Quality < 1 || req.Quality > 100 {
+		return errors.New("quality must be 1..100")
+	}
+	if req.Candidates == 0 {
+		req.Candidates = 1
+	}
+	if req.Candidates < 0 || req.Candidates > maxCandidates {
+		return fmt.Errorf("candidates must be 1..%d", maxCandidates)
+	}
+	switch req.Mode {
+	case "":
+		req.Mode = modeParallel
+	case modeParallel, modeAware:
+	default:
+		return errors.New("mode must be parallel or aware")
+	}
+	switch strings.ToUpper(req.Artist) {
+	case "", strings.ToUpper(ArtistAuto):
+		req.Artist = ArtistAuto
+	case ArtistA, ArtistB:
+		req.Artist = strings.ToUpper(req.Artist)
+	default:
+		return errors.New("artist must be A, B or auto")
+	}
+	if req.RoastMaxTokens < 0 || req.RoastMaxTokens > maxRoastTokens {
+		return fmt.Errorf("roast_max_tokens must be 1..%d", maxRoastTokens)
+	}
+	if o := req.RoastTempOffset; o != nil && (*o < -1 || *o > 1) {
+		return errors.New("roast_temp_offset must be -1..1")
+	}
+	if req.TopK < 0 || req.TopK > maxTopK {
+		return fmt.Errorf("top_k must be 1..%d", maxTopK)
+	}
+	if req.TopP < 0 || req.TopP > 1 {
+		return errors.New("top_p must be 0..1")
+	}
+	if req.RepeatPenalty != 0 && (req.RepeatPenalty < 1 || req.RepeatPenalty > maxRepeatPenalty) {
+		return fmt.Errorf("repeat_penalty must be 1..%d", maxRepeatPenalty)
+	}
+	return nil
+}
 
-	// Serialize generation (models aren't thread-safe)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+// react runs the dual yent and image generation for a validated request.
+// Caller holds s.mu. progress (optional) spans all requested images and
+// onRoast (optional) receives the roast as it is generated; cancelling ctx
+// stops image generation early. Logs the request summary (see reqlog.go).
+func (s *Server) react(ctx context.Context, req ReactRequest, progress func(step, total int), onRoast func(piece string)) ReactResponse {
 	start := time.Now()
 
+	var sess *Session
+	if req.SessionID != "" {
+		sess = s.sessions.Get(req.SessionID)
+	}
+
 	// Dual yent react
-	result := s.dy.React(req.Input, req.MaxTokens, float32(req.Temperature))
+	opts := ReactOptions{Candidates: req.Candidates, OnRoast: onRoast, RequestID: requestID(ctx), Artist: req.Artist, RoastMaxTokens: req.RoastMaxTokens, Sampling: req.sampling(), Seed: req.TextSeed}
+	if req.RoastTempOffset != nil {
+		offset := float32(*req.RoastTempOffset)
+		opts.RoastTempOffset = &offset
+	}
+	s.yentMu.Lock()
+	var result DualResult
+	if req.Mode == modeAware {
+		result = s.dy.ReactAware(req.Input, sess, req.MaxTokens, float32(req.Temperature), opts)
+	} else {
+		result = s.dy.ReactWith(req.Input, sess, req.MaxTokens, float32(req.Temperature), opts)
+	}
 
 	// Compute dissonance for display
-	d, _ := s.dy.A.computeDissonance(req.Input)
-	temp := s.dy.A.adaptTemperature(req.Input, float32(req.Temperature))
+	var d, temp float32
+	var pulse PulseSnapshot
+	if sess != nil {
+		d, temp, pulse = sess.dissonance, sess.temperature, sess.pulse
+	} else if req.TextSeed != 0 {
+		// Replays leave model A's memory alone too
+		d, pulse, _ = s.dy.A.peekDissonance(req.Input)
+		temp, _ = s.dy.A.ExplainTemperature(req.Input, float32(req.Temperature))
+	} else {
+		d, pulse = s.dy.A.computeDissonance(req.Input)
+		temp = s.dy.A.adaptTemperature(req.Input, float32(req.Temperature))
+	}
+	s.yentMu.Unlock()
+	theme := pulseToTheme(pulse)
+	if sess != nil {
+		sess.recordTurn(SessionTurn{
+			InputLen:    len(req.Input),
+			Dissonance:  float64(d),
+			Novelty:     float64(pulse.Novelty),
+			Arousal:     float64(pulse.Arousal),
+			Entropy:     float64(pulse.Entropy),
+			Temperature: float64(temp),
+			Timestamp:   start,
+		})
+	}
 
 	resp := ReactResponse{
 		Prompt:     result.Prompt,
@@ -154,71 +858,565 @@ func (s *Server) handleReact(w http.ResponseWriter, r *http.Request) {
 		Roast:      result.Roast,
 		ArtistID:   result.ArtistID,
 		Dissonance: float64(d),
+		Surprise:   float64(surpriseScore(req.Input, result.Prompt)),
+		Theme:      &theme,
 		Temp:       float64(temp),
 		ElapsedMs:  time.Since(start).Milliseconds(),
 	}
 
-	// Try to generate image (if SD model available)
-	imgData := s.tryGenerateImage(result.Prompt)
-	if imgData != nil {
-		// Store and return as base64
-		id := fmt.Sprintf("%d", time.Now().UnixNano())
-		s.imagesMu.Lock()
-		s.images[id] = imgData
-		s.imagesMu.Unlock()
+	// Try to generate images (if SD model available), within the budget
+	if !s.textOnly && !req.TextOnly {
+		genCtx, cancel := s.generationContext(ctx)
+		defer cancel()
+		if images := s.tryGenerateImage(genCtx, result.Prompt, sketchMeta(d, pulse), req.Count, req.Format, req.Quality, progress); len(images) > 0 {
+			resp.Images = images
+			resp.ImageURL = images[0].URL
+			resp.ImageGenerated = true
+			if data, ok := s.images.Get(images[0].ID); ok {
+				resp.ImageB64 = base64.StdEncoding.EncodeToString(data)
+			}
+		}
+		resp.ImageError = generationError(ctx, genCtx)
+	}
+	if s.postDebug != "" {
+		s.dumpPostProcess(ctx, resp.Images, result.YentWords)
+	}
+	s.metrics.observeReact(time.Since(start).Seconds(), float64(d))
+	s.logRequest(requestLog{
+		RequestID:      requestID(ctx),
+		InputLen:       len(req.Input),
+		Dissonance:     resp.Dissonance,
+		ArtistID:       resp.ArtistID,
+		Temp:           resp.Temp,
+		ImageGenerated: resp.ImageGenerated,
+		ImageError:     resp.ImageError,
+		ElapsedMs:      time.Since(start).Milliseconds(),
+	})
+	return resp
+}
+
+// handleImg2Img is /react with an uploaded base image: Yent reacts to the
+// text, then the diffusion starts from the photo instead of pure noise.
+func (s *Server) handleImg2Img(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "POST only")
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeBadForm, "bad form: "+err.Error())
+		return
+	}
+
+	input := r.FormValue("input")
+	if input == "" {
+		writeError(w, http.StatusBadRequest, errCodeInputRequired, errInputRequired.Error())
+		return
+	}
+	if s.rejectLongInput(w, input) {
+		return
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeImageRequired, "image required")
+		return
+	}
+	defer file.Close()
+	src, _, err := image.Decode(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeBadImage, "bad image: "+err.Error())
+		return
+	}
+
+	strength := 0.6
+	if v := r.FormValue("strength"); v != "" {
+		strength, err = strconv.ParseFloat(v, 64)
+		if err != nil || strength < 0 || strength > 1 {
+			writeError(w, http.StatusBadRequest, errCodeInvalidRequest, "strength must be 0..1")
+			return
+		}
+	}
+	temperature := 0.8
+	if v := r.FormValue("temperature"); v != "" {
+		if t, err := strconv.ParseFloat(v, 64); err == nil && t > 0 {
+			temperature = t
+		}
+	}
+
+	init := image.NewRGBA(src.Bounds())
+	draw.Draw(init, init.Bounds(), src, src.Bounds().Min, draw.Src)
+	ctx := withRequestID(w, r)
+	if s.rejectWhileWarming(w) {
+		return
+	}
+
+	// Serialize generation (each model is single-threaded; see DualYent)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireModels(w) {
+		return
+	}
+
+	start := time.Now()
+	s.yentMu.Lock()
+	result := s.dy.ReactWith(input, nil, 30, float32(temperature), ReactOptions{RequestID: requestID(ctx)})
 
-		resp.ImageURL = "/image/" + id
-		resp.ImageB64 = base64.StdEncoding.EncodeToString(imgData)
+	d, pulse := s.dy.A.computeDissonance(input)
+	temp := s.dy.A.adaptTemperature(input, float32(temperature))
+	s.yentMu.Unlock()
+	theme := pulseToTheme(pulse)
+
+	resp := ReactResponse{
+		Prompt:     result.Prompt,
+		YentWords:  result.YentWords,
+		Roast:      result.Roast,
+		ArtistID:   result.ArtistID,
+		Dissonance: float64(d),
+		Surprise:   float64(surpriseScore(input, result.Prompt)),
+		Theme:      &theme,
+		Temp:       float64(temp),
+	}
+
+	var imgData []byte
+	if !s.textOnly {
+		genCtx, cancel := s.generationContext(ctx)
+		defer cancel()
+		imgData, _ = s.tryImg2Img(genCtx, result.Prompt, init, float32(strength))
+		resp.ImageError = generationError(ctx, genCtx)
 	}
+	if ctx.Err() != nil {
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	if imgData != nil {
+		if id, err := s.storeImage(imgData); err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s store image: %v\n", requestID(ctx), err)
+			s.metrics.incImageFailures()
+		} else {
+			resp.ImageURL = "/image/" + id
+			resp.ImageB64 = base64.StdEncoding.EncodeToString(imgData)
+			resp.ImageGenerated = true
+		}
+	}
+	resp.ElapsedMs = time.Since(start).Milliseconds()
+	s.logRequest(requestLog{
+		RequestID:      requestID(ctx),
+		InputLen:       len(input),
+		Dissonance:     resp.Dissonance,
+		ArtistID:       resp.ArtistID,
+		Temp:           resp.Temp,
+		ImageGenerated: resp.ImageGenerated,
+		ImageError:     resp.ImageError,
+		ElapsedMs:      resp.ElapsedMs,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// generationContext derives the image generation context for one request:
+// ctx bounded by the server's generation timeout
+func (s *Server) generationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := s.genTimeout
+	if timeout <= 0 {
+		timeout = defaultGenerationTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// generationError is the ImageError for a finished generation: set only when
+// genCtx ran out of time while the client (ctx) was still waiting
+func generationError(ctx, genCtx context.Context) string {
+	if ctx.Err() == nil && genCtx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "[server] req=%s image generation timed out, answering text-only\n", requestID(ctx))
+		return errGenerationTimedOut
+	}
+	return ""
+}
+
+// validImageID reports whether id looks like one storeImage hands out:
+// 1–64 ASCII letters, digits or '-'. Rejects empty ids, slashes and dots
+// before they reach the cache (or, later, a path on disk).
+func validImageID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// imageContentType sniffs the stored encoding (PNG unless it looks like JPEG)
+func imageContentType(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}) {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// transcodePNG re-encodes PNG bytes as format. PNG passes through untouched;
+// JPEG drops the PNG text metadata.
+func transcodePNG(data []byte, format string, quality int) ([]byte, error) {
+	if format != formatJPEG {
+		return data, nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// storeImage puts encoded image bytes in the image store and returns their id
+func (s *Server) storeImage(data []byte) (string, error) {
+	id := fmt.Sprintf("%d-%d", time.Now().UnixNano(), s.imageSeq.Add(1))
+	if err := s.images.Put(id, data); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
 func (s *Server) handleImage(w http.ResponseWriter, r *http.Request) {
 	id := strings.TrimPrefix(r.URL.Path, "/image/")
-	s.imagesMu.RLock()
-	data, ok := s.images[id]
-	s.imagesMu.RUnlock()
-
+	if !validImageID(id) {
+		http.Error(w, "bad image id", http.StatusBadRequest)
+		return
+	}
+	data, ok := s.images.Get(id)
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Type", imageContentType(data))
 	w.Header().Set("Cache-Control", "max-age=3600")
 	w.Write(data)
 }
 
-// tryGenerateImage attempts diffusion. Returns PNG bytes or nil.
-func (s *Server) tryGenerateImage(prompt string) []byte {
-	// Check if SD model directory exists and has tokenizer
-	tokDir := s.sdModelDir + "/tokenizer/vocab.json"
-	if _, err := os.Stat(tokDir); err != nil {
-		fmt.Fprintf(os.Stderr, "[server] SD model not available (%s), skipping image generation\n", s.sdModelDir)
+// handleSketch renders one draft. With ?input= the drafts follow that
+// input the way the CLI animation does (mood and draft count, from model
+// A without touching its memory), and draft counts within those drafts.
+func (s *Server) handleSketch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	cfg := DefaultSketchConfig()
+	if input := q.Get("input"); input != "" {
+		if s.rejectLongInput(w, input) || !s.requireModels(w) {
+			return
+		}
+		s.yentMu.Lock()
+		cfg = s.dy.A.sketchConfig(input)
+		s.yentMu.Unlock()
+	}
+
+	draft := cfg.NumDrafts - 1
+	if v := q.Get("draft"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n >= cfg.NumDrafts {
+			http.Error(w, fmt.Sprintf("draft must be 0..%d", cfg.NumDrafts-1), http.StatusBadRequest)
+			return
+		}
+		draft = n
+	}
+	seed := time.Now().UnixNano()
+	if v := q.Get("seed"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "bad seed", http.StatusBadRequest)
+			return
+		}
+		seed = n
+	}
+	cfg.Braille = q.Get("braille") == "1"
+
+	words := strings.Fields(strings.ToLower(q.Get("prompt")))
+	img := SketchToImage(cfg, cfg.stage(draft), words, rand.New(rand.NewSource(seed)))
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(w, "encode: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
+
+// handleCloud reports what Yent is fixating on: both models' clouds summed,
+// heaviest first. Doesn't take s.mu, so it answers while /react is busy.
+func (s *Server) handleCloud(w http.ResponseWriter, r *http.Request) {
+	limit := defaultCloudLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var gens []*PromptGenerator
+	if dy := s.loadedModels(); dy != nil {
+		gens = []*PromptGenerator{dy.A, dy.B}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(topCloudTerms(gens, limit))
+}
+
+// SessionHistoryResponse is the JSON response from /session/{id}/history
+type SessionHistoryResponse struct {
+	SessionID string        `json:"session_id"`
+	Turns     []SessionTurn `json:"turns"` // oldest first, at most sessionTurnsSize
+}
+
+// handleSessionHistory is GET /session/{id}/history: the session's per-turn
+// dissonance, pulse and temperature, for graphing. Doesn't take s.mu.
+func (s *Server) handleSessionHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/session/"), "/history")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	sess, ok := s.sessions.Lookup(id)
+	if !ok {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	turns := sess.Turns()
+	if turns == nil {
+		turns = []SessionTurn{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionHistoryResponse{SessionID: id, Turns: turns})
+}
+
+// handleTemperature reports the temperature model A would react to ?input=
+// with (base ?temperature=, default 0.8) and the factors behind it, without
+// touching either model's memory.
+func (s *Server) handleTemperature(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	input := q.Get("input")
+	if input == "" {
+		http.Error(w, "input required", http.StatusBadRequest)
+		return
+	}
+	base := 0.8
+	if v := q.Get("temperature"); v != "" {
+		t, err := strconv.ParseFloat(v, 32)
+		if err != nil || t <= 0 {
+			http.Error(w, "temperature must be a positive number", http.StatusBadRequest)
+			return
+		}
+		base = t
+	}
+
+	// The last input and boredom streak are only stable between reactions
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.requireModels(w) {
+		return
+	}
+	s.yentMu.Lock()
+	temp, factors := s.dy.A.ExplainTemperature(input, float32(base))
+	config := s.dy.A.temperatureConfig()
+	s.yentMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TemperatureResponse{
+		Temperature: temp,
+		Factors:     factors,
+		Config:      config,
+	})
+}
+
+// handleReset wipes what both models have accumulated — cloud, boredom and
+// last-input memory — plus all sessions, so the next visitor starts fresh.
+// With an admin token configured the request must carry it as a bearer token.
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.adminToken != "" {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(s.adminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Wait for any reaction in flight so it can't repopulate half-reset state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp ResetResponse
+	if dy := s.loadedModels(); dy != nil {
+		s.yentMu.Lock()
+		resp.ModelA = dy.A.Reset()
+		resp.ModelB = dy.B.Reset()
+		s.yentMu.Unlock()
+	}
+	resp.Sessions = s.sessions.Clear()
+	fmt.Fprintf(os.Stderr, "[server] reset: A=%+v B=%+v sessions=%d\n", resp.ModelA, resp.ModelB, resp.Sessions)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// topCloudTerms merges the generators' clouds and returns the limit
+// heaviest words (ties broken alphabetically)
+func topCloudTerms(gens []*PromptGenerator, limit int) []CloudTerm {
+	merged := make(map[string]float32)
+	for _, pg := range gens {
+		if pg == nil {
+			continue
+		}
+		for w, v := range pg.CloudSnapshot() {
+			merged[w] += v
+		}
+	}
+
+	terms := make([]CloudTerm, 0, len(merged))
+	for w, v := range merged {
+		terms = append(terms, CloudTerm{Term: w, Weight: v})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight != terms[j].Weight {
+			return terms[i].Weight > terms[j].Weight
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > limit {
+		terms = terms[:limit]
+	}
+	return terms
+}
+
+// tryGenerateImage draws count images with s.diffusion() from fresh seeds
+// and stores each result. Returns nothing if the SD model is unavailable.
+// Caller holds s.mu; candidates are generated one after another, and
+// progress (optional) counts steps across all of them. Stops at the first
+// image aborted by ctx. Images are stored in format ("png" or "jpeg"), with
+// extraMeta (may be nil) added to each one's PNG metadata.
+func (s *Server) tryGenerateImage(ctx context.Context, prompt string, extraMeta map[string]string, count int, format string, quality int, progress func(step, total int)) []ImageResult {
+	backend := s.diffusion()
+	if !backend.Ready() {
+		fmt.Fprintf(os.Stderr, "[server] req=%s %s backend not ready (%s), skipping image generation\n", requestID(ctx), backend.Name(), s.sdModelDir)
 		return nil
 	}
 
-	prompt = strings.TrimSpace(prompt)
-	if len(prompt) > 200 {
-		prompt = prompt[:200]
+	prompt = truncatePrompt(strings.TrimSpace(prompt), maxPromptBytes)
+
+	var images []ImageResult
+	for i := 0; i < count; i++ {
+		seed := s.rng.Int63()
+		var stepFn func(step, total int)
+		if progress != nil {
+			stepFn = func(step, total int) { progress(i*total+step, count*total) }
+		}
+		img, err := backend.Generate(ctx, prompt, "", GenOpts{Seed: seed, Steps: 10, LatentSize: 64, Guidance: 7.5, Progress: stepFn})
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s diffusion failed: %v\n", requestID(ctx), err)
+			s.metrics.incImageFailures()
+			continue
+		}
+		var buf bytes.Buffer
+		meta := backendMeta(backend, prompt, seed, 10, 7.5)
+		for k, v := range extraMeta {
+			meta[k] = v
+		}
+		if err := encodePNG(&buf, img, meta); err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s encode png: %v\n", requestID(ctx), err)
+			s.metrics.incImageFailures()
+			continue
+		}
+		data, err := transcodePNG(buf.Bytes(), format, quality)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s encode %s: %v\n", requestID(ctx), format, err)
+			s.metrics.incImageFailures()
+			continue
+		}
+		id, err := s.storeImage(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s store image: %v\n", requestID(ctx), err)
+			s.metrics.incImageFailures()
+			continue
+		}
+		images = append(images, ImageResult{ID: id, Seed: seed, URL: "/image/" + id})
 	}
+	return images
+}
 
-	seed := s.rng.Int63()
-	tmpPath := fmt.Sprintf("/tmp/yentyo_%d.png", time.Now().UnixNano())
-	defer os.Remove(tmpPath)
+// diffusion is the backend images are drawn with
+func (s *Server) diffusion() DiffusionBackend {
+	if s.backend != nil {
+		return s.backend
+	}
+	return pipelineBackend{modelDir: s.sdModelDir}
+}
+
+// dumpPostProcess writes every post-process stage of each image to
+// <postDebug>/<request id>-<n>/ for tuning the effects. The served images
+// are left as they are.
+func (s *Server) dumpPostProcess(ctx context.Context, images []ImageResult, words string) {
+	for n, im := range images {
+		data, _ := s.images.Get(im.ID)
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s debug-postprocess decode: %v\n", requestID(ctx), err)
+			continue
+		}
+		rgba := image.NewRGBA(src.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+
+		dir := filepath.Join(s.postDebug, fmt.Sprintf("%s-%d", requestID(ctx), n))
+		if _, err := PostProcessDebug(rgba, words, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "[server] req=%s debug-postprocess: %v\n", requestID(ctx), err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "[server] req=%s post-process stages in %s\n", requestID(ctx), dir)
+	}
+}
 
-	// Run diffusion — this may call fatal(), so we need to be careful
-	// For now, only run if we verified the model exists above
-	runDiffusion(s.sdModelDir, prompt, tmpPath, seed, 10, 64, 7.5)
+// tryImg2Img runs img2img from init with a fresh seed on s.diffusion().
+// Returns PNG bytes (nil on failure, or when the backend can't do img2img)
+// and the seed.
+func (s *Server) tryImg2Img(ctx context.Context, prompt string, init *image.RGBA, strength float32) ([]byte, int64) {
+	backend, ok := s.diffusion().(Img2ImgBackend)
+	if !ok || !backend.Ready() {
+		fmt.Fprintf(os.Stderr, "[server] req=%s %s backend can't run img2img (%s), skipping\n", requestID(ctx), s.diffusion().Name(), s.sdModelDir)
+		return nil, 0
+	}
+
+	prompt = truncatePrompt(strings.TrimSpace(prompt), maxPromptBytes)
 
-	data, err := os.ReadFile(tmpPath)
+	seed := s.rng.Int63()
+	img, err := backend.Img2Img(ctx, prompt, init, strength, GenOpts{Seed: seed, Steps: 10, LatentSize: 64, Guidance: 7.5})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "[server] no image generated: %v\n", err)
-		return nil
+		fmt.Fprintf(os.Stderr, "[server] req=%s img2img failed: %v\n", requestID(ctx), err)
+		return nil, seed
+	}
+	meta := backendMeta(backend, prompt, seed, 10, 7.5)
+	meta["strength"] = strconv.FormatFloat(float64(strength), 'f', -1, 32)
+	var buf bytes.Buffer
+	if err := encodePNG(&buf, img, meta); err != nil {
+		fmt.Fprintf(os.Stderr, "[server] req=%s img2img encode: %v\n", requestID(ctx), err)
+		return nil, seed
 	}
-	return data
+	return buf.Bytes(), seed
 }
 
 // pngToBytes encodes an image to PNG bytes (for in-memory responses)
@@ -227,4 +1425,4 @@ func pngToBytes(img interface{ Bounds() interface{ Dx() int } }) []byte {
 }
 
 // Unused but kept for potential streaming
-var _ = png.Encode
\ No newline at end of file
+var _ = png.Encode
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func newTestServer() *Server {
 	return &Server{
-		images: make(map[string][]byte),
+		images: NewMemoryImageStore(),
 	}
 }
 
@@ -35,6 +50,33 @@ func TestHandleUI(t *testing.T) {
 	}
 }
 
+func TestHandleUIETag(t *testing.T) {
+	srv := newTestServer()
+
+	w := httptest.NewRecorder()
+	srv.handleUI(w, httptest.NewRequest("GET", "/", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q; want 200 with an ETag", w.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	srv.handleUI(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("revalidation: status %d with %d body bytes, want 304 and no body", w.Code, w.Body.Len())
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	srv.handleUI(w, req)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "yent.yo") {
+		t.Errorf("stale ETag: status %d, want the full page", w.Code)
+	}
+}
+
 func TestHandleUINotFound(t *testing.T) {
 	srv := newTestServer()
 
@@ -87,7 +129,7 @@ func TestHandleImage(t *testing.T) {
 	srv := newTestServer()
 
 	// Store a test image
-	srv.images["test123"] = []byte{0x89, 0x50, 0x4E, 0x47} // PNG magic bytes
+	srv.images.Put("test123", []byte{0x89, 0x50, 0x4E, 0x47}) // PNG magic bytes
 
 	req := httptest.NewRequest("GET", "/image/test123", nil)
 	w := httptest.NewRecorder()
@@ -105,6 +147,39 @@ func TestHandleImage(t *testing.T) {
 	}
 }
 
+func TestHandleImageBadID(t *testing.T) {
+	srv := newTestServer()
+	srv.images.Put("", []byte{0xFF})
+	srv.images.Put("a/b", []byte{0xFF})
+
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/image/", 400},
+		{"/image/a/b", 400},
+		{"/image/../..", 400},
+		{"/image/x.png", 400},
+		{"/image/1700000000-1", 404},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		w := httptest.NewRecorder()
+		srv.handleImage(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s: status = %d, want %d", c.path, w.Code, c.want)
+		}
+	}
+}
+
+func TestStoreImageIDsAreValid(t *testing.T) {
+	srv := newTestServer()
+	id, err := srv.storeImage([]byte{0x89})
+	if err != nil || !validImageID(id) {
+		t.Errorf("storeImage id %q fails validImageID", id)
+	}
+}
+
 func TestHandleImageNotFound(t *testing.T) {
 	srv := newTestServer()
 
@@ -119,7 +194,7 @@ func TestHandleImageNotFound(t *testing.T) {
 
 func TestHandleImageCacheHeader(t *testing.T) {
 	srv := newTestServer()
-	srv.images["cached"] = []byte{0xFF}
+	srv.images.Put("cached", []byte{0xFF})
 
 	req := httptest.NewRequest("GET", "/image/cached", nil)
 	w := httptest.NewRecorder()
@@ -158,6 +233,174 @@ func TestHealthResponseJSON(t *testing.T) {
 	}
 }
 
+func TestHealthReportsThreads(t *testing.T) {
+	origProcs, origWorkers := runtime.GOMAXPROCS(0), postWorkers
+	defer func() {
+		runtime.GOMAXPROCS(origProcs)
+		postWorkers, inferenceThreads = origWorkers, 0
+	}()
+
+	setThreads(2)
+	srv := newTestServer()
+	w := httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	var h HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Threads != 2 {
+		t.Errorf("health threads = %d after --threads 2", h.Threads)
+	}
+	if postWorkers != 2 || ortThreads() != 2 {
+		t.Errorf("--threads 2 left %d post-processing workers and %d ORT threads", postWorkers, ortThreads())
+	}
+}
+
+func TestHealthModelConfig(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.dy.B.model.Config.VocabSize = 300
+	srv.dy.B.model.Config.SeqLen = 256
+
+	w := httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	var h HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	a := srv.dy.A.model.Config
+	if h.ModelAVocab != a.VocabSize || h.ModelBVocab != 300 {
+		t.Errorf("vocab sizes = %d, %d; want %d, 300", h.ModelAVocab, h.ModelBVocab, a.VocabSize)
+	}
+	if h.ContextLength != 256 {
+		t.Errorf("context_length = %d, want the shorter window, 256", h.ContextLength)
+	}
+	if h.ModelA == "" || h.ModelB == "" {
+		t.Errorf("health = %+v lost the layer/dim summaries", h)
+	}
+}
+
+// writeFakeSDModel puts placeholder files for every sdModelFiles entry in dir
+func writeFakeSDModel(dir string) {
+	for _, f := range sdModelFiles {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0755)
+		os.WriteFile(filepath.Join(dir, f), []byte("{}"), 0644)
+	}
+}
+
+func TestHandleHealthReadiness(t *testing.T) {
+	health := func(srv *Server) map[string]interface{} {
+		w := httptest.NewRecorder()
+		srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+		var m map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = filepath.Join(t.TempDir(), "no-such-model")
+	h := health(srv)
+	if h["yents_ready"] != true || h["image_generation"] != false || h["sd_ready"] != false || h["ready"] != false {
+		t.Errorf("bogus SD dir: %v, want yents ready, text-only, not ready", h)
+	}
+
+	// Tokenizer alone is not enough
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "tokenizer"), 0755)
+	os.WriteFile(filepath.Join(dir, "tokenizer", "vocab.json"), []byte("{}"), 0644)
+	srv.sdModelDir = dir
+	if h := health(srv); h["sd_ready"] != false {
+		t.Errorf("tokenizer only: sd_ready = %v, want false", h["sd_ready"])
+	}
+
+	writeFakeSDModel(dir)
+	if h := health(srv); h["ready"] != true || h["image_generation"] != true {
+		t.Errorf("full SD dir: %v, want ready with image generation", h)
+	}
+
+	// No yents loaded: no panic, not ready
+	if h := health(newTestServer()); h["yents_ready"] != false || h["ready"] != false {
+		t.Errorf("no yents: %v, want not ready", h)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+
+	diffusions := 0
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		diffusions++
+		return saveProcessedPNG(image.NewRGBA(image.Rect(0, 0, 2, 2)), outPath, nil)
+	}
+
+	srv := newTestServer()
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.warmingUp.Store(true)
+	mux := srv.routes()
+
+	get := func() HealthResponse {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		var h HealthResponse
+		json.Unmarshal(w.Body.Bytes(), &h)
+		return h
+	}
+	react := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"hi"}`)))
+		return w
+	}
+
+	if h := get(); h.WarmedUp {
+		t.Error("warmed_up before warm-up ran")
+	}
+	if w := react(); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("/react while warming = %d (Retry-After %q), want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	srv.warmUp()
+
+	h := get()
+	if !h.WarmedUp || h.WarmupMs < 0 {
+		t.Errorf("after warm-up: warmed_up=%v warmup_ms=%d", h.WarmedUp, h.WarmupMs)
+	}
+	if diffusions != 1 {
+		t.Errorf("warm-up ran %d diffusions, want 1", diffusions)
+	}
+	if len(srv.dy.A.cloud) != 0 || len(srv.dy.B.cloud) != 0 {
+		t.Error("warm-up reaction should not leave words in the clouds")
+	}
+	if w := react(); w.Code != http.StatusOK {
+		t.Errorf("/react after warm-up = %d, want 200", w.Code)
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestServer().routes().ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Code != 200 || !strings.Contains(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("status %d, content-type %q; want 200 JSON", w.Code, w.Header().Get("Content-Type"))
+	}
+	var v VersionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version == "" || v.Version != yentYoVersion {
+		t.Errorf("version = %q, want %q", v.Version, yentYoVersion)
+	}
+	if v.GoVersion == "" {
+		t.Error("go_version should be set")
+	}
+}
+
 func TestReactResponseSerialization(t *testing.T) {
 	resp := ReactResponse{
 		Prompt:     "test prompt",
@@ -199,18 +442,14 @@ func TestImageConcurrentAccess(t *testing.T) {
 
 	go func() {
 		for i := 0; i < 100; i++ {
-			srv.imagesMu.Lock()
-			srv.images["test"] = []byte{0xFF}
-			srv.imagesMu.Unlock()
+			srv.images.Put("test", []byte{0xFF})
 		}
 		done <- true
 	}()
 
 	go func() {
 		for i := 0; i < 100; i++ {
-			srv.imagesMu.RLock()
-			_ = srv.images["test"]
-			srv.imagesMu.RUnlock()
+			srv.images.Get("test")
 		}
 		done <- true
 	}()
@@ -249,21 +488,233 @@ func TestTryGenerateImageNoModel(t *testing.T) {
 	srv := newTestServer()
 	srv.sdModelDir = "/nonexistent/path"
 
-	result := srv.tryGenerateImage("test prompt")
+	result := srv.tryGenerateImage(context.Background(), "test prompt", nil, 1, formatPNG, 0, nil)
 	if result != nil {
 		t.Error("should return nil when SD model not available")
 	}
 }
 
+func TestTryGenerateImageCount(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+		saveProcessedPNG(img, outPath, nil)
+		for i := 1; i <= numSteps; i++ {
+			if progress != nil {
+				progress(i, numSteps)
+			}
+		}
+		return nil
+	}
+
+	srv := newTestServer()
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+
+	var steps []int
+	images := srv.tryGenerateImage(context.Background(), "duck", nil, 4, formatPNG, 0, func(step, total int) {
+		if total != 40 {
+			t.Errorf("total = %d, want 40 (4 images × 10 steps)", total)
+		}
+		steps = append(steps, step)
+	})
+	if len(images) != 4 {
+		t.Fatalf("got %d images, want 4", len(images))
+	}
+	ids := map[string]bool{}
+	seeds := map[int64]bool{}
+	for _, im := range images {
+		ids[im.ID] = true
+		seeds[im.Seed] = true
+		if im.URL != "/image/"+im.ID {
+			t.Errorf("url = %q, want /image/%s", im.URL, im.ID)
+		}
+		if _, ok := srv.images.Get(im.ID); !ok {
+			t.Errorf("image %s not stored", im.ID)
+		}
+	}
+	if len(ids) != 4 {
+		t.Errorf("got %d distinct ids, want 4", len(ids))
+	}
+	if len(seeds) != 4 {
+		t.Errorf("got %d distinct seeds, want 4", len(seeds))
+	}
+	for i, step := range steps {
+		if step != i+1 {
+			t.Fatalf("progress call %d reported step %d, want %d", i, step, i+1)
+		}
+	}
+	if len(steps) != 40 {
+		t.Errorf("progress called %d times, want 40", len(steps))
+	}
+}
+
+func TestTryGenerateImageCyrillicPrompt(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+
+	var got string
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		got = prompt
+		return nil
+	}
+
+	srv := newTestServer()
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+
+	// 150 runes, 300 bytes, no spaces: only a rune-boundary cut is possible
+	prompt := strings.Repeat("ж", 150)
+	srv.tryGenerateImage(context.Background(), prompt, nil, 1, formatPNG, 0, nil)
+	if !utf8.ValidString(got) {
+		t.Fatalf("prompt reached diffusion as invalid UTF-8: %q", got)
+	}
+	if len(got) > maxPromptBytes || got != strings.Repeat("ж", maxPromptBytes/2) {
+		t.Errorf("prompt = %d bytes (%d runes), want %d whole runes", len(got), utf8.RuneCountInString(got), maxPromptBytes/2)
+	}
+}
+
+func TestTryGenerateImageCancel(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+
+	runs := 0
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		runs++
+		for i := 1; i <= numSteps; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			progress(i, numSteps)
+		}
+		return saveProcessedPNG(image.NewRGBA(image.Rect(0, 0, 2, 2)), outPath, nil)
+	}
+
+	srv := newTestServer()
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	steps := 0
+	images := srv.tryGenerateImage(ctx, "duck", nil, 4, formatPNG, 0, func(step, total int) {
+		steps++
+		cancel()
+	})
+
+	if runs != 1 || steps != 1 {
+		t.Errorf("runs = %d, steps = %d after cancel at first step, want 1 and 1", runs, steps)
+	}
+	if len(images) != 0 {
+		t.Errorf("got %d images from a cancelled request, want 0", len(images))
+	}
+}
+
+func TestHandleReactGenerationTimeout(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+
+	cancelled := make(chan struct{}, 1)
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		select {
+		case <-ctx.Done():
+			cancelled <- struct{}{}
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+			return saveProcessedPNG(image.NewRGBA(image.Rect(0, 0, 2, 2)), outPath, nil)
+		}
+	}
+
+	srv := newTestServer()
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.genTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	req := httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"paint me a duck"}`))
+	w := httptest.NewRecorder()
+	srv.handleReact(w, req)
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("took %v, want the text-only answer right after the 50ms budget", elapsed)
+	}
+	var resp ReactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ImageError != errGenerationTimedOut {
+		t.Errorf("image_error = %q, want %q", resp.ImageError, errGenerationTimedOut)
+	}
+	if resp.Prompt == "" || resp.Roast == "" {
+		t.Errorf("prompt %q, roast %q: the text reaction should survive the timeout", resp.Prompt, resp.Roast)
+	}
+	if len(resp.Images) != 0 || resp.ImageURL != "" {
+		t.Errorf("got images %v from a timed-out generation", resp.Images)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("diffusion never saw its context cancelled")
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	var buf bytes.Buffer
+	writeSSE(&buf, "progress", ProgressEvent{Step: 3, Total: 10})
+	want := "event: progress\ndata: {\"step\":3,\"total\":10}\n\n"
+	if buf.String() != want {
+		t.Errorf("writeSSE = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestHandleReactStreamValidation(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest("GET", "/react/stream", nil)
+	w := httptest.NewRecorder()
+	srv.handleReactStream(w, req)
+	if w.Code != 405 {
+		t.Errorf("status = %d, want 405 for GET", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/react/stream", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	srv.handleReactStream(w, req)
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400 without input", w.Code)
+	}
+}
+
+func TestHandleReactCountOutOfRange(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"hi","count":9}`))
+	w := httptest.NewRecorder()
+	srv.handleReact(w, req)
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400 for count=9", w.Code)
+	}
+}
+
 // Test that all mux routes are registered correctly
 func TestServerRoutes(t *testing.T) {
-	mux := http.NewServeMux()
 	srv := newTestServer()
-
-	mux.HandleFunc("/", srv.handleUI)
-	mux.HandleFunc("/health", srv.handleHealth)
-	mux.HandleFunc("/react", srv.handleReact)
-	mux.HandleFunc("/image/", srv.handleImage)
+	mux := srv.routes()
 
 	routes := []struct {
 		path   string
@@ -275,6 +726,14 @@ func TestServerRoutes(t *testing.T) {
 		{"/react", "GET", 405},
 		{"/react", "POST", 400}, // empty body
 		{"/image/missing", "GET", 404},
+		{"/react/stream", "GET", 405},
+		{"/react/img2img", "GET", 405},
+		{"/react/batch", "GET", 405},
+		{"/sketch?draft=0", "GET", 200},
+		{"/cloud", "GET", 200},
+		{"/temperature", "GET", 400}, // no input
+		{"/reset", "GET", 405},
+		{"/version", "GET", 200},
 	}
 
 	for _, r := range routes {
@@ -286,3 +745,559 @@ func TestServerRoutes(t *testing.T) {
 		}
 	}
 }
+
+func TestCORSPreflight(t *testing.T) {
+	h := withCORS(newTestServer().routes(), []string{"*"})
+
+	req := httptest.NewRequest("OPTIONS", "/react", nil)
+	req.Header.Set("Origin", "https://ui.example")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != 204 {
+		t.Errorf("preflight status = %d, want 204", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "POST") {
+		t.Errorf("Allow-Methods = %q, want POST included", got)
+	}
+}
+
+func TestCORSOnPost(t *testing.T) {
+	h := withCORS(newTestServer().routes(), []string{"https://ui.example"})
+
+	// Rejected by validation, but the CORS header must still be there
+	req := httptest.NewRequest("POST", "/react", strings.NewReader(`{}`))
+	req.Header.Set("Origin", "https://ui.example")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://ui.example" {
+		t.Errorf("Allow-Origin = %q, want https://ui.example", got)
+	}
+
+	req = httptest.NewRequest("POST", "/react", strings.NewReader(`{}`))
+	req.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Allow-Origin = %q for disallowed origin, want empty", got)
+	}
+}
+
+func TestRunServerGracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	released := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- runServer(ctx, ln, newTestServer().routes(), func() { close(released) })
+	}()
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("GET /: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runServer = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServer did not return after shutdown")
+	}
+
+	select {
+	case <-released:
+	default:
+		t.Error("release (model Free) not called on shutdown")
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		conn.Close()
+		t.Error("listener still accepting after shutdown")
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.images.Put("a", []byte{0x89})
+	srv.images.Put("b", []byte{0x89})
+
+	srv.Close()
+
+	if srv.dy.A.model != nil || srv.dy.B.model != nil {
+		t.Error("Close did not free the dual yent")
+	}
+	if n := srv.images.Len(); n != 0 {
+		t.Errorf("%d images left after Close, want 0", n)
+	}
+
+	// Closing a lazy server that never loaded anything is fine
+	lazy := newTestServer()
+	lazy.loadModels = func() (*DualYent, error) {
+		t.Error("Close loaded the models")
+		return nil, nil
+	}
+	lazy.Close()
+}
+
+func TestHandleSketch(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest("GET", "/sketch?prompt=duck&draft=1&seed=3", nil)
+	w := httptest.NewRecorder()
+	srv.handleSketch(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Result().Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("content-type = %q, want image/png", ct)
+	}
+	if !strings.HasPrefix(w.Body.String(), "\x89PNG") {
+		t.Error("body should be a PNG")
+	}
+
+	req = httptest.NewRequest("GET", "/sketch?draft=99", nil)
+	w = httptest.NewRecorder()
+	srv.handleSketch(w, req)
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400 for out-of-range draft", w.Code)
+	}
+
+	// With ?input= the draft count follows the input's dissonance: what
+	// Yent has just seen gets one sketch, something new gets them all
+	srv.dy = &DualYent{A: newTestPG(), B: newTestPG()}
+	srv.dy.A.computeDissonance("rain on the roof")
+	draftStatus := func(input string, draft int) int {
+		w := httptest.NewRecorder()
+		srv.handleSketch(w, httptest.NewRequest("GET", fmt.Sprintf("/sketch?input=%s&draft=%d&seed=1", url.QueryEscape(input), draft), nil))
+		return w.Code
+	}
+	if got := draftStatus("rain on the roof", 1); got != 400 {
+		t.Errorf("repeated input, draft 1: status %d, want 400 (a single draft)", got)
+	}
+	if got := draftStatus("rain on the roof", 0); got != 200 {
+		t.Errorf("repeated input, draft 0: status %d, want 200", got)
+	}
+	if got := draftStatus("purple elephants negotiate tax law", 2); got != 200 {
+		t.Errorf("new input, draft 2: status %d, want 200", got)
+	}
+	if cloud := srv.dy.A.CloudSnapshot(); cloud["purple"] != 0 {
+		t.Error("/sketch?input= fed the input into the cloud")
+	}
+}
+
+func TestHandleCloud(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = &DualYent{A: newTestPG(), B: newTestPG()}
+
+	srv.dy.A.computeDissonance("rain rain rain on the roof")
+	srv.dy.B.computeDissonance("the rain and the sea")
+	srv.dy.A.computeDissonance("rain again")
+
+	req := httptest.NewRequest("GET", "/cloud", nil)
+	w := httptest.NewRecorder()
+	srv.handleCloud(w, req)
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var terms []CloudTerm
+	if err := json.NewDecoder(w.Body).Decode(&terms); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(terms) == 0 {
+		t.Fatal("cloud is empty")
+	}
+	if terms[0].Term != "rain" {
+		t.Errorf("top term = %q, want rain", terms[0].Term)
+	}
+	for i := 1; i < len(terms); i++ {
+		if terms[i].Weight > terms[i-1].Weight {
+			t.Errorf("terms not sorted: %v before %v", terms[i-1], terms[i])
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/cloud?limit=2", nil)
+	w = httptest.NewRecorder()
+	srv.handleCloud(w, req)
+	terms = nil
+	json.NewDecoder(w.Body).Decode(&terms)
+	if len(terms) != 2 {
+		t.Errorf("limit=2 returned %d terms", len(terms))
+	}
+
+	req = httptest.NewRequest("GET", "/cloud?limit=zero", nil)
+	w = httptest.NewRecorder()
+	srv.handleCloud(w, req)
+	if w.Code != 400 {
+		t.Errorf("status = %d, want 400 for bad limit", w.Code)
+	}
+}
+
+func TestHandleReset(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = &DualYent{A: newTestPG(), B: newTestPG()}
+	srv.adminToken = "s3cret"
+	srv.sessions.Get("visitor")
+
+	for i := 0; i < 4; i++ {
+		srv.dy.A.computeDissonance("hello")
+	}
+	if srv.dy.A.boredomCount < 2 {
+		t.Fatalf("boredom = %d after repeats, want >= 2", srv.dy.A.boredomCount)
+	}
+
+	req := httptest.NewRequest("POST", "/reset", nil)
+	w := httptest.NewRecorder()
+	srv.handleReset(w, req)
+	if w.Code != 401 {
+		t.Fatalf("status without token = %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/reset", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w = httptest.NewRecorder()
+	srv.handleReset(w, req)
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var resp ResetResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.ModelA.Boredom < 2 || resp.ModelA.CloudSize == 0 {
+		t.Errorf("pre-reset stats = %+v, want boredom >= 2 and a cloud", resp.ModelA)
+	}
+	if resp.Sessions != 1 {
+		t.Errorf("pre-reset sessions = %d, want 1", resp.Sessions)
+	}
+
+	if srv.dy.A.boredomCount != 0 {
+		t.Errorf("boredom after reset = %d, want 0", srv.dy.A.boredomCount)
+	}
+	if srv.sessions.Len() != 0 {
+		t.Errorf("sessions after reset = %d, want 0", srv.sessions.Len())
+	}
+	d, pulse := srv.dy.A.computeDissonance("hello")
+	if pulse.Novelty != 1 {
+		t.Errorf("novelty after reset = %.2f, want 1", pulse.Novelty)
+	}
+	if d < 0.9 {
+		t.Errorf("dissonance after reset = %.3f, want >= 0.9 (nothing to compare with)", d)
+	}
+	if srv.dy.A.boredomCount != 0 {
+		t.Errorf("boredom after first post-reset input = %d, want 0", srv.dy.A.boredomCount)
+	}
+}
+
+func TestHandleImg2ImgValidation(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest("GET", "/react/img2img", nil)
+	w := httptest.NewRecorder()
+	srv.handleImg2Img(w, req)
+	if w.Code != 405 || apiErrorCode(w) != errCodeMethodNotAllowed {
+		t.Errorf("status = %d (%s), want 405 for GET", w.Code, w.Body)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("input", "hello")
+	mw.Close()
+	req = httptest.NewRequest("POST", "/react/img2img", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	srv.handleImg2Img(w, req)
+	if w.Code != 400 || apiErrorCode(w) != errCodeImageRequired {
+		t.Errorf("status = %d (%s), want 400 without image", w.Code, w.Body)
+	}
+}
+
+func TestTranscodePNGToJPEG(t *testing.T) {
+	// Smooth gradient with a little texture — photo-like, where JPEG wins
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	rng := rand.New(rand.NewSource(5))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			n := uint8(rng.Intn(12))
+			img.SetRGBA(x, y, color.RGBA{uint8(x) + n, uint8(y) + n, uint8(x+y)/2 + n, 255})
+		}
+	}
+	var pngBuf bytes.Buffer
+	png.Encode(&pngBuf, img)
+
+	jpg, err := transcodePNG(pngBuf.Bytes(), formatJPEG, 80)
+	if err != nil {
+		t.Fatalf("transcode: %v", err)
+	}
+	if !bytes.HasPrefix(jpg, []byte{0xFF, 0xD8, 0xFF}) {
+		t.Errorf("jpeg magic = % x, want ff d8 ff", jpg[:3])
+	}
+	if len(jpg) >= pngBuf.Len() {
+		t.Errorf("jpeg %d bytes, want smaller than png %d bytes", len(jpg), pngBuf.Len())
+	}
+
+	same, _ := transcodePNG(pngBuf.Bytes(), formatPNG, 80)
+	if !bytes.HasPrefix(same, []byte(pngSignature)) {
+		t.Error("png format should pass PNG bytes through")
+	}
+}
+
+func TestHandleImageJPEGContentType(t *testing.T) {
+	srv := newTestServer()
+	srv.images.Put("j", []byte{0xFF, 0xD8, 0xFF, 0xE0})
+
+	req := httptest.NewRequest("GET", "/image/j", nil)
+	w := httptest.NewRecorder()
+	srv.handleImage(w, req)
+	if ct := w.Result().Header.Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("content-type = %q, want image/jpeg", ct)
+	}
+}
+
+func TestHandleReactBadModeOrCandidates(t *testing.T) {
+	srv := newTestServer()
+	for _, body := range []string{
+		`{"input":"hi","mode":"sequential"}`,
+		`{"input":"hi","candidates":6}`,
+		`{"input":"hi","candidates":-1}`,
+	} {
+		req := httptest.NewRequest("POST", "/react", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.handleReact(w, req)
+		if w.Code != 400 {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestHandleReactBadFormat(t *testing.T) {
+	srv := newTestServer()
+	for _, body := range []string{
+		`{"input":"hi","format":"webp"}`,
+		`{"input":"hi","format":"jpeg","quality":101}`,
+	} {
+		req := httptest.NewRequest("POST", "/react", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.handleReact(w, req)
+		if w.Code != 400 {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestHandleTemperature(t *testing.T) {
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+
+	req := httptest.NewRequest("GET", "/temperature?input=I+hate+the+rain&temperature=0.5", nil)
+	w := httptest.NewRecorder()
+	srv.handleTemperature(w, req)
+
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	var resp TemperatureResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Factors.Base != 0.5 || resp.Factors.Arousal <= 0 {
+		t.Errorf("factors = %+v, want base 0.5 and some arousal", resp.Factors)
+	}
+	if resp.Config != DefaultTemperatureConfig {
+		t.Errorf("config = %+v, want the default", resp.Config)
+	}
+	if resp.Temperature < resp.Config.Min || resp.Temperature > resp.Config.Max {
+		t.Errorf("temperature = %.3f outside [%.1f, %.1f]", resp.Temperature, resp.Config.Min, resp.Config.Max)
+	}
+	if len(srv.dy.A.recent) != 0 {
+		t.Error("/temperature left the input in model A's memory")
+	}
+}
+
+func TestDecodeReactRequestArtist(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"input":"x"}`:                 ArtistAuto,
+		`{"input":"x","artist":"auto"}`: ArtistAuto,
+		`{"input":"x","artist":"a"}`:    ArtistA,
+		`{"input":"x","artist":"B"}`:    ArtistB,
+		`{"input":"x","artist":"C"}`:    "",
+	} {
+		w := httptest.NewRecorder()
+		req, ok := decodeReactRequest(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+		if want == "" {
+			if ok || w.Code != 400 {
+				t.Errorf("%s: accepted (status %d), want 400", body, w.Code)
+			}
+			continue
+		}
+		if !ok || req.Artist != want {
+			t.Errorf("%s: artist = %q (ok %v), want %q", body, req.Artist, ok, want)
+		}
+	}
+}
+
+func TestHandleReactInputTooLong(t *testing.T) {
+	srv := newTestServer()
+	srv.maxInput = 10
+
+	body := `{"input":"` + strings.Repeat("й", 11) + `"}`
+	w := httptest.NewRecorder()
+	srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("11 chars: status = %d, want 413", w.Code)
+	}
+
+	// The limit is in characters: 10 two-byte runes still fit
+	if srv.inputTooLong(strings.Repeat("й", 10)) {
+		t.Error("10 chars counted as too long")
+	}
+	if defaultMaxInputChars != 2000 || newTestServer().inputTooLong(strings.Repeat("x", 2000)) {
+		t.Error("default limit should accept 2000 characters")
+	}
+}
+
+func TestHandleReactErrorsJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		method string
+		body   string
+		setup  func(*Server)
+		status int
+		code   string
+	}{
+		{"GET", "GET", "", nil, http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{"bad json", "POST", `{"input":`, nil, http.StatusBadRequest, errCodeBadJSON},
+		{"empty input", "POST", `{"input":""}`, nil, http.StatusBadRequest, errCodeInputRequired},
+		{"bad count", "POST", `{"input":"x","count":99}`, nil, http.StatusBadRequest, errCodeInvalidRequest},
+		{"too long", "POST", `{"input":"0123456789x"}`, func(s *Server) { s.maxInput = 10 }, http.StatusRequestEntityTooLarge, errCodeInputTooLong},
+		{"warming up", "POST", `{"input":"x"}`, func(s *Server) { s.warmingUp.Store(true) }, http.StatusServiceUnavailable, errCodeWarmingUp},
+		{"no models", "POST", `{"input":"x"}`, nil, http.StatusServiceUnavailable, errCodeModelsUnavailable},
+	} {
+		srv := newTestServer()
+		if tc.setup != nil {
+			tc.setup(srv)
+		}
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest(tc.method, "/react", strings.NewReader(tc.body)))
+
+		var body struct {
+			Error APIError `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: body %q is not JSON: %v", tc.name, w.Body.String(), err)
+			continue
+		}
+		if w.Code != tc.status || body.Error.Code != tc.code || body.Error.Message == "" {
+			t.Errorf("%s: status %d, error %+v; want %d with code %q and a message", tc.name, w.Code, body.Error, tc.status, tc.code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q, want application/json", tc.name, ct)
+		}
+	}
+}
+
+// apiErrorCode is the code of the APIError body in w, or "" if there isn't one
+func apiErrorCode(w *httptest.ResponseRecorder) string {
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return body.Error.Code
+}
+
+func TestTruncatePrompt(t *testing.T) {
+	cases := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short prompt", 200, "short prompt"},
+		{"oil painting of a duck", 14, "oil painting"},
+		{"oil painting", 12, "oil painting"},
+		{"abcdefgh", 5, "abcde"},
+		{"ёёёё", 5, "ёё"},             // never splits a two-byte rune
+		{"утка в огне", 14, "утка в"}, // word boundary in Cyrillic
+		{"🔥🔥", 6, "🔥"},
+	}
+	for _, c := range cases {
+		got := truncatePrompt(c.in, c.max)
+		if got != c.want || !utf8.ValidString(got) || len(got) > c.max {
+			t.Errorf("truncatePrompt(%q, %d) = %q, want %q", c.in, c.max, got, c.want)
+		}
+	}
+}
+
+func TestTextOnlyMode(t *testing.T) {
+	dir := t.TempDir()
+	writeFakeSDModel(dir)
+
+	diffusions := 0
+	orig := runDiffusion
+	defer func() { runDiffusion = orig }()
+	runDiffusion = func(ctx context.Context, modelDir, prompt, outPath string, seed int64, numSteps, latentSize int, guidanceScale float32, progress func(step, total int)) error {
+		diffusions++
+		return nil
+	}
+
+	react := func(srv *Server, body string) ReactResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+		if w.Code != 200 {
+			t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+		}
+		var resp ReactResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Server-wide, with a perfectly good SD model on disk
+	srv := newTestServer()
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+	srv.sdModelDir = dir
+	srv.rng = rand.New(rand.NewSource(1))
+	srv.textOnly = true
+	resp := react(srv, `{"input":"paint me a duck"}`)
+	if diffusions != 0 {
+		t.Errorf("text-only server ran diffusion %d times", diffusions)
+	}
+	if resp.Prompt == "" || resp.Roast == "" || resp.ImageGenerated || resp.ImageError != "" || resp.ImageURL != "" {
+		t.Errorf("response = %+v, want a full text reaction and no image or image error", resp)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	var h HealthResponse
+	json.Unmarshal(w.Body.Bytes(), &h)
+	if !h.TextOnly || h.ImageGeneration {
+		t.Errorf("health = %+v, want text_only and no image_generation", h)
+	}
+
+	// Per request
+	srv.textOnly = false
+	if resp := react(srv, `{"input":"paint me a goose","text_only":true}`); resp.ImageGenerated || diffusions != 0 {
+		t.Errorf("text_only request: image_generated %v, %d diffusions", resp.ImageGenerated, diffusions)
+	}
+	react(srv, `{"input":"paint me a swan"}`)
+	if diffusions == 0 {
+		t.Error("a normal request after text_only ones ran no diffusion")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+// session.go — per-conversation memory for /react
+//
+// Without a session every /react is judged against whatever the artist model
+// saw last, and the artist alternates between A and B each turn. A Session
+// keeps the conversation's own recent inputs and boredom counter, so
+// repetition two or three turns back still reads as repetition, and the
+// commentator can throw earlier lines back at the user.
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	sessionHistorySize = 8                // inputs remembered per session
+	sessionTurnsSize   = 64               // turns kept for /session/{id}/history
+	sessionTTL         = 30 * time.Minute // idle sessions expire after this
+)
+
+// Session is one conversation's memory. Not safe for concurrent use; the
+// server only touches it while holding Server.mu. The exception is turns,
+// which has its own lock so the history endpoint answers while /react is
+// busy.
+type Session struct {
+	history  []string // oldest first, at most sessionHistorySize
+	boredom  int      // consecutive low-dissonance turns in this session
+	lastSeen time.Time
+
+	// Last values computed for this session (for the response body)
+	dissonance  float32
+	temperature float32
+	pulse       PulseSnapshot
+
+	turnsMu sync.Mutex
+	turns   []SessionTurn // oldest first, at most sessionTurnsSize
+}
+
+// SessionTurn is what one /react measured, for graphing a session
+type SessionTurn struct {
+	InputLen    int       `json:"input_len"`
+	Dissonance  float64   `json:"dissonance"`
+	Novelty     float64   `json:"novelty"`
+	Arousal     float64   `json:"arousal"`
+	Entropy     float64   `json:"entropy"`
+	Temperature float64   `json:"temperature"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// History returns a copy of the remembered inputs, oldest first
+func (s *Session) History() []string {
+	return append([]string(nil), s.history...)
+}
+
+// Turns returns a copy of the recorded turns, oldest first
+func (s *Session) Turns() []SessionTurn {
+	s.turnsMu.Lock()
+	defer s.turnsMu.Unlock()
+	return append([]SessionTurn(nil), s.turns...)
+}
+
+// recordTurn appends turn, dropping the oldest when full
+func (s *Session) recordTurn(turn SessionTurn) {
+	s.turnsMu.Lock()
+	defer s.turnsMu.Unlock()
+	if len(s.turns) == sessionTurnsSize {
+		copy(s.turns, s.turns[1:])
+		s.turns = s.turns[:sessionTurnsSize-1]
+	}
+	s.turns = append(s.turns, turn)
+}
+
+// remember appends input, dropping the oldest entry when full
+func (s *Session) remember(input string) {
+	if len(s.history) == sessionHistorySize {
+		copy(s.history, s.history[1:])
+		s.history = s.history[:sessionHistorySize-1]
+	}
+	s.history = append(s.history, input)
+}
+
+// SessionStore maps session ids to sessions. The zero value is ready to use.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	ttl      time.Duration    // 0 → sessionTTL
+	now      func() time.Time // nil → time.Now (tests override)
+}
+
+// Get returns the session for id, creating it if needed, and refreshes its
+// idle timer. Expired sessions are swept on the way.
+func (st *SessionStore) Get(id string) *Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now, ttl := st.clock(), st.timeout()
+	if st.sessions == nil {
+		st.sessions = make(map[string]*Session)
+	}
+	for k, s := range st.sessions {
+		if now.Sub(s.lastSeen) > ttl {
+			delete(st.sessions, k)
+		}
+	}
+
+	s, ok := st.sessions[id]
+	if !ok {
+		s = &Session{}
+		st.sessions[id] = s
+	}
+	s.lastSeen = now
+	return s
+}
+
+// Lookup returns the live session for id, if any, without creating it or
+// refreshing its idle timer
+func (st *SessionStore) Lookup(id string) (*Session, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.sessions[id]
+	if !ok || st.clock().Sub(s.lastSeen) > st.timeout() {
+		return nil, false
+	}
+	return s, true
+}
+
+func (st *SessionStore) clock() time.Time {
+	if st.now != nil {
+		return st.now()
+	}
+	return time.Now()
+}
+
+func (st *SessionStore) timeout() time.Duration {
+	if st.ttl == 0 {
+		return sessionTTL
+	}
+	return st.ttl
+}
+
+// Len reports the number of live sessions
+func (st *SessionStore) Len() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.sessions)
+}
+
+// Clear drops every session and reports how many there were
+func (st *SessionStore) Clear() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := len(st.sessions)
+	st.sessions = nil
+	return n
+}
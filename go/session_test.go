@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionRepetitionEscalatesBoredom(t *testing.T) {
+	pg := newTestPG()
+	var store SessionStore
+
+	sess := store.Get("grudge")
+	var d float32
+	for i := 0; i < 4; i++ {
+		d, _ = pg.computeSessionDissonance("you are a duck", sess)
+	}
+	if sess.boredom < 2 {
+		t.Errorf("session boredom = %d after 4 repeats, want >= 2", sess.boredom)
+	}
+	if d < 0.7 {
+		t.Errorf("bored dissonance = %.2f, want >= 0.7", d)
+	}
+
+	fresh := store.Get("newcomer")
+	d, _ = pg.computeSessionDissonance("you are a duck", fresh)
+	if fresh.boredom != 0 {
+		t.Errorf("fresh session boredom = %d, want 0", fresh.boredom)
+	}
+	if d < 0.5 {
+		t.Errorf("fresh session dissonance = %.2f, want >= 0.5", d)
+	}
+}
+
+func TestSessionRemembersBeyondLastTurn(t *testing.T) {
+	// Alternating phrases never repeat back-to-back, so the sessionless
+	// path stays calm while the session sees the repetition.
+	inputs := []string{"hello there", "nice weather", "hello there", "nice weather", "hello there"}
+
+	plain := newTestPG()
+	for _, in := range inputs {
+		plain.computeDissonance(in)
+	}
+	if plain.boredomCount != 0 {
+		t.Errorf("sessionless boredom = %d, want 0", plain.boredomCount)
+	}
+
+	pg := newTestPG()
+	sess := &Session{}
+	for _, in := range inputs {
+		pg.computeSessionDissonance(in, sess)
+	}
+	if sess.boredom < 2 {
+		t.Errorf("session boredom = %d, want >= 2", sess.boredom)
+	}
+	if pg.boredomCount != 0 || len(pg.recent) != 0 {
+		t.Error("session calls should not touch the generator's own conversation state")
+	}
+}
+
+func TestSessionHistoryRing(t *testing.T) {
+	s := &Session{}
+	for i := 0; i < sessionHistorySize+3; i++ {
+		s.remember(strings.Repeat("x", i+1))
+	}
+	h := s.History()
+	if len(h) != sessionHistorySize {
+		t.Fatalf("history len = %d, want %d", len(h), sessionHistorySize)
+	}
+	if len(h[0]) != 4 || len(h[len(h)-1]) != sessionHistorySize+3 {
+		t.Errorf("history should keep the newest entries, got first=%q last=%q", h[0], h[len(h)-1])
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := SessionStore{ttl: time.Minute, now: func() time.Time { return now }}
+
+	a := store.Get("a")
+	a.remember("hi")
+	now = now.Add(30 * time.Second)
+	if store.Get("a") != a {
+		t.Error("session should survive within ttl")
+	}
+
+	now = now.Add(2 * time.Minute)
+	store.Get("b")
+	if store.Len() != 1 {
+		t.Errorf("live sessions = %d, want 1 after expiry", store.Len())
+	}
+	if got := store.Get("a"); got == a || len(got.History()) != 0 {
+		t.Error("expired session should come back empty")
+	}
+}
+
+func TestRoastContextIncludesHistory(t *testing.T) {
+	ctx := roastContext("again", []string{"first", "second"}, "")
+	if !strings.Contains(ctx, `earlier: "first"`) || !strings.Contains(ctx, `earlier: "second"`) {
+		t.Errorf("roast context missing history:\n%s", ctx)
+	}
+	if !strings.HasSuffix(ctx, `User said: "again"
+Yent (cynical, mocking): `) {
+		t.Errorf("roast context should end with the current line:\n%s", ctx)
+	}
+}
+
+func TestSessionHistoryEndpoint(t *testing.T) {
+	srv := newTestServer()
+	srv.textOnly = true
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+
+	inputs := []string{"hi", "I HATE MONDAYS", "hi", "tell me about the sea and the moon"}
+	for _, in := range inputs {
+		body := `{"input":"` + in + `","session_id":"dash"}`
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(body)))
+		if w.Code != 200 {
+			t.Fatalf("react %q: status %d", in, w.Code)
+		}
+	}
+	// Another conversation must not show up
+	srv.handleReact(httptest.NewRecorder(), httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"x","session_id":"other"}`)))
+
+	w := httptest.NewRecorder()
+	srv.handleSessionHistory(w, httptest.NewRequest("GET", "/session/dash/history", nil))
+	var hist SessionHistoryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &hist); err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+	if hist.SessionID != "dash" || len(hist.Turns) != len(inputs) {
+		t.Fatalf("history %q has %d turns, want %d", hist.SessionID, len(hist.Turns), len(inputs))
+	}
+	for i, turn := range hist.Turns {
+		if turn.InputLen != len(inputs[i]) {
+			t.Errorf("turn %d input_len = %d, want %d (inputs out of order?)", i, turn.InputLen, len(inputs[i]))
+		}
+		if i > 0 && turn.Timestamp.Before(hist.Turns[i-1].Timestamp) {
+			t.Errorf("turn %d is older than turn %d", i, i-1)
+		}
+		if turn.Temperature <= 0 || turn.Dissonance < 0 || turn.Dissonance > 1 {
+			t.Errorf("turn %d = %+v, want a temperature and dissonance in [0, 1]", i, turn)
+		}
+	}
+	if hist.Turns[1].Arousal <= hist.Turns[0].Arousal {
+		t.Errorf("shouting arousal %.2f not above greeting %.2f", hist.Turns[1].Arousal, hist.Turns[0].Arousal)
+	}
+
+	for _, path := range []string{"/session/nobody/history", "/session/dash", "/session//history"} {
+		w := httptest.NewRecorder()
+		srv.handleSessionHistory(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 404 {
+			t.Errorf("%s: status %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestSessionTurnsBounded(t *testing.T) {
+	sess := &Session{}
+	for i := 0; i < sessionTurnsSize+5; i++ {
+		sess.recordTurn(SessionTurn{InputLen: i})
+	}
+	turns := sess.Turns()
+	if len(turns) != sessionTurnsSize || turns[0].InputLen != 5 || turns[len(turns)-1].InputLen != sessionTurnsSize+4 {
+		t.Errorf("kept %d turns from %d to %d, want the last %d", len(turns), turns[0].InputLen, turns[len(turns)-1].InputLen, sessionTurnsSize)
+	}
+}
+
+func TestSessionHistoryNoveltyIsTheSessions(t *testing.T) {
+	srv := newTestServer()
+	srv.textOnly = true
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+
+	// Novelty is what the turn measured before its words joined the cloud:
+	// a word seen once has decayed back under the threshold, a word seen
+	// twice hasn't. Artist A draws every turn so one cloud sees them all.
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		srv.handleReact(w, httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"you are a duck","session_id":"echo","artist":"A"}`)))
+		if w.Code != 200 {
+			t.Fatalf("react %d: status %d", i, w.Code)
+		}
+	}
+
+	turns := srv.sessions.Get("echo").Turns()
+	if len(turns) != 3 {
+		t.Fatalf("%d turns, want 3", len(turns))
+	}
+	for i, want := range []float64{1, 1, 0} {
+		if turns[i].Novelty != want {
+			t.Errorf("turn %d novelty = %.2f, want %.0f", i, turns[i].Novelty, want)
+		}
+	}
+}
@@ -10,23 +10,35 @@ package main
 
 import (
 	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
 	"math/rand"
 	"os"
 	"strings"
 	"time"
+
+	"golang.org/x/image/font/basicfont"
 )
 
 // ASCII character sets — from lightest to darkest
-var sketchChars = []byte(" .'`^\",:;Il!i><~+_-?][}{1)(|/tfjrxnuvczXYUJCLQ0OZmwqpdbkhao*#MW&8%B@$")
+var sketchChars = []rune(" .'`^\",:;Il!i><~+_-?][}{1)(|/tfjrxnuvczXYUJCLQ0OZmwqpdbkhao*#MW&8%B@$")
+
+// sketchOut receives the terminal animations (tests swap it)
+var sketchOut io.Writer = os.Stderr
 
 // SketchConfig controls the sketch animation
 type SketchConfig struct {
-	Width       int           // sketch width in chars
-	Height      int           // sketch height in chars
-	NumDrafts   int           // how many "attempts" before final
-	DraftDelay  time.Duration // how long each draft stays visible
-	EraseDelay  time.Duration // pause between erase and next draft
-	UseComments bool          // commentator comments on each draft
+	Width       int            // sketch width in chars
+	Height      int            // sketch height in chars
+	NumDrafts   int            // how many "attempts" before final
+	DraftDelay  time.Duration  // how long each draft stays visible
+	EraseDelay  time.Duration  // pause between erase and next draft
+	UseComments bool           // commentator comments on each draft
+	CharRamp    []rune         // glyph ramp, lightest to darkest (empty = sketchChars)
+	Braille     bool           // render drafts as 2x4 Braille dots (4x the resolution)
+	Pulse       *PulseSnapshot // input mood the drafts follow (nil = neutral)
 }
 
 // DefaultSketchConfig returns sensible defaults
@@ -38,10 +50,11 @@ func DefaultSketchConfig() SketchConfig {
 		DraftDelay:  800 * time.Millisecond,
 		EraseDelay:  300 * time.Millisecond,
 		UseComments: true,
+		CharRamp:    sketchChars,
 	}
 }
 
-// SketchAnimation runs the "creative process" animation to stderr
+// SketchAnimation runs the "creative process" animation to sketchOut
 func SketchAnimation(cfg SketchConfig, prompt string, rng *rand.Rand) {
 	if rng == nil {
 		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -73,22 +86,23 @@ func SketchAnimation(cfg SketchConfig, prompt string, rng *rand.Rand) {
 	words := strings.Fields(strings.ToLower(prompt))
 
 	for draft := 0; draft < cfg.NumDrafts; draft++ {
+		stage := cfg.stage(draft)
+
 		// Comment on previous attempt
-		if cfg.UseComments && draft < len(comments) {
-			comment := comments[draft][rng.Intn(len(comments[draft]))]
-			fmt.Fprintf(os.Stderr, "\033[2m%s\033[0m\n", comment) // dim text
+		if cfg.UseComments && stage < len(comments) {
+			comment := comments[stage][rng.Intn(len(comments[stage]))]
+			fmt.Fprintf(sketchOut, "\033[2m%s\033[0m\n", comment) // dim text
 			time.Sleep(200 * time.Millisecond)
 		}
 
 		// Draw the box
-		fmt.Fprintf(os.Stderr, "\u250c%s\u2510\n", strings.Repeat("\u2500", cfg.Width))
+		fmt.Fprintf(sketchOut, "\u250c%s\u2510\n", strings.Repeat("\u2500", cfg.Width))
 
 		// Generate sketch content
-		for y := 0; y < cfg.Height; y++ {
-			fmt.Fprintf(os.Stderr, "\u2502")
-			line := generateSketchLine(cfg.Width, draft, y, cfg.Height, words, rng)
-			fmt.Fprintf(os.Stderr, "%s", line)
-			fmt.Fprintf(os.Stderr, "\u2502\n")
+		for _, line := range RenderSketchFrame(cfg, stage, words, rng) {
+			fmt.Fprintf(sketchOut, "\u2502")
+			fmt.Fprintf(sketchOut, "%s", line)
+			fmt.Fprintf(sketchOut, "\u2502\n")
 
 			// Progressive reveal effect: slight delay per line
 			if draft == cfg.NumDrafts-1 {
@@ -96,7 +110,7 @@ func SketchAnimation(cfg SketchConfig, prompt string, rng *rand.Rand) {
 			}
 		}
 
-		fmt.Fprintf(os.Stderr, "\u2514%s\u2518\n", strings.Repeat("\u2500", cfg.Width))
+		fmt.Fprintf(sketchOut, "\u2514%s\u2518\n", strings.Repeat("\u2500", cfg.Width))
 
 		// Hold the draft
 		time.Sleep(cfg.DraftDelay)
@@ -106,23 +120,204 @@ func SketchAnimation(cfg SketchConfig, prompt string, rng *rand.Rand) {
 			// Move cursor up and clear lines (box + content + comment)
 			lines := cfg.Height + 3 // top border + content + bottom border + comment
 			for i := 0; i < lines; i++ {
-				fmt.Fprintf(os.Stderr, "\033[A\033[2K") // up + clear
+				fmt.Fprintf(sketchOut, "\033[A\033[2K") // up + clear
 			}
 			time.Sleep(cfg.EraseDelay)
 		}
 	}
 }
 
-// generateSketchLine creates one line of ASCII sketch
-func generateSketchLine(width, draft, y, height int, words []string, rng *rand.Rand) string {
-	buf := make([]byte, width)
+// sketchStages is how many kinds of draft generateSketchLine draws, from
+// first scribble to finished sketch
+const sketchStages = 3
+
+// stage is the generateSketchLine draft kind of the draft-th of
+// cfg.NumDrafts drafts. Fewer drafts skip the early stages, so a single
+// draft is the finished one.
+func (cfg SketchConfig) stage(draft int) int {
+	return max(0, min(draft+sketchStages-cfg.NumDrafts, sketchStages-1))
+}
+
+// sketchConfig is DefaultSketchConfig in input's mood: its pulse shapes
+// the drafts and its dissonance sets how many there are. Peeks, so the
+// memory is untouched.
+func (pg *PromptGenerator) sketchConfig(input string) SketchConfig {
+	cfg := DefaultSketchConfig()
+	d, pulse, _ := pg.peekDissonance(input)
+	cfg.Pulse = &pulse
+	cfg.NumDrafts = draftsForDissonance(d, cfg)
+	return cfg
+}
+
+// draftsForDissonance is how many drafts Yent struggles through for an
+// input of dissonance d: one quick sketch when it's indifferent (d near 0),
+// all cfg.NumDrafts when the input is strange (d near 1)
+func draftsForDissonance(d float32, cfg SketchConfig) int {
+	if cfg.NumDrafts <= 1 {
+		return 1
+	}
+	return 1 + int(clampUnit(d)*float32(cfg.NumDrafts-1)+0.5)
+}
+
+// RenderSketchFrame generates all lines of one draft (cfg.Height lines of cfg.Width glyphs)
+func RenderSketchFrame(cfg SketchConfig, draft int, words []string, rng *rand.Rand) []string {
+	if cfg.Braille {
+		return sketchBrailleFrame(cfg, draft, words, rng)
+	}
+	lines := make([]string, cfg.Height)
+	for y := 0; y < cfg.Height; y++ {
+		lines[y] = generateSketchLine(cfg.Width, draft, y, cfg.Height, cfg.CharRamp, words, cfg.Pulse, rng)
+	}
+	return lines
+}
+
+// Sketch raster cell size (basicfont 7x13) and colors
+const (
+	sketchCharW = 7
+	sketchCharH = 13
+)
+
+var (
+	sketchBG   = color.RGBA{8, 8, 12, 255}
+	sketchInk  = color.RGBA{200, 200, 210, 255}
+	sketchWord = color.RGBA{150, 170, 255, 255} // bleeding prompt words
+)
+
+// SketchToImage rasterizes one draft into an image (cfg.Width*7 x cfg.Height*13),
+// so drafts can be served as PNGs instead of terminal ANSI.
+func SketchToImage(cfg SketchConfig, draft int, words []string, rng *rand.Rand) *image.RGBA {
+	lines := RenderSketchFrame(cfg, draft, words, rng)
+
+	ramp := cfg.CharRamp
+	if len(ramp) == 0 {
+		ramp = sketchChars
+	}
+	inRamp := make(map[rune]bool, len(ramp))
+	for _, r := range ramp {
+		inRamp[r] = true
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, cfg.Width*sketchCharW, cfg.Height*sketchCharH))
+	draw.Draw(img, img.Bounds(), image.NewUniform(sketchBG), image.Point{}, draw.Src)
+
+	for y, line := range lines {
+		for x, ch := range []rune(line) {
+			if ch == ' ' || ch == 0x2800 || x >= cfg.Width {
+				continue
+			}
+			col := sketchInk
+			if !cfg.Braille && !inRamp[ch] {
+				col = sketchWord
+			}
+			drawGlyph(img, basicfont.Face7x13, ch, x*sketchCharW, y*sketchCharH, sketchCharW, sketchCharH, col)
+		}
+	}
+	return img
+}
+
+// sketchBrailleFrame draws the draft at 2x4 sub-cell resolution and packs it into Braille
+func sketchBrailleFrame(cfg SketchConfig, draft int, words []string, rng *rand.Rand) []string {
+	ramp := cfg.CharRamp
+	if len(ramp) == 0 {
+		ramp = sketchChars
+	}
+	level := make(map[rune]float32, len(ramp))
+	for i, r := range ramp {
+		level[r] = float32(i) / float32(max(1, len(ramp)-1))
+	}
+
+	w, h := cfg.Width*2, cfg.Height*4
+	gray := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		line := generateSketchLine(w, draft, y, h, ramp, words, cfg.Pulse, rng)
+		for x, r := range []rune(line) {
+			v, ok := level[r]
+			if !ok {
+				v = 1 // bleeding words are solid ink
+			}
+			gray[y*w+x] = v
+		}
+	}
+	return RenderBraille(gray, w, h, 0.15)
+}
+
+// RenderBraille maps a luminance buffer to Braille glyphs (U+2800–U+28FF).
+// Each glyph covers a 2x4 pixel block; pixels brighter than threshold become dots.
+// Dimensions that aren't multiples of 2x4 are padded with empty pixels.
+func RenderBraille(gray []float32, w, h int, threshold float32) []string {
+	// Dot bit for (dx, dy) inside the 2x4 cell
+	dotBits := [4][2]rune{
+		{0x01, 0x08},
+		{0x02, 0x10},
+		{0x04, 0x20},
+		{0x40, 0x80},
+	}
+
+	cols := (w + 1) / 2
+	rows := (h + 3) / 4
+	lines := make([]string, rows)
+	for row := 0; row < rows; row++ {
+		buf := make([]rune, cols)
+		for col := 0; col < cols; col++ {
+			glyph := rune(0x2800)
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					x, y := col*2+dx, row*4+dy
+					if x < w && y < h && gray[y*w+x] > threshold {
+						glyph |= dotBits[dy][dx]
+					}
+				}
+			}
+			buf[col] = glyph
+		}
+		lines[row] = string(buf)
+	}
+	return lines
+}
+
+// sketchStyle is how the input's pulse bends the drafts
+type sketchStyle struct {
+	density float32 // scales the chance of ink in every cell
+	jitter  int     // ramp-index noise on the shapes: 0 is a smooth gradient
+	spread  float32 // scales the shape radius and the stray glyphs
+}
+
+// sketchStyleOf maps a pulse to a sketch style. Arousal makes the drafts
+// dense and jagged, calm makes them sparse and smooth; entropy scatters
+// them. A nil pulse (or arousal = entropy = 0.5) is the neutral style.
+func sketchStyleOf(pulse *PulseSnapshot) sketchStyle {
+	arousal, entropy := float32(0.5), float32(0.5)
+	if pulse != nil {
+		arousal, entropy = clampUnit(pulse.Arousal), clampUnit(pulse.Entropy)
+	}
+	return sketchStyle{
+		density: 0.5 + arousal,
+		jitter:  int(4*arousal + 0.5),
+		spread:  0.5 + entropy,
+	}
+}
+
+// generateSketchLine creates one line of ASCII sketch.
+// ramp is the glyph set from lightest to darkest; empty falls back to sketchChars.
+// pulse (may be nil) shapes the line, see sketchStyleOf.
+func generateSketchLine(width, draft, y, height int, ramp []rune, words []string, pulse *PulseSnapshot, rng *rand.Rand) string {
+	if len(ramp) == 0 {
+		ramp = sketchChars
+	}
+	// Light/mid portions of the ramp (at least one glyph each)
+	light := max(1, len(ramp)/3)
+	mid := max(1, len(ramp)/2)
+	style := sketchStyleOf(pulse)
+	stray := style.density * style.spread // scale on the background noise
+
+	buf := make([]rune, width)
 
 	switch draft {
 	case 0:
 		// First draft: sparse, mostly noise
 		for x := 0; x < width; x++ {
-			if rng.Float32() < 0.15 {
-				buf[x] = sketchChars[rng.Intn(len(sketchChars)/3)] // light chars only
+			if rng.Float32() < 0.15*stray {
+				buf[x] = ramp[rng.Intn(light)] // light chars only
 			} else {
 				buf[x] = ' '
 			}
@@ -136,14 +331,17 @@ func generateSketchLine(width, draft, y, height int, words []string, rng *rand.R
 			dy := float32(y-cy) / float32(height)
 			dist := dx*dx + dy*dy
 
-			if dist < 0.15 && rng.Float32() < 0.6 {
-				idx := int(dist*float32(len(sketchChars))) + rng.Intn(10)
-				if idx >= len(sketchChars) {
-					idx = len(sketchChars) - 1
+			if dist < 0.15*style.spread && rng.Float32() < 0.6*style.density {
+				idx := int(dist * float32(len(ramp)))
+				if style.jitter > 0 {
+					idx += rng.Intn(5 * style.jitter)
+				}
+				if idx >= len(ramp) {
+					idx = len(ramp) - 1
 				}
-				buf[x] = sketchChars[idx]
-			} else if rng.Float32() < 0.08 {
-				buf[x] = sketchChars[rng.Intn(len(sketchChars)/2)]
+				buf[x] = ramp[idx]
+			} else if rng.Float32() < 0.08*stray {
+				buf[x] = ramp[rng.Intn(mid)]
 			} else {
 				buf[x] = ' '
 			}
@@ -151,12 +349,12 @@ func generateSketchLine(width, draft, y, height int, words []string, rng *rand.R
 
 		// Bleed some prompt words through
 		if len(words) > 0 && y == height/2 {
-			word := words[rng.Intn(len(words))]
-			pos := rng.Intn(width - len(word) - 2)
-			if pos >= 0 && pos+len(word) < width {
+			word := []rune(words[rng.Intn(len(words))])
+			if room := width - len(word) - 2; room > 0 { // too long for the line: skip it
+				pos := rng.Intn(room)
 				for i, ch := range word {
 					if rng.Float32() < 0.7 { // partial reveal
-						buf[pos+i] = byte(ch)
+						buf[pos+i] = ch
 					}
 				}
 			}
@@ -170,19 +368,20 @@ func generateSketchLine(width, draft, y, height int, words []string, rng *rand.R
 			dy := float32(y-cy) / float32(height)
 			dist := dx*dx + dy*dy
 
-			if dist < 0.2 {
-				intensity := 1.0 - dist/0.2
-				idx := int(intensity * float32(len(sketchChars)-1))
-				idx += rng.Intn(5) - 2 // jitter
+			radius := 0.2 * style.spread
+			if dist < radius && (style.density >= 1 || rng.Float32() < style.density) {
+				intensity := 1.0 - dist/radius
+				idx := int(intensity * float32(len(ramp)-1))
+				idx += rng.Intn(2*style.jitter+1) - style.jitter // jitter
 				if idx < 0 {
 					idx = 0
 				}
-				if idx >= len(sketchChars) {
-					idx = len(sketchChars) - 1
+				if idx >= len(ramp) {
+					idx = len(ramp) - 1
 				}
-				buf[x] = sketchChars[idx]
-			} else if rng.Float32() < 0.12 {
-				buf[x] = sketchChars[rng.Intn(len(sketchChars)/3)]
+				buf[x] = ramp[idx]
+			} else if rng.Float32() < 0.12*stray {
+				buf[x] = ramp[rng.Intn(light)]
 			} else {
 				buf[x] = ' '
 			}
@@ -190,11 +389,11 @@ func generateSketchLine(width, draft, y, height int, words []string, rng *rand.R
 
 		// More words bleeding through
 		if len(words) > 0 && (y == height/3 || y == height*2/3) {
-			word := words[rng.Intn(len(words))]
-			pos := rng.Intn(width - len(word) - 2)
-			if pos >= 0 && pos+len(word) < width {
+			word := []rune(words[rng.Intn(len(words))])
+			if room := width - len(word) - 2; room > 0 {
+				pos := rng.Intn(room)
 				for i, ch := range word {
-					buf[pos+i] = byte(ch)
+					buf[pos+i] = ch
 				}
 			}
 		}
@@ -203,8 +402,27 @@ func generateSketchLine(width, draft, y, height int, words []string, rng *rand.R
 	return string(buf)
 }
 
-// SketchTransition shows a brief "thinking" animation between sketch and final image
-func SketchTransition(rng *rand.Rand) {
+// TransitionConfig controls the "rendering..." animation
+type TransitionConfig struct {
+	Frames   int           // frames to show at most (0 = until done)
+	Interval time.Duration // how long each frame stays up
+}
+
+// DefaultTransitionConfig is the classic 8 frames, 2 seconds
+func DefaultTransitionConfig() TransitionConfig {
+	return TransitionConfig{Frames: 8, Interval: 250 * time.Millisecond}
+}
+
+// SketchTransition shows a brief "thinking" animation between sketch and
+// final image. It stops after cfg.Frames frames or as soon as done is
+// closed, whichever comes first; with neither it doesn't run at all.
+func SketchTransition(cfg TransitionConfig, done <-chan struct{}) {
+	if cfg.Frames <= 0 && done == nil {
+		return
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultTransitionConfig().Interval
+	}
 	frames := []string{
 		"[yent] rendering",
 		"[yent] rendering.",
@@ -212,9 +430,16 @@ func SketchTransition(rng *rand.Rand) {
 		"[yent] rendering...",
 	}
 
-	for i := 0; i < 8; i++ {
-		fmt.Fprintf(os.Stderr, "\r\033[2m%s\033[0m", frames[i%len(frames)])
-		time.Sleep(250 * time.Millisecond)
+	tick := time.NewTicker(cfg.Interval)
+	defer tick.Stop()
+	defer fmt.Fprintf(sketchOut, "\r\033[2K") // clear line
+
+	for i := 0; cfg.Frames <= 0 || i < cfg.Frames; i++ {
+		fmt.Fprintf(sketchOut, "\r\033[2m%s\033[0m", frames[i%len(frames)])
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+		}
 	}
-	fmt.Fprintf(os.Stderr, "\r\033[2K") // clear line
 }
@@ -0,0 +1,70 @@
+package main
+
+// stem.go — light English suffix stripping for trigram extraction
+//
+// A cut-down Porter step 1 plus a few derivational endings: enough that
+// "running"/"run" and "draws"/"drawing" share trigrams, without a
+// dictionary. Words that aren't plain ASCII (Russian input) pass through.
+
+import "strings"
+
+// stemWord strips inflectional suffixes from a lowercase English word
+func stemWord(w string) string {
+	if len(w) <= 3 || !isASCII(w) {
+		return w
+	}
+
+	// Plurals
+	switch {
+	case strings.HasSuffix(w, "sses"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(w, "ies"):
+		w = w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "ss"), strings.HasSuffix(w, "us"):
+		// glass, virus
+	case strings.HasSuffix(w, "s"):
+		w = w[:len(w)-1]
+	}
+
+	// Past tense and progressive
+	switch {
+	case strings.HasSuffix(w, "eed"):
+		if len(w) > 4 { // agreed → agree, but not need → nee
+			w = w[:len(w)-1]
+		}
+	case strings.HasSuffix(w, "ed") && hasVowel(w[:len(w)-2]):
+		w = undouble(w[:len(w)-2])
+	case strings.HasSuffix(w, "ing") && hasVowel(w[:len(w)-3]) && len(w) > 5:
+		w = undouble(w[:len(w)-3])
+	}
+
+	// A few derivational endings, only when a real stem is left
+	for _, suf := range []string{"ness", "ment", "ful", "ly"} {
+		if strings.HasSuffix(w, suf) && len(w)-len(suf) >= 3 {
+			return w[:len(w)-len(suf)]
+		}
+	}
+	return w
+}
+
+// undouble turns "runn" into "run" (but keeps "fall", "kiss", "buzz")
+func undouble(w string) string {
+	n := len(w)
+	if n >= 2 && w[n-1] == w[n-2] && !isVowel(w[n-1]) && !strings.ContainsRune("lsz", rune(w[n-1])) {
+		return w[:n-1]
+	}
+	return w
+}
+
+func hasVowel(w string) bool {
+	for i := 0; i < len(w); i++ {
+		if isVowel(w[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiouy", c) >= 0
+}
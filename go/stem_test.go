@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestStemWord(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"running", "run"},
+		{"drawing", "draw"},
+		{"draws", "draw"},
+		{"hopped", "hop"},
+		{"ponies", "pony"},
+		{"glasses", "glass"},
+		{"agreed", "agree"},
+		{"need", "need"},
+		{"falling", "fall"},
+		{"sadness", "sad"},
+		{"slowly", "slow"},
+		{"sing", "sing"},
+		{"cat", "cat"},
+		{"горю", "горю"},
+	}
+	for _, tt := range tests {
+		if got := stemWord(tt.in); got != tt.want {
+			t.Errorf("stemWord(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
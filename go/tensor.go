@@ -135,30 +135,32 @@ N := input.Shape[0]
 		}
 	} else {
 		for n := 0; n < N; n++ {
-			for co := 0; co < Cout; co++ {
-				for oh := 0; oh < Hout; oh++ {
-					for ow := 0; ow < Wout; ow++ {
-						sum := float32(0)
-						for ci := 0; ci < Cin; ci++ {
-							for kh := 0; kh < kH; kh++ {
-								for kw := 0; kw < kW; kw++ {
-									ih := oh*stride - padding + kh
-									iw := ow*stride - padding + kw
-									if ih >= 0 && ih < Hin && iw >= 0 && iw < Win {
-										inIdx := ((n*Cin+ci)*Hin+ih)*Win + iw
-										wIdx := ((co*Cin+ci)*kH+kh)*kW + kw
-										sum += input.Data[inIdx] * weight.Data[wIdx]
+			parallelRows(0, Cout, func(coLo, coHi int) {
+				for co := coLo; co < coHi; co++ {
+					for oh := 0; oh < Hout; oh++ {
+						for ow := 0; ow < Wout; ow++ {
+							sum := float32(0)
+							for ci := 0; ci < Cin; ci++ {
+								for kh := 0; kh < kH; kh++ {
+									for kw := 0; kw < kW; kw++ {
+										ih := oh*stride - padding + kh
+										iw := ow*stride - padding + kw
+										if ih >= 0 && ih < Hin && iw >= 0 && iw < Win {
+											inIdx := ((n*Cin+ci)*Hin+ih)*Win + iw
+											wIdx := ((co*Cin+ci)*kH+kh)*kW + kw
+											sum += input.Data[inIdx] * weight.Data[wIdx]
+										}
 									}
 								}
 							}
+							if bias != nil {
+								sum += bias.Data[co]
+							}
+							out.Data[((n*Cout+co)*Hout+oh)*Wout+ow] = sum
 						}
-						if bias != nil {
-							sum += bias.Data[co]
-						}
-						out.Data[((n*Cout+co)*Hout+oh)*Wout+ow] = sum
 					}
 				}
-			}
+			})
 		}
 	}
 	return out
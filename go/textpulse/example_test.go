@@ -0,0 +1,22 @@
+package textpulse_test
+
+import (
+	"fmt"
+
+	"yentyo/textpulse"
+)
+
+func Example() {
+	a := textpulse.ExtractNGrams("the sea at night")
+	b := textpulse.ExtractNGrams("the sea at dawn")
+
+	jaccard := textpulse.JaccardSimilarity(textpulse.NGramSet(a), textpulse.NGramSet(b))
+	cosine := textpulse.CosineSimilarity(a, b)
+	fmt.Printf("jaccard=%.2f cosine=%.2f dissonance=%.2f\n", jaccard, cosine, 1-jaccard)
+
+	words := textpulse.SplitWords("no no no 😭")
+	fmt.Printf("words=%q entropy=%.2f\n", words, textpulse.WordEntropy(words))
+	// Output:
+	// jaccard=0.50 cosine=0.67 dissonance=0.50
+	// words=["no" "no" "no" "😭"] entropy=0.50
+}
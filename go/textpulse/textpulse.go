@@ -0,0 +1,126 @@
+// Package textpulse is the text-analysis core of the HAiKU dissonance
+// system: word n-grams, Jaccard and TF cosine similarity, and the entropy
+// measures behind the pulse. It has no model behind it and no state, so
+// other tools can measure how strange one text is to another.
+//
+// Adapted from github.com/ariannamethod/harmonix/haiku
+package textpulse
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ExtractNGrams splits text into lowercase words (see SplitWords) and
+// counts its word trigrams, bigrams and unigrams
+func ExtractNGrams(text string) map[string]float32 {
+	return NGramCounts(SplitWords(strings.ToLower(text)))
+}
+
+// NGramCounts builds word trigrams, bigrams and unigrams from tokens, with
+// term frequencies
+func NGramCounts(words []string) map[string]float32 {
+	grams := make(map[string]float32)
+
+	// Word-level trigrams (sliding window of 3 words)
+	for i := 0; i+2 < len(words); i++ {
+		tri := words[i] + " " + words[i+1] + " " + words[i+2]
+		grams[tri]++
+	}
+	// Also add bigrams for short inputs
+	for i := 0; i+1 < len(words); i++ {
+		bi := words[i] + " " + words[i+1]
+		grams[bi]++
+	}
+	// Single words as fallback
+	for _, w := range words {
+		grams[w]++
+	}
+
+	return grams
+}
+
+// NGramSet drops the counts from an NGramCounts result
+func NGramSet(counts map[string]float32) map[string]bool {
+	set := make(map[string]bool, len(counts))
+	for k := range counts {
+		set[k] = true
+	}
+	return set
+}
+
+// JaccardSimilarity computes Jaccard similarity between two n-gram sets
+func JaccardSimilarity(a, b map[string]bool) float32 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for k := range a {
+		if b[k] {
+			intersection++
+		}
+	}
+	union := len(a) + len(b) - intersection
+	if union == 0 {
+		return 0
+	}
+	return float32(intersection) / float32(union)
+}
+
+// CosineSimilarity computes TF-weighted cosine similarity between two
+// n-gram count maps. Unlike Jaccard, repeated terms pull the vectors
+// together, so "the the the cat" reads as close to "the cat".
+func CosineSimilarity(a, b map[string]float32) float32 {
+	var dot, na, nb float64
+	for k, va := range a {
+		na += float64(va) * float64(va)
+		if vb, ok := b[k]; ok {
+			dot += float64(va) * float64(vb)
+		}
+	}
+	for _, vb := range b {
+		nb += float64(vb) * float64(vb)
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
+
+// WordEntropy is word diversity: the share of distinct words among words.
+// "the the the" → 1/3, all distinct → 1, no words → 0.
+func WordEntropy(words []string) float32 {
+	if len(words) == 0 {
+		return 0
+	}
+	unique := make(map[string]bool)
+	for _, w := range words {
+		unique[w] = true
+	}
+	return float32(len(unique)) / float32(len(words))
+}
+
+// CharEntropy is the Shannon entropy of the non-space characters of s,
+// normalized to [0, 1] by its maximum for that length: "aaaaaa" → 0,
+// "abcdef" → 1. Fewer than two characters count as 1.
+func CharEntropy(s string) float32 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		counts[r]++
+		n++
+	}
+	if n < 2 {
+		return 1
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return float32(h / math.Log2(float64(n)))
+}
@@ -0,0 +1,110 @@
+package textpulse
+
+import (
+	"math"
+	"testing"
+)
+
+// --- N-gram extraction ---
+
+func TestExtractNGrams(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int // minimum expected trigrams
+	}{
+		{"hello world", 2},         // 1 bigram + 2 words
+		{"the meaning of life", 6}, // 2 trigrams + 3 bigrams + 4 words (minus dups)
+		{"hi", 1},                  // just the word
+		{"a b c d e", 8},           // lots of trigrams+bigrams+words
+		{"", 0},                    // empty
+		{"ненавижу всё это дерьмо", 4}, // russian
+	}
+
+	for _, tt := range tests {
+		trigrams := NGramSet(ExtractNGrams(tt.input))
+		if len(trigrams) < tt.want {
+			t.Errorf("ExtractNGrams(%q) = %d n-grams, want >= %d", tt.input, len(trigrams), tt.want)
+		}
+	}
+}
+
+func TestExtractNGramsIncludesWords(t *testing.T) {
+	trigrams := NGramSet(ExtractNGrams("hello world"))
+	if !trigrams["hello"] {
+		t.Error("expected 'hello' in n-grams")
+	}
+	if !trigrams["world"] {
+		t.Error("expected 'world' in n-grams")
+	}
+	if !trigrams["hello world"] {
+		t.Error("expected bigram 'hello world' in n-grams")
+	}
+}
+
+// --- Jaccard similarity ---
+
+func TestJaccardSimilarity(t *testing.T) {
+	a := map[string]bool{"a": true, "b": true, "c": true}
+	b := map[string]bool{"b": true, "c": true, "d": true}
+
+	sim := JaccardSimilarity(a, b)
+	// intersection = {b, c} = 2, union = {a, b, c, d} = 4 → 0.5
+	if math.Abs(float64(sim)-0.5) > 0.01 {
+		t.Errorf("JaccardSimilarity = %.3f, want 0.5", sim)
+	}
+
+	// Identical sets
+	sim = JaccardSimilarity(a, a)
+	if math.Abs(float64(sim)-1.0) > 0.01 {
+		t.Errorf("JaccardSimilarity(a, a) = %.3f, want 1.0", sim)
+	}
+
+	// Disjoint sets
+	c := map[string]bool{"x": true, "y": true}
+	sim = JaccardSimilarity(a, c)
+	if sim != 0 {
+		t.Errorf("JaccardSimilarity(disjoint) = %.3f, want 0.0", sim)
+	}
+
+	// Empty sets
+	sim = JaccardSimilarity(map[string]bool{}, map[string]bool{})
+	if sim != 0 {
+		t.Errorf("JaccardSimilarity(empty, empty) = %.3f, want 0.0", sim)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	a := map[string]float32{"x": 1, "y": 2}
+	if sim := CosineSimilarity(a, a); math.Abs(float64(sim)-1) > 1e-5 {
+		t.Errorf("CosineSimilarity(a, a) = %.3f, want 1.0", sim)
+	}
+	if sim := CosineSimilarity(a, map[string]float32{"z": 3}); sim != 0 {
+		t.Errorf("CosineSimilarity(disjoint) = %.3f, want 0.0", sim)
+	}
+	if sim := CosineSimilarity(map[string]float32{}, a); sim != 0 {
+		t.Errorf("CosineSimilarity(empty, a) = %.3f, want 0.0", sim)
+	}
+}
+
+// --- Entropy ---
+
+func TestWordEntropy(t *testing.T) {
+	if got := WordEntropy([]string{"the", "the", "the", "cat"}); got != 0.5 {
+		t.Errorf("WordEntropy(the the the cat) = %.3f, want 0.5", got)
+	}
+	if got := WordEntropy([]string{"a", "b"}); got != 1 {
+		t.Errorf("WordEntropy(a b) = %.3f, want 1", got)
+	}
+	if got := WordEntropy(nil); got != 0 {
+		t.Errorf("WordEntropy(nil) = %.3f, want 0", got)
+	}
+}
+
+func TestCharEntropy(t *testing.T) {
+	if lo, hi := CharEntropy("aaaaaa"), CharEntropy("abcdef"); lo >= hi {
+		t.Errorf("CharEntropy(aaaaaa) = %.3f, want below CharEntropy(abcdef) = %.3f", lo, hi)
+	}
+	if got := CharEntropy("ab ab"); got != 0.5 {
+		t.Errorf("CharEntropy(ab ab) = %.3f, want 0.5 (spaces ignored)", got)
+	}
+}
@@ -0,0 +1,56 @@
+package textpulse
+
+// words.go — emoji as words
+//
+// strings.Fields leaves "😭😭😭" as one opaque token and "love😍" glued to
+// its word, so nothing downstream ever sees the emoji. SplitWords makes
+// every emoji a word of its own.
+
+import "strings"
+
+// IsEmoji reports whether r is a pictographic emoji
+func IsEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F300 && r <= 0x1FAFF: // pictographs, emoticons, transport, supplemental
+		return !IsEmojiModifier(r)
+	case r >= 0x2600 && r <= 0x27BF: // misc symbols, dingbats
+		return true
+	case r >= 0x1F1E6 && r <= 0x1F1FF: // regional indicators (flags)
+		return true
+	}
+	return false
+}
+
+// IsEmojiModifier reports whether r only modifies the emoji before it:
+// skin tones, the variation selector and the zero-width joiner
+func IsEmojiModifier(r rune) bool {
+	return (r >= 0x1F3FB && r <= 0x1F3FF) || r == 0xFE0F || r == 0x200D
+}
+
+// SplitWords is strings.Fields with every emoji split out as its own word
+// and emoji modifiers dropped: "love😍😍 you" → [love 😍 😍 you]
+func SplitWords(text string) []string {
+	var words []string
+	for _, f := range strings.Fields(text) {
+		start := -1 // start of the current run of plain characters
+		for i, r := range f {
+			if !IsEmoji(r) && !IsEmojiModifier(r) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 {
+				words = append(words, f[start:i])
+				start = -1
+			}
+			if IsEmoji(r) {
+				words = append(words, string(r))
+			}
+		}
+		if start >= 0 {
+			words = append(words, f[start:])
+		}
+	}
+	return words
+}
@@ -0,0 +1,34 @@
+package textpulse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	for in, want := range map[string][]string{
+		"paint me a duck": {"paint", "me", "a", "duck"},
+		"😭😭😭":             {"😭", "😭", "😭"},
+		"love😍you 🔥":      {"love", "😍", "you", "🔥"},
+		"❤️ 👍🏽":           {"❤", "👍"}, // variation selector and skin tone dropped
+		"я люблю тебя":    {"я", "люблю", "тебя"},
+		"":                nil,
+	} {
+		if got := SplitWords(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("SplitWords(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIsEmoji(t *testing.T) {
+	for _, r := range "😭🔥❤🇺" {
+		if !IsEmoji(r) {
+			t.Errorf("IsEmoji(%q) = false", r)
+		}
+	}
+	for _, r := range "aя!\ufe0f\U0001F3FD" {
+		if IsEmoji(r) {
+			t.Errorf("IsEmoji(%q) = true", r)
+		}
+	}
+}
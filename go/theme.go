@@ -0,0 +1,66 @@
+package main
+
+// theme.go — the reaction's mood as colors
+//
+// The UI tints itself after every reaction. Rather than have the client
+// guess at a mood, the server sends a theme with each ReactResponse:
+// valence picks the hue (red for negative, azure for neutral, gold for
+// positive) and arousal the saturation, so a furious input gets a vivid
+// red accent and a calm happy one a soft pastel.
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Theme is a suggested color scheme for a reaction, as "#rrggbb"
+type Theme struct {
+	Background string `json:"background"`
+	Accent     string `json:"accent"`
+}
+
+// pulseToTheme maps a pulse's valence and arousal to a theme. The hue runs
+// from red (valence -1) back around through violet to azure (0) and on
+// to gold (+1); arousal raises the saturation and darkens the accent from
+// pastel to vivid. Deterministic: the same pulse always gives the same theme.
+func pulseToTheme(p PulseSnapshot) Theme {
+	valence := max(-1, min(1, p.Valence))
+	arousal := clampUnit(p.Arousal)
+
+	hue := math.Mod(360-150*float64(valence+1), 360)
+	sat := 0.25 + 0.7*float64(arousal)
+	return Theme{
+		Background: hexColor(hslToRGB(hue, 0.3*sat, 0.08+0.04*float64(arousal))),
+		Accent:     hexColor(hslToRGB(hue, sat, 0.80-0.30*float64(arousal))),
+	}
+}
+
+// hslToRGB converts hue (degrees), saturation and lightness ∈ [0, 1]
+func hslToRGB(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	hp := math.Mod(h, 360) / 60
+	x := c * (1 - math.Abs(math.Mod(hp, 2)-1))
+	var r, g, b float64
+	switch {
+	case hp < 1:
+		r, g = c, x
+	case hp < 2:
+		r, g = x, c
+	case hp < 3:
+		g, b = c, x
+	case hp < 4:
+		g, b = x, c
+	case hp < 5:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := l - c/2
+	return color.RGBA{clamp8(float32((r + m) * 255)), clamp8(float32((g + m) * 255)), clamp8(float32((b + m) * 255)), 255}
+}
+
+// hexColor formats c as "#rrggbb"
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
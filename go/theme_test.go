@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// parseHex reads "#rrggbb" into hue (degrees), saturation and lightness
+func parseHex(t *testing.T, s string) (h, sat, l float64) {
+	t.Helper()
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b); err != nil || len(s) != 7 {
+		t.Fatalf("%q is not #rrggbb", s)
+	}
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	hi, lo := math.Max(rf, math.Max(gf, bf)), math.Min(rf, math.Min(gf, bf))
+	l = (hi + lo) / 2
+	if hi == lo {
+		return 0, 0, l
+	}
+	d := hi - lo
+	sat = d / (1 - math.Abs(2*l-1))
+	switch hi {
+	case rf:
+		h = math.Mod((gf-bf)/d+6, 6)
+	case gf:
+		h = (bf-rf)/d + 2
+	default:
+		h = (rf-gf)/d + 4
+	}
+	return h * 60, sat, l
+}
+
+func TestPulseToTheme(t *testing.T) {
+	angry := pulseToTheme(PulseSnapshot{Arousal: 0.9, Valence: -0.9})
+	h, sat, _ := parseHex(t, angry.Accent)
+	if h > 30 && h < 330 {
+		t.Errorf("angry accent %s has hue %.0f°, want red-ish", angry.Accent, h)
+	}
+	if sat < 0.8 {
+		t.Errorf("angry accent %s has saturation %.2f, want high", angry.Accent, sat)
+	}
+
+	calm := pulseToTheme(PulseSnapshot{Arousal: 0.05, Valence: 0.8})
+	h, sat, l := parseHex(t, calm.Accent)
+	if sat > 0.4 || l < 0.7 {
+		t.Errorf("calm accent %s: saturation %.2f, lightness %.2f, want a soft pastel", calm.Accent, sat, l)
+	}
+	if h < 40 || h > 100 {
+		t.Errorf("calm positive accent %s has hue %.0f°, want warm", calm.Accent, h)
+	}
+
+	for _, theme := range []Theme{angry, calm} {
+		if _, _, l := parseHex(t, theme.Background); l > 0.2 {
+			t.Errorf("background %s is too light for a dark UI", theme.Background)
+		}
+	}
+	if again := pulseToTheme(PulseSnapshot{Arousal: 0.9, Valence: -0.9}); again != angry {
+		t.Errorf("pulseToTheme is not deterministic: %+v then %+v", angry, again)
+	}
+}
+
+func TestReactTheme(t *testing.T) {
+	srv := newTestServer()
+	srv.textOnly = true
+	srv.dy = seedDualYent(newParrotPG("zyx", 1), newParrotPG("qwv", 2), 1)
+
+	req := httptest.NewRequest("POST", "/react", strings.NewReader(`{"input":"I HATE THIS 😡😡"}`))
+	w := httptest.NewRecorder()
+	srv.handleReact(w, req)
+
+	var resp ReactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+	if resp.Theme == nil {
+		t.Fatal("response has no theme")
+	}
+	if h, _, _ := parseHex(t, resp.Theme.Accent); h > 30 && h < 330 {
+		t.Errorf("accent %s for an angry input has hue %.0f°, want red-ish", resp.Theme.Accent, h)
+	}
+}
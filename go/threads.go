@@ -0,0 +1,32 @@
+package main
+
+// threads.go — the --threads knob
+//
+// One number bounds a generation's CPU parallelism: Go's scheduler
+// (GOMAXPROCS), the goroutines the pure-Go image and tensor loops fan out
+// over (parallelRows), and ORT's intra-op pool. OpenBLAS sizes its own pool
+// once at load, from OPENBLAS_NUM_THREADS.
+
+import "runtime"
+
+// defaultORTThreads is ORT's intra-op pool without --threads (physical
+// cores on the i5 this was tuned on)
+const defaultORTThreads = 4
+
+// inferenceThreads is --threads; 0 keeps the defaults
+var inferenceThreads int
+
+// setThreads caps CPU parallelism at n threads
+func setThreads(n int) {
+	inferenceThreads = n
+	runtime.GOMAXPROCS(n)
+	postWorkers = n
+}
+
+// ortThreads is the intra-op thread count for ORT sessions
+func ortThreads() int {
+	if inferenceThreads > 0 {
+		return inferenceThreads
+	}
+	return defaultORTThreads
+}
@@ -1,8 +1,58 @@
 package main
 
-// ui.go — embedded HTML for yent.yo web interface
+// ui.go — embedded web interface for yent.yo
+//
+// Every file in uiFS is served at /<name> (ui.html at /) with a strong
+// ETag over its content, so browsers revalidate and get 304 until the
+// binary changes. New CSS/JS files only need adding to the embed pattern.
 
-import _ "embed"
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"time"
+)
 
 //go:embed ui.html
-var uiHTML string
+var uiFS embed.FS
+
+// uiAsset is one embedded file with its precomputed ETag
+type uiAsset struct {
+	data []byte
+	etag string
+}
+
+// uiAssets maps a file name in uiFS to its content
+var uiAssets = loadUIAssets(uiFS)
+
+func loadUIAssets(fsys fs.FS) map[string]uiAsset {
+	assets := make(map[string]uiAsset)
+	fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		assets[path] = uiAsset{data: data, etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+		return nil
+	})
+	return assets
+}
+
+// serveUIAsset writes the named asset, or 304 when If-None-Match matches
+func serveUIAsset(w http.ResponseWriter, r *http.Request, name string) bool {
+	a, ok := uiAssets[name]
+	if !ok {
+		return false
+	}
+	w.Header().Set("ETag", a.etag)
+	w.Header().Set("Cache-Control", "no-cache") // always revalidate; cheap with the ETag
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.data))
+	return true
+}
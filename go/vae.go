@@ -12,18 +12,9 @@ type VAEDecoder struct {
 	ConvInW, ConvInB               *Tensor // [512,4,3,3]
 
 	// Mid block: resnet0 → self-attention → resnet1
-	MidResnet0     VAEResNet
-	MidAttnNormW   *Tensor // GroupNorm [512]
-	MidAttnNormB   *Tensor
-	MidAttnQW      *Tensor // [512,512] with bias
-	MidAttnQB      *Tensor
-	MidAttnKW      *Tensor
-	MidAttnKB      *Tensor
-	MidAttnVW      *Tensor
-	MidAttnVB      *Tensor
-	MidAttnOutW    *Tensor
-	MidAttnOutB    *Tensor
-	MidResnet1     VAEResNet
+	MidResnet0 VAEResNet
+	MidAttn    VAEAttention
+	MidResnet1 VAEResNet
 
 	// Up blocks (4): 3 resnets each, first 3 have upsamplers
 	UpBlocks [4]VAEUpBlock
@@ -42,6 +33,15 @@ type VAEResNet struct {
 	ShortcutW, ShortcutB *Tensor // optional 1x1 for channel mismatch
 }
 
+// VAEAttention: GroupNorm → single-head self-attention (Q/K/V/out with bias)
+type VAEAttention struct {
+	NormW, NormB *Tensor // GroupNorm [512]
+	QW, QB       *Tensor // [512,512]
+	KW, KB       *Tensor
+	VW, VB       *Tensor
+	OutW, OutB   *Tensor
+}
+
 type VAEUpBlock struct {
 	Resnets      [3]VAEResNet
 	HasUpsampler bool
@@ -67,16 +67,7 @@ func LoadVAEDecoder(st *SafeTensors) (*VAEDecoder, error) {
 
 	// Mid block
 	v.MidResnet0 = loadVAEResNet(load, "decoder.mid_block.resnets.0.")
-	v.MidAttnNormW = load("decoder.mid_block.attentions.0.group_norm.weight")
-	v.MidAttnNormB = load("decoder.mid_block.attentions.0.group_norm.bias")
-	v.MidAttnQW = load("decoder.mid_block.attentions.0.to_q.weight")
-	v.MidAttnQB = load("decoder.mid_block.attentions.0.to_q.bias")
-	v.MidAttnKW = load("decoder.mid_block.attentions.0.to_k.weight")
-	v.MidAttnKB = load("decoder.mid_block.attentions.0.to_k.bias")
-	v.MidAttnVW = load("decoder.mid_block.attentions.0.to_v.weight")
-	v.MidAttnVB = load("decoder.mid_block.attentions.0.to_v.bias")
-	v.MidAttnOutW = load("decoder.mid_block.attentions.0.to_out.0.weight")
-	v.MidAttnOutB = load("decoder.mid_block.attentions.0.to_out.0.bias")
+	v.MidAttn = loadVAEAttention(load, "decoder.mid_block.attentions.0.")
 	v.MidResnet1 = loadVAEResNet(load, "decoder.mid_block.resnets.1.")
 
 	// Up blocks: 4 blocks, first 3 have upsamplers
@@ -116,6 +107,21 @@ func loadVAEResNet(load func(string) *Tensor, p string) VAEResNet {
 	}
 }
 
+func loadVAEAttention(load func(string) *Tensor, p string) VAEAttention {
+	return VAEAttention{
+		NormW: load(p + "group_norm.weight"),
+		NormB: load(p + "group_norm.bias"),
+		QW:    load(p + "to_q.weight"),
+		QB:    load(p + "to_q.bias"),
+		KW:    load(p + "to_k.weight"),
+		KB:    load(p + "to_k.bias"),
+		VW:    load(p + "to_v.weight"),
+		VB:    load(p + "to_v.bias"),
+		OutW:  load(p + "to_out.0.weight"),
+		OutB:  load(p + "to_out.0.bias"),
+	}
+}
+
 // Decode: latent [1,4,64,64] → image [1,3,512,512]
 func (v *VAEDecoder) Decode(latent *Tensor) *Tensor {
 	// 1. Post-quant conv: [1,4,64,64] → [1,4,64,64]
@@ -126,7 +132,7 @@ func (v *VAEDecoder) Decode(latent *Tensor) *Tensor {
 
 	// 3. Mid block: resnet → self-attention → resnet
 	x = vaeResnetForward(x, v.MidResnet0)
-	x = vaeMidAttention(x, v)
+	x = vaeMidAttention(x, v.MidAttn)
 	x = vaeResnetForward(x, v.MidResnet1)
 
 	// 4. Up blocks
@@ -172,11 +178,11 @@ func vaeResnetForward(x *Tensor, r VAEResNet) *Tensor {
 
 // vaeMidAttention: single-head self-attention on spatial features
 // Input: [1, 512, H, W] → GroupNorm → reshape to [H*W, 512] → Q/K/V → attention → reshape back
-func vaeMidAttention(x *Tensor, v *VAEDecoder) *Tensor {
+func vaeMidAttention(x *Tensor, a VAEAttention) *Tensor {
 	residual := x
 
 	// GroupNorm
-	h := GroupNorm(x, v.MidAttnNormW, v.MidAttnNormB, 32, 1e-6)
+	h := GroupNorm(x, a.NormW, a.NormB, 32, 1e-6)
 
 	// Reshape to 2D for attention
 	C := h.Shape[1] // 512
@@ -187,9 +193,9 @@ func vaeMidAttention(x *Tensor, v *VAEDecoder) *Tensor {
 	seq := H * W
 
 	// Q, K, V projections (with bias — VAE attention uses biases)
-	q := Linear(h2d, v.MidAttnQW, v.MidAttnQB)   // [seq, 512]
-	k := Linear(h2d, v.MidAttnKW, v.MidAttnKB)   // [seq, 512]
-	val := Linear(h2d, v.MidAttnVW, v.MidAttnVB)  // [seq, 512]
+	q := Linear(h2d, a.QW, a.QB)   // [seq, 512]
+	k := Linear(h2d, a.KW, a.KB)   // [seq, 512]
+	val := Linear(h2d, a.VW, a.VB) // [seq, 512]
 
 	// Single-head attention (headDim = C = 512)
 	scale := float32(1.0 / math.Sqrt(float64(C)))
@@ -237,9 +243,131 @@ func vaeMidAttention(x *Tensor, v *VAEDecoder) *Tensor {
 	}
 
 	// Output projection
-	out = Linear(out, v.MidAttnOutW, v.MidAttnOutB)
+	out = Linear(out, a.OutW, a.OutB)
 
 	// Reshape back to 4D and add residual
 	result := Reshape2Dto4D(out, C, H, W)
 	return Add(result, residual)
 }
+
+// VAEEncoder encodes image [1,3,512,512] → latent [1,4,64,64]
+// Architecture: conv_in → 4 down_blocks → mid_block → conv_norm_out → conv_out → quant_conv
+// Only the mean of the latent distribution is used (deterministic, no sampling).
+type VAEEncoder struct {
+	ConvInW, ConvInB *Tensor // [128,3,3,3]
+
+	// Down blocks (4): 2 resnets each, first 3 have downsamplers
+	DownBlocks [4]VAEDownBlock
+
+	MidResnet0 VAEResNet
+	MidAttn    VAEAttention
+	MidResnet1 VAEResNet
+
+	ConvNormW, ConvNormB   *Tensor // GroupNorm [512]
+	ConvOutW, ConvOutB     *Tensor // [8,512,3,3] → mean + logvar
+	QuantConvW, QuantConvB *Tensor // [8,8,1,1]
+}
+
+type VAEDownBlock struct {
+	Resnets        [2]VAEResNet
+	HasDownsampler bool
+	DownsamplerW   *Tensor
+	DownsamplerB   *Tensor
+}
+
+func LoadVAEEncoder(st *SafeTensors) (*VAEEncoder, error) {
+	v := &VAEEncoder{}
+
+	load := func(name string) *Tensor {
+		data, shape, err := st.GetFloat32(name)
+		if err != nil {
+			return nil
+		}
+		return TensorFrom(data, shape)
+	}
+
+	v.ConvInW = load("encoder.conv_in.weight")
+	v.ConvInB = load("encoder.conv_in.bias")
+	if v.ConvInW == nil {
+		return nil, fmt.Errorf("encoder weights not found")
+	}
+
+	hasDownsampler := [4]bool{true, true, true, false}
+	for i := 0; i < 4; i++ {
+		p := fmt.Sprintf("encoder.down_blocks.%d.", i)
+		v.DownBlocks[i].HasDownsampler = hasDownsampler[i]
+		for j := 0; j < 2; j++ {
+			v.DownBlocks[i].Resnets[j] = loadVAEResNet(load, fmt.Sprintf("%sresnets.%d.", p, j))
+		}
+		if hasDownsampler[i] {
+			v.DownBlocks[i].DownsamplerW = load(p + "downsamplers.0.conv.weight")
+			v.DownBlocks[i].DownsamplerB = load(p + "downsamplers.0.conv.bias")
+		}
+	}
+
+	v.MidResnet0 = loadVAEResNet(load, "encoder.mid_block.resnets.0.")
+	v.MidAttn = loadVAEAttention(load, "encoder.mid_block.attentions.0.")
+	v.MidResnet1 = loadVAEResNet(load, "encoder.mid_block.resnets.1.")
+
+	v.ConvNormW = load("encoder.conv_norm_out.weight")
+	v.ConvNormB = load("encoder.conv_norm_out.bias")
+	v.ConvOutW = load("encoder.conv_out.weight")
+	v.ConvOutB = load("encoder.conv_out.bias")
+	v.QuantConvW = load("quant_conv.weight")
+	v.QuantConvB = load("quant_conv.bias")
+
+	return v, nil
+}
+
+// Encode: image [1,3,512,512] in [-1,1] → unscaled latent mean [1,4,64,64]
+func (v *VAEEncoder) Encode(img *Tensor) *Tensor {
+	// 1. Conv in: [1,3,512,512] → [1,128,512,512]
+	x := Conv2d(img, v.ConvInW, v.ConvInB, 1, 1)
+
+	// 2. Down blocks
+	// block 0: 128→128, downsample 512→256
+	// block 1: 128→256, downsample 256→128
+	// block 2: 256→512, downsample 128→64
+	// block 3: 512→512, no downsample
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 2; j++ {
+			x = vaeResnetForward(x, v.DownBlocks[i].Resnets[j])
+		}
+		if v.DownBlocks[i].HasDownsampler {
+			// diffusers pads (0,1,0,1) then convolves with stride 2, no padding
+			x = padBottomRight(x)
+			x = Conv2d(x, v.DownBlocks[i].DownsamplerW, v.DownBlocks[i].DownsamplerB, 2, 0)
+		}
+	}
+
+	// 3. Mid block
+	x = vaeResnetForward(x, v.MidResnet0)
+	x = vaeMidAttention(x, v.MidAttn)
+	x = vaeResnetForward(x, v.MidResnet1)
+
+	// 4. Output: GroupNorm → SiLU → Conv [512→8] → quant conv
+	x = GroupNorm(x, v.ConvNormW, v.ConvNormB, 32, 1e-6)
+	x = SiLU(x)
+	x = Conv2d(x, v.ConvOutW, v.ConvOutB, 1, 1)
+	x = Conv2d(x, v.QuantConvW, v.QuantConvB, 1, 0)
+
+	// 5. Keep the mean (first 4 channels), drop logvar
+	N, H, W := x.Shape[0], x.Shape[2], x.Shape[3]
+	mean := NewTensor(N, 4, H, W)
+	for n := 0; n < N; n++ {
+		copy(mean.Data[n*4*H*W:(n+1)*4*H*W], x.Data[n*8*H*W:n*8*H*W+4*H*W])
+	}
+	return mean
+}
+
+// padBottomRight zero-pads one row at the bottom and one column at the right
+func padBottomRight(x *Tensor) *Tensor {
+	N, C, H, W := x.Shape[0], x.Shape[1], x.Shape[2], x.Shape[3]
+	out := NewTensor(N, C, H+1, W+1)
+	for nc := 0; nc < N*C; nc++ {
+		for y := 0; y < H; y++ {
+			copy(out.Data[(nc*(H+1)+y)*(W+1):], x.Data[(nc*H+y)*W:(nc*H+y+1)*W])
+		}
+	}
+	return out
+}
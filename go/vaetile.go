@@ -0,0 +1,138 @@
+package main
+
+// vaetile.go — tiled VAE decode
+//
+// The decoder's activations grow with the image: at 512px the last up
+// blocks hold [1,256,512,512] and [1,128,512,512] floats at once. Decoding
+// the latent in overlapping tiles bounds that by the tile size instead.
+// Overlaps are cross-faded so tile edges don't show as seams. The mid
+// block's attention only sees its own tile, so the result is close to,
+// not identical with, a whole decode.
+
+// vaeTileSize is the latent tile side for VAE decoding (--vae-tile);
+// 0 decodes the whole latent at once
+var vaeTileSize = 0
+
+// latentDecoder is the decoding half of the VAE (*VAEDecoder, vaeCodec)
+type latentDecoder interface {
+	Decode(latent *Tensor) *Tensor
+}
+
+// decodeLatent runs vae on latent, tiled when vaeTileSize asks for it
+func decodeLatent(vae latentDecoder, latent *Tensor) *Tensor {
+	if vaeTileSize <= 0 {
+		return vae.Decode(latent)
+	}
+	return tiledDecode(latent, vaeTileSize, vaeTileSize/4, vae.Decode)
+}
+
+// tiledDecode decodes a [1,C,H,W] latent in tile×tile pieces overlapping
+// by overlap latent pixels and blends them back together. decode must map
+// a latent tile to an image scaled by the same integer factor on both axes.
+// A latent that fits in one tile is decoded whole.
+func tiledDecode(latent *Tensor, tile, overlap int, decode func(*Tensor) *Tensor) *Tensor {
+	C, H, W := latent.Shape[1], latent.Shape[2], latent.Shape[3]
+	if tile <= 0 || (H <= tile && W <= tile) {
+		return decode(latent)
+	}
+	overlap = max(0, min(overlap, tile-1))
+
+	ys, xs := tileStarts(H, tile, overlap), tileStarts(W, tile, overlap)
+	var out *Tensor
+	var weight []float32
+	var outC, scale int
+	for _, y0 := range ys {
+		for _, x0 := range xs {
+			th, tw := min(tile, H-y0), min(tile, W-x0)
+			piece := decode(cropLatent(latent, C, H, W, y0, x0, th, tw))
+			if out == nil {
+				outC, scale = piece.Shape[1], piece.Shape[2]/th
+				out = NewTensor(1, outC, H*scale, W*scale)
+				weight = make([]float32, H*scale*W*scale)
+			}
+
+			// Feather each axis across the overlap; image borders stay at full weight
+			ph, pw := th*scale, tw*scale
+			fy := featherRamp(ph, overlap*scale, y0 > 0, y0+th < H)
+			fx := featherRamp(pw, overlap*scale, x0 > 0, x0+tw < W)
+			oy, ox := y0*scale, x0*scale
+			outW := W * scale
+			for c := 0; c < outC; c++ {
+				src := piece.Data[c*ph*pw:]
+				dst := out.Data[c*H*scale*outW:]
+				for y := 0; y < ph; y++ {
+					for x := 0; x < pw; x++ {
+						dst[(oy+y)*outW+ox+x] += fy[y] * fx[x] * src[y*pw+x]
+					}
+				}
+			}
+			for y := 0; y < ph; y++ {
+				for x := 0; x < pw; x++ {
+					weight[(oy+y)*outW+ox+x] += fy[y] * fx[x]
+				}
+			}
+		}
+	}
+
+	plane := len(weight)
+	for c := 0; c < outC; c++ {
+		for i, w := range weight {
+			out.Data[c*plane+i] /= w
+		}
+	}
+	return out
+}
+
+// tileStarts places tiles of side tile every tile-overlap pixels along n,
+// the last one flush with the end
+func tileStarts(n, tile, overlap int) []int {
+	if n <= tile {
+		return []int{0}
+	}
+	step := tile - overlap
+	var starts []int
+	for s := 0; s+tile < n; s += step {
+		starts = append(starts, s)
+	}
+	return append(starts, n-tile)
+}
+
+// featherRamp is the blend weight along one tile axis of n pixels: it
+// rises over the first ramp pixels when head is set and falls over the
+// last ramp pixels when tail is set, and is 1 elsewhere. Never 0.
+func featherRamp(n, ramp int, head, tail bool) []float32 {
+	w := make([]float32, n)
+	for i := range w {
+		w[i] = 1
+		if ramp <= 0 {
+			continue
+		}
+		if head {
+			w[i] = min(w[i], smoothstep((float32(i)+0.5)/float32(ramp)))
+		}
+		if tail {
+			w[i] = min(w[i], smoothstep((float32(n-i)-0.5)/float32(ramp)))
+		}
+	}
+	return w
+}
+
+// smoothstep eases t ∈ [0, 1] in and out: 3t² - 2t³, 1 past the end
+func smoothstep(t float32) float32 {
+	if t >= 1 {
+		return 1
+	}
+	return t * t * (3 - 2*t)
+}
+
+// cropLatent copies the [y0, y0+h) × [x0, x0+w) window of a [1,C,H,W] latent
+func cropLatent(latent *Tensor, C, H, W, y0, x0, h, w int) *Tensor {
+	t := NewTensor(1, C, h, w)
+	for c := 0; c < C; c++ {
+		for y := 0; y < h; y++ {
+			src := latent.Data[c*H*W+(y0+y)*W+x0:]
+			copy(t.Data[c*h*w+y*w:c*h*w+(y+1)*w], src[:w])
+		}
+	}
+	return t
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// blurVAE stands in for the decoder: a 3x3 box blur of the channel sum
+// (zero-padded, so tile edges see different neighbours than the whole
+// latent does), spread over 3 output channels and upscaled 8x
+func blurVAE(latent *Tensor) *Tensor {
+	C, H, W := latent.Shape[1], latent.Shape[2], latent.Shape[3]
+	const scale = 8
+	out := NewTensor(1, 3, H*scale, W*scale)
+	for y := 0; y < H; y++ {
+		for x := 0; x < W; x++ {
+			var v float32
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					yy, xx := y+dy, x+dx
+					if yy < 0 || yy >= H || xx < 0 || xx >= W {
+						continue
+					}
+					for c := 0; c < C; c++ {
+						v += latent.Data[c*H*W+yy*W+xx]
+					}
+				}
+			}
+			v /= 9
+			for c := 0; c < 3; c++ {
+				for sy := 0; sy < scale; sy++ {
+					for sx := 0; sx < scale; sx++ {
+						out.Data[c*H*W*scale*scale+(y*scale+sy)*W*scale+x*scale+sx] = v * float32(c+1)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// smoothLatent is a [1,4,H,W] latent of low-frequency noise, the kind of
+// field a diffusion latent is
+func smoothLatent(H, W int, seed int64) *Tensor {
+	rng := rand.New(rand.NewSource(seed))
+	t := NewTensor(1, 4, H, W)
+	for c := 0; c < 4; c++ {
+		fy, fx, ph := rng.Float64()*0.3, rng.Float64()*0.3, rng.Float64()*6
+		for y := 0; y < H; y++ {
+			for x := 0; x < W; x++ {
+				t.Data[c*H*W+y*W+x] = float32(math.Sin(fy*float64(y)+fx*float64(x)+ph)) + 0.05*float32(rng.NormFloat64())
+			}
+		}
+	}
+	return t
+}
+
+func TestTiledDecodeMatchesWhole(t *testing.T) {
+	latent := smoothLatent(24, 40, 1)
+	whole := blurVAE(latent)
+
+	tiled := tiledDecode(latent, 16, 4, blurVAE)
+	if len(tiled.Shape) != 4 || tiled.Shape[1] != 3 || tiled.Shape[2] != 24*8 || tiled.Shape[3] != 40*8 {
+		t.Fatalf("tiled shape = %v, want [1 3 192 320]", tiled.Shape)
+	}
+	// The stub's zero padding is far cruder than a real decoder's, so only
+	// ask that the blend keeps the error small next to the signal
+	var worst, peak float64
+	for i, v := range whole.Data {
+		worst = math.Max(worst, math.Abs(float64(tiled.Data[i]-v)))
+		peak = math.Max(peak, math.Abs(float64(v)))
+	}
+	if worst > 0.08*peak {
+		t.Errorf("tiled decode differs from the whole decode by up to %.3f (peak %.2f), want < 8%%", worst, peak)
+	}
+
+	// Without overlap the zero-padded tile edges show as hard seams
+	seamy := tiledDecode(latent, 16, 0, blurVAE)
+	var seam float64
+	for i, v := range whole.Data {
+		seam = math.Max(seam, math.Abs(float64(seamy.Data[i]-v)))
+	}
+	if seam <= worst {
+		t.Errorf("overlap should shrink the seams: %.3f with overlap, %.3f without", worst, seam)
+	}
+}
+
+func TestTiledDecodeSmallLatent(t *testing.T) {
+	latent := smoothLatent(8, 8, 2)
+	calls := 0
+	tiledDecode(latent, 16, 4, func(l *Tensor) *Tensor {
+		calls++
+		return blurVAE(l)
+	})
+	if calls != 1 {
+		t.Errorf("a latent inside one tile was decoded in %d pieces", calls)
+	}
+}
+
+func TestTileStarts(t *testing.T) {
+	for _, tc := range []struct{ n, tile, overlap int }{{40, 16, 4}, {64, 32, 8}, {17, 16, 4}, {16, 16, 4}} {
+		starts := tileStarts(tc.n, tc.tile, tc.overlap)
+		if starts[0] != 0 || starts[len(starts)-1]+min(tc.tile, tc.n) != tc.n {
+			t.Errorf("%+v: starts %v don't cover [0, %d)", tc, starts, tc.n)
+		}
+		for i := 1; i < len(starts); i++ {
+			if starts[i] > starts[i-1]+tc.tile-tc.overlap {
+				t.Errorf("%+v: starts %v leave less than the overlap between tiles", tc, starts)
+			}
+		}
+	}
+}
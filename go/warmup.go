@@ -0,0 +1,63 @@
+package main
+
+// warmup.go — pay the first-request cost at boot
+//
+// The first diffusion reads gigabytes of weights from a cold page cache and
+// the first reaction touches every model page; whoever sends the first
+// /react would wait for all of it. startServer runs warmUp in the
+// background instead, /react answers 503 + Retry-After until it is done,
+// and /health reports warmed_up and warmup_ms.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// warmupRetryAfter is the Retry-After (seconds) sent while warming up
+const warmupRetryAfter = "5"
+
+// warmUp runs one throwaway reaction and, if the diffusion backend is
+// ready, a one-step diffusion, then wipes what the reaction left in the
+// models' memory. Callers set s.warmingUp first so /react holds off meanwhile.
+func (s *Server) warmUp() {
+	defer s.warmingUp.Store(false)
+	start := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dy != nil {
+		s.yentMu.Lock()
+		s.dy.React("warm up", 8, 0.8)
+		s.dy.A.Reset()
+		s.dy.B.Reset()
+		s.dy.resetTurn()
+		s.yentMu.Unlock()
+	}
+
+	if backend := s.diffusion(); backend.Ready() && !s.textOnly {
+		ctx, cancel := s.generationContext(context.Background())
+		defer cancel()
+		if _, err := backend.Generate(ctx, "warm up", "", GenOpts{Steps: 1, LatentSize: 64, Guidance: 7.5}); err != nil {
+			fmt.Fprintf(os.Stderr, "[server] warm-up diffusion: %v\n", err)
+		}
+	}
+
+	s.warmupMs.Store(time.Since(start).Milliseconds())
+	s.warmedUp.Store(true)
+	fmt.Fprintf(os.Stderr, "[server] warmed up in %dms\n", s.warmupMs.Load())
+}
+
+// rejectWhileWarming answers 503 with Retry-After while warm-up is running.
+// Reports whether it did.
+func (s *Server) rejectWhileWarming(w http.ResponseWriter) bool {
+	if !s.warmingUp.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", warmupRetryAfter)
+	writeError(w, http.StatusServiceUnavailable, errCodeWarmingUp, "warming up")
+	return true
+}